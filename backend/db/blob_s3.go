@@ -0,0 +1,336 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3BlobStore keeps objects in a bucket of an S3 compatible service such as MinIO.
+// Objects are addressed path style: Endpoint/Bucket/key.
+type S3BlobStore struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+	// now is replaced in tests to sign with a fixed time.
+	now func() time.Time
+}
+
+func NewS3BlobStore(endpoint, region, bucket, accessKeyID, secretAccessKey string) BlobStore {
+	return &S3BlobStore{
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Client:          &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, key, nil, data, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+
+	if res.StatusCode != http.StatusOK {
+		return s3Error(res, key)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(res)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(res.Body)
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	}
+	return nil, s3Error(res, key)
+}
+
+// Open asks for the size of the object only. The content is fetched by Read,
+// from the offset set by Seek, so serving a range downloads that range only.
+func (s *S3BlobStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(res)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return &s3Object{ctx: ctx, store: s, key: key, size: res.ContentLength}, nil
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	}
+	return nil, s3Error(res, key)
+}
+
+type s3Object struct {
+	ctx   context.Context
+	store *S3BlobStore
+	key   string
+	size  int64
+	off   int64
+	body  io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.off >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		res, err := o.store.do(o.ctx, http.MethodGet, o.key, nil, nil, http.Header{"Range": {fmt.Sprintf("bytes=%d-", o.off)}})
+		if err != nil {
+			return 0, err
+		}
+		if res.StatusCode != http.StatusPartialContent && !(res.StatusCode == http.StatusOK && o.off == 0) {
+			defer closeBody(res)
+			return 0, s3Error(res, o.key)
+		}
+		o.body = res.Body
+	}
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.off
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.off {
+		if err := o.Close(); err != nil {
+			return 0, err
+		}
+		o.off = offset
+	}
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+
+	// S3 answers 204 whether the object existed or not
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return s3Error(res, key)
+	}
+	return nil
+}
+
+// List pages through ListObjectsV2.
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			err := s3Error(res, prefix)
+			closeBody(res)
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		closeBody(res)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			blobs = append(blobs, BlobInfo{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated {
+			return blobs, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object under key, or for the bucket when key is empty.
+func (s *S3BlobStore) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + s.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+	// send the path escaped exactly as it is signed
+	u.RawPath = uriEncode(u.Path, false)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	s.sign(req, body, now())
+	return s.Client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to req, signing every header it already has.
+func (s *S3BlobStore) sign(req *http.Request, body []byte, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		vs := append([]string{}, values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, as SigV4 requires.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(res *http.Response, key string) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return errors.Errorf("s3 %s %s: %s: %s", res.Request.Method, key, res.Status, body)
+}
+
+func closeBody(res *http.Response) {
+	if err := res.Body.Close(); err != nil {
+		log.Printf("failed res.Body.Close: %s", err.Error())
+	}
+}
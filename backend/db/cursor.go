@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+var ErrInvalidCursor = newError(ErrInvalidInput, "invalid_cursor", "invalid cursor")
+
+// cursor is the position of a row in one sort order.
+type cursor struct {
+	Order string `json:"o"`
+	Key   any    `json:"k"`
+	ID    int64  `json:"i"`
+	// Before pages backwards from the row.
+	Before bool `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// cursor only holds values scanned from the database
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, k keyset) (cursor, error) {
+	var c cursor
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Key == nil {
+		return c, ErrInvalidCursor
+	}
+	// a cursor from another sort order points nowhere in this one
+	if c.Order != k.name() {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// keyset orders rows by key and then id, both in the same direction,
+// so rows sharing a key still have a stable position.
+type keyset struct {
+	key  string
+	desc bool
+}
+
+func (k keyset) name() string {
+	if k.desc {
+		return "-" + k.key
+	}
+	return k.key
+}
+
+// pageQuery selects cols FROM from, adding key as the sort_key column.
+type pageQuery struct {
+	cols string
+	from string
+	args []any
+}
+
+// queryPage returns one page of q in the order of k.
+// scan reads the cols of a row and the trailing sort_key into key.
+func queryPage[T any](ctx context.Context, db executor, q pageQuery, k keyset, page domain.PageRequest, scan func(rows *sql.Rows, key *any) (T, int64, error)) ([]T, domain.PageInfo, error) {
+	c, err := decodeCursor(page.Cursor, k)
+	if err != nil {
+		return nil, domain.PageInfo{}, err
+	}
+
+	query := "SELECT * FROM (SELECT " + q.cols + ", " + k.key + " AS sort_key FROM " + q.from + ")"
+	args := append([]any{}, q.args...)
+	desc := k.desc != c.Before
+	if page.Cursor != "" {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		query += " WHERE (sort_key, id) " + op + " (?, ?)"
+		args = append(args, c.Key, c.ID)
+	}
+	if desc {
+		query += " ORDER BY sort_key desc, id desc"
+	} else {
+		query += " ORDER BY sort_key, id"
+	}
+	// one more row tells whether there is a further page
+	query += " LIMIT ?"
+	args = append(args, page.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, domain.PageInfo{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	type row struct {
+		v   T
+		id  int64
+		key any
+	}
+	var found []row
+	for rows.Next() {
+		var r row
+		if r.v, r.id, err = scan(rows, &r.key); err != nil {
+			return nil, domain.PageInfo{}, err
+		}
+		found = append(found, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.PageInfo{}, err
+	}
+
+	more := int64(len(found)) > page.Limit
+	if more {
+		found = found[:page.Limit]
+	}
+	if c.Before {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+
+	var info domain.PageInfo
+	if len(found) > 0 {
+		first, last := found[0], found[len(found)-1]
+		// paging backwards always came from a later page
+		if more || c.Before {
+			info.NextCursor = encodeCursor(cursor{Order: k.name(), Key: last.key, ID: last.id})
+		}
+		if c.Before && more || !c.Before && page.Cursor != "" {
+			info.PrevCursor = encodeCursor(cursor{Order: k.name(), Key: first.key, ID: first.id, Before: true})
+		}
+	}
+
+	res := make([]T, len(found))
+	for i, r := range found {
+		res[i] = r.v
+	}
+	return res, info, nil
+}
+
+// scanItem reads the columns of items.* followed by sort_key.
+func scanItem(rows *sql.Rows, key *any) (domain.Item, int64, error) {
+	var item domain.Item
+	err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt, key)
+	return item, item.ID, err
+}
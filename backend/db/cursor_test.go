@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+func TestQueryPage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB := newSchemaDB(t)
+	// prices and creation times tie so rows are told apart by id
+	if _, err := sqlDB.Exec(`INSERT INTO items (id, name, price, description, category_id, seller_id, status, created_at) VALUES
+		(1, 'a', 100, '', 1, 1, 1, '2023-06-01 10:00:00'),
+		(2, 'b', 200, '', 1, 1, 1, '2023-06-01 10:00:00'),
+		(3, 'c', 200, '', 1, 1, 1, '2023-06-02 10:00:00'),
+		(4, 'd', 200, '', 1, 1, 1, '2023-06-02 10:00:00'),
+		(5, 'e', 300, '', 1, 1, 1, '2023-06-02 10:00:00'),
+		(6, 'f', 300, '', 1, 1, 1, '2023-06-03 10:00:00'),
+		(7, 'g', 400, '', 1, 1, 1, '2023-06-03 10:00:00')`); err != nil {
+		t.Fatalf("failed to insert the items: %s", err.Error())
+	}
+
+	query := func(k keyset, page domain.PageRequest) ([]int64, domain.PageInfo) {
+		t.Helper()
+		items, info, err := queryPage(ctx, sqlDB, pageQuery{cols: "items.*", from: "items"}, k, page, scanItem)
+		if err != nil {
+			t.Fatalf("failed queryPage: %s", err.Error())
+		}
+		ids := make([]int64, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		return ids, info
+	}
+
+	cases := map[string]struct {
+		keyset keyset
+		limit  int64
+		// wantPages are the ids of every page from the first one
+		wantPages [][]int64
+	}{
+		"price ascending": {
+			keyset:    keyset{key: "items.price"},
+			limit:     3,
+			wantPages: [][]int64{{1, 2, 3}, {4, 5, 6}, {7}},
+		},
+		"price descending": {
+			keyset:    keyset{key: "items.price", desc: true},
+			limit:     3,
+			wantPages: [][]int64{{7, 6, 5}, {4, 3, 2}, {1}},
+		},
+		"text key descending": {
+			keyset:    keyset{key: "items.created_at", desc: true},
+			limit:     2,
+			wantPages: [][]int64{{7, 6}, {5, 4}, {3, 2}, {1}},
+		},
+		"last page is full": {
+			keyset:    keyset{key: "items.price"},
+			limit:     7,
+			wantPages: [][]int64{{1, 2, 3, 4, 5, 6, 7}},
+		},
+	}
+
+	for name, tt := range cases {
+		// forwards from the first page
+		var infos []domain.PageInfo
+		var page domain.PageRequest
+		for i, want := range tt.wantPages {
+			page.Limit = tt.limit
+			ids, info := query(tt.keyset, page)
+			if !equalIDs(ids, want) {
+				t.Fatalf("%s: unexpected page %d: want: %v, got: %v", name, i, want, ids)
+			}
+			if (info.PrevCursor != "") != (i > 0) {
+				t.Fatalf("%s: unexpected previous cursor of page %d: %q", name, i, info.PrevCursor)
+			}
+			if (info.NextCursor != "") != (i < len(tt.wantPages)-1) {
+				t.Fatalf("%s: unexpected next cursor of page %d: %q", name, i, info.NextCursor)
+			}
+			infos = append(infos, info)
+			page.Cursor = info.NextCursor
+		}
+
+		// backwards from the last page
+		for i := len(tt.wantPages) - 1; i > 0; i-- {
+			ids, info := query(tt.keyset, domain.PageRequest{Limit: tt.limit, Cursor: infos[i].PrevCursor})
+			want := tt.wantPages[i-1]
+			if !equalIDs(ids, want) {
+				t.Fatalf("%s: unexpected page %d going back: want: %v, got: %v", name, i-1, want, ids)
+			}
+			if (info.PrevCursor != "") != (i-1 > 0) {
+				t.Fatalf("%s: unexpected previous cursor of page %d going back: %q", name, i-1, info.PrevCursor)
+			}
+			if info.NextCursor == "" {
+				t.Fatalf("%s: next cursor of page %d going back is missing", name, i-1)
+			}
+		}
+	}
+
+	// a cursor of one order is rejected by another
+	_, info, err := queryPage(ctx, sqlDB, pageQuery{cols: "items.*", from: "items"}, keyset{key: "items.price"}, domain.PageRequest{Limit: 1}, scanItem)
+	if err != nil {
+		t.Fatalf("failed queryPage: %s", err.Error())
+	}
+	_, _, err = queryPage(ctx, sqlDB, pageQuery{cols: "items.*", from: "items"}, keyset{key: "items.price", desc: true}, domain.PageRequest{Limit: 1, Cursor: info.NextCursor}, scanItem)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("unexpected error: want: %v, got: %v", ErrInvalidCursor, err)
+	}
+}
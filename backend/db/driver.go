@@ -16,7 +16,8 @@ func PrepareDB(ctx context.Context) (*sql.DB, error) {
 		return nil, errors.Wrap(err, "failed to get current path: %w")
 	}
 
-	db, err := sql.Open("sqlite3", filepath.Join(path, "db", "mercari.sqlite3"))
+	// take the write lock at BEGIN so concurrent transactions wait instead of failing on upgrade
+	db, err := sql.Open("sqlite3", filepath.Join(path, "db", "mercari.sqlite3")+"?_txlock=immediate")
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create DB: %w")
 	}
@@ -34,5 +35,13 @@ func PrepareDB(ctx context.Context) (*sql.DB, error) {
 		return nil, errors.Wrap(err, "failed to exec query: %w")
 	}
 
+	if err = Migrate(ctx, db); err != nil {
+		return nil, errors.Wrap(err, "failed to migrate: %w")
+	}
+
+	if _, err = ReconcileBalances(ctx, db); err != nil {
+		return nil, errors.Wrap(err, "failed to reconcile balances: %w")
+	}
+
 	return db, nil
 }
@@ -0,0 +1,32 @@
+package db
+
+import "github.com/pkg/errors"
+
+// The kinds of errors the repositories return. Each kind maps to one status code,
+// and errors.Is matches an Error with its kind. sql.ErrNoRows counts as ErrNotFound.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInvalidInput       = errors.New("invalid input")
+)
+
+// Error is an error of one of the kinds with a code clients can tell it by.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+}
+
+func newError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTooManyItemImages    = newError(ErrPreconditionFailed, "too_many_images", fmt.Sprintf("an item can have up to %d images", domain.MaxItemImages))
+	ErrLastItemImage        = newError(ErrPreconditionFailed, "last_image", "the last image of an item cannot be deleted")
+	ErrItemImageSetMismatch = newError(ErrInvalidInput, "image_set_mismatch", "the ids do not match the images of the item")
+)
+
+// imageExtensions names blobs after their type, which helps when browsing the bucket.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// itemImagePrefix starts the key of every image blob.
+const itemImagePrefix = "items/"
+
+// newImageKey names a new image blob. Replaced images get a new key,
+// so a cached copy of the old image is never served under the new one.
+func newImageKey(itemID int64, contentType string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d/%s%s", itemImagePrefix, itemID, hex.EncodeToString(b), imageExtensions[contentType]), nil
+}
+
+func (r *ItemDBRepository) GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, "SELECT id, item_id, blob_key, content_type, position, created_at, updated_at FROM item_images WHERE item_id = ? ORDER BY position", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	var images []domain.ItemImage
+	for rows.Next() {
+		var img domain.ItemImage
+		if err := rows.Scan(&img.ID, &img.ItemID, &img.BlobKey, &img.ContentType, &img.Position, &img.CreatedAt, &img.UpdatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// AddItemImage stores the image after the other images of the item.
+func (r *ItemDBRepository) AddItemImage(ctx context.Context, itemID int64, image domain.ImageFile) (domain.ItemImage, error) {
+	if image.Data == nil {
+		return domain.ItemImage{}, fmt.Errorf("file is not specified")
+	}
+	key, err := newImageKey(itemID, image.ContentType)
+	if err != nil {
+		return domain.ItemImage{}, err
+	}
+	if err := r.Blobs.Put(ctx, key, image.Data); err != nil {
+		return domain.ItemImage{}, err
+	}
+
+	// the count and the insert are one statement, so concurrent uploads cannot pass the limit
+	res, err := conn(ctx, r.DB).ExecContext(ctx, `INSERT INTO item_images (item_id, blob_key, content_type, position, updated_at)
+		SELECT ?, ?, ?, COUNT(*), DATETIME('now', 'localtime') FROM item_images WHERE item_id = ? HAVING COUNT(*) < ?`, itemID, key, image.ContentType, itemID, domain.MaxItemImages)
+	if err == nil {
+		err = expectAffected(res)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrTooManyItemImages
+		}
+	}
+	if err != nil {
+		r.deleteBlob(ctx, key)
+		return domain.ItemImage{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return domain.ItemImage{}, err
+	}
+	var img domain.ItemImage
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT id, item_id, blob_key, content_type, position, created_at, updated_at FROM item_images WHERE id = ?", id)
+	return img, row.Scan(&img.ID, &img.ItemID, &img.BlobKey, &img.ContentType, &img.Position, &img.CreatedAt, &img.UpdatedAt)
+}
+
+// ReorderItemImages sets the display order to the order of ids, which must name every image of the item.
+func (r *ItemDBRepository) ReorderItemImages(ctx context.Context, itemID int64, ids []int64) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		images, err := r.GetItemImages(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		if len(images) != len(ids) {
+			return ErrItemImageSetMismatch
+		}
+		current := make(map[int64]bool, len(images))
+		for _, img := range images {
+			current[img.ID] = true
+		}
+		for _, id := range ids {
+			if !current[id] {
+				return ErrItemImageSetMismatch
+			}
+			// a repeated id would leave another image out
+			delete(current, id)
+		}
+
+		for i, id := range ids {
+			if _, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE item_images SET position = ?, updated_at = DATETIME('now', 'localtime') WHERE id = ? AND position != ?", i, id, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteItemImage removes one image and closes the gap it leaves in the order.
+func (r *ItemDBRepository) DeleteItemImage(ctx context.Context, itemID, imageID int64) error {
+	var deleted domain.ItemImage
+	err := NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		images, err := r.GetItemImages(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, img := range images {
+			if img.ID == imageID {
+				deleted, found = img, true
+			}
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+		if len(images) == 1 {
+			return ErrLastItemImage
+		}
+
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM item_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		_, err = conn(ctx, r.DB).ExecContext(ctx, "UPDATE item_images SET position = position - 1, updated_at = DATETIME('now', 'localtime') WHERE item_id = ? AND position > ?", itemID, deleted.Position)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	r.deleteImageBlobs(ctx, deleted.BlobKey)
+	return nil
+}
+
+// GetItemImage returns the cover image, or ErrBlobNotFound when the item has none.
+func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int64) (domain.ImageFile, error) {
+	return r.GetItemImageAt(ctx, id, 0)
+}
+
+// GetItemImageAt returns the image at index in the display order.
+func (r *ItemDBRepository) GetItemImageAt(ctx context.Context, itemID, index int64) (domain.ImageFile, error) {
+	img, err := r.GetItemImageInfo(ctx, itemID, index)
+	if err != nil {
+		return domain.ImageFile{}, err
+	}
+	data, err := r.Blobs.Get(ctx, img.BlobKey)
+	if err != nil {
+		return domain.ImageFile{}, err
+	}
+	return domain.ImageFile{ContentType: img.ContentType, Data: data}, nil
+}
+
+// GetItemImageInfo returns the row of the image at index, or ErrBlobNotFound when there is none.
+func (r *ItemDBRepository) GetItemImageInfo(ctx context.Context, itemID, index int64) (domain.ItemImage, error) {
+	var img domain.ItemImage
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT id, item_id, blob_key, content_type, position, created_at, updated_at FROM item_images WHERE item_id = ? AND position = ?", itemID, index)
+	err := row.Scan(&img.ID, &img.ItemID, &img.BlobKey, &img.ContentType, &img.Position, &img.CreatedAt, &img.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ItemImage{}, ErrBlobNotFound
+	}
+	return img, err
+}
+
+// UpdateItemImage replaces the cover image.
+func (r *ItemDBRepository) UpdateItemImage(ctx context.Context, id int64, image domain.ImageFile) error {
+	if image.Data == nil {
+		return fmt.Errorf("file is not specified")
+	}
+	var old string
+	err := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT blob_key FROM item_images WHERE item_id = ? AND position = 0", id).Scan(&old)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = r.AddItemImage(ctx, id, image)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	key, err := newImageKey(id, image.ContentType)
+	if err != nil {
+		return err
+	}
+	if err := r.Blobs.Put(ctx, key, image.Data); err != nil {
+		return err
+	}
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE item_images SET blob_key = ?, content_type = ?, updated_at = DATETIME('now', 'localtime') WHERE item_id = ? AND position = 0", key, image.ContentType, id); err != nil {
+		r.deleteBlob(ctx, key)
+		return err
+	}
+	r.deleteImageBlobs(ctx, old)
+	return nil
+}
+
+// deleteBlob is for cleanup after the database changed. A blob left behind is only wasted space.
+func (r *ItemDBRepository) deleteBlob(ctx context.Context, key string) {
+	if err := r.Blobs.Delete(ctx, key); err != nil {
+		log.Printf("failed to delete blob %s: %s", key, err.Error())
+	}
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+// DefaultImageGCMinAge keeps the blobs of uploads in progress, which are stored before their row.
+const DefaultImageGCMinAge = time.Hour
+
+// ImageGCReport lists the inconsistencies between item_images and the blob store.
+type ImageGCReport struct {
+	// OrphanBlobs are referred to by no image, variants of such blobs included.
+	// Only image and variant keys are considered, so other files in the store are left alone.
+	OrphanBlobs []BlobInfo
+	// OrphanImages belong to items that no longer exist.
+	OrphanImages []domain.ItemImage
+	// MissingBlobs are images whose blob is gone. They are only reported,
+	// as the seller has to upload them again.
+	MissingBlobs []domain.ItemImage
+	// ItemsWithoutImages are only reported too.
+	ItemsWithoutImages []int64
+	// Deleted is false for a dry run.
+	Deleted bool
+}
+
+// CollectImageGarbage reconciles the blob store with item_images. Unless dryRun is set,
+// it deletes the orphan blobs older than minAge and the images of deleted items.
+func CollectImageGarbage(ctx context.Context, db *sql.DB, blobs BlobStore, dryRun bool, minAge time.Duration) (ImageGCReport, error) {
+	var report ImageGCReport
+
+	// the rows are read before the blobs are listed, so a blob uploaded in between
+	// looks like an orphan, which minAge protects, and never like a missing blob
+	images, err := allItemImages(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	listed, err := blobs.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+
+	referenced := make(map[string]bool, len(images))
+	for _, img := range images {
+		if !img.orphan {
+			referenced[img.BlobKey] = true
+		}
+	}
+	exists := make(map[string]bool, len(listed))
+	for _, b := range listed {
+		exists[b.Key] = true
+	}
+
+	cutoff := time.Now().Add(-minAge)
+	for _, b := range listed {
+		// a variant is kept as long as its source image is
+		source, ok := imageBlobSource(b.Key)
+		if !ok || referenced[source] || b.ModTime.After(cutoff) {
+			continue
+		}
+		report.OrphanBlobs = append(report.OrphanBlobs, b)
+	}
+	for _, img := range images {
+		switch {
+		case img.orphan:
+			report.OrphanImages = append(report.OrphanImages, img.ItemImage)
+		case !exists[img.BlobKey]:
+			report.MissingBlobs = append(report.MissingBlobs, img.ItemImage)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM items WHERE NOT EXISTS (SELECT 1 FROM item_images WHERE item_images.item_id = items.id) ORDER BY id")
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return report, err
+		}
+		report.ItemsWithoutImages = append(report.ItemsWithoutImages, id)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	// their blobs are unreferenced, so they are among the orphan blobs once old enough
+	for _, img := range report.OrphanImages {
+		if _, err := db.ExecContext(ctx, "DELETE FROM item_images WHERE id = ?", img.ID); err != nil {
+			return report, err
+		}
+	}
+	for _, b := range report.OrphanBlobs {
+		if err := blobs.Delete(ctx, b.Key); err != nil {
+			return report, err
+		}
+	}
+	report.Deleted = true
+	return report, nil
+}
+
+type gcImage struct {
+	domain.ItemImage
+	// orphan is set when the item is gone
+	orphan bool
+}
+
+func allItemImages(ctx context.Context, db *sql.DB) ([]gcImage, error) {
+	rows, err := db.QueryContext(ctx, `SELECT item_images.id, item_images.item_id, item_images.blob_key, item_images.position, items.id IS NULL
+		FROM item_images LEFT JOIN items ON items.id = item_images.item_id ORDER BY item_images.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	var images []gcImage
+	for rows.Next() {
+		var img gcImage
+		if err := rows.Scan(&img.ID, &img.ItemID, &img.BlobKey, &img.Position, &img.orphan); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// imageBlobSource returns the image key the blob under key belongs to: key itself for an image
+// and the source for a variant. It reports false for keys this package does not write.
+func imageBlobSource(key string) (string, bool) {
+	rest := strings.TrimPrefix(key, variantPrefix)
+	if rest == key {
+		return key, isImageKey(key)
+	}
+	width, source, _ := strings.Cut(rest, "/")
+	for _, w := range domain.ImageVariantWidths {
+		if width == strconv.Itoa(w) {
+			return source, isImageKey(source)
+		}
+	}
+	return "", false
+}
+
+// isImageKey matches the keys newImageKey makes and the <item id>.jpg of backfillItemImages.
+func isImageKey(key string) bool {
+	rest := strings.TrimPrefix(key, itemImagePrefix)
+	if rest == key {
+		return strings.HasSuffix(key, ".jpg") && isDigits(strings.TrimSuffix(key, ".jpg"))
+	}
+	itemID, name, _ := strings.Cut(rest, "/")
+	ext := path.Ext(name)
+	known := ext == ""
+	for _, e := range imageExtensions {
+		known = known || ext == e
+	}
+	return isDigits(itemID) && known && isHex(strings.TrimSuffix(name, ext))
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func isHex(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789abcdef") == ""
+}
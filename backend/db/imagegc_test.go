@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCollectImageGarbage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	// item 2 lost its blob, item 3 has no image and item 9 is deleted
+	if _, err := sqlDB.Exec(`CREATE TABLE items (id integer primary key);
+		CREATE TABLE item_images (id integer primary key, item_id integer, blob_key text, position integer);
+		INSERT INTO items VALUES (1), (2), (3);
+		INSERT INTO item_images VALUES (1, 1, 'items/1/a.jpg', 0), (2, 2, 'items/2/b.jpg', 0), (3, 9, 'items/9/c.jpg', 0);`); err != nil {
+		t.Fatalf("failed to create the tables: %s", err.Error())
+	}
+
+	dir := t.TempDir()
+	blobs := NewLocalBlobStore(dir)
+	old := time.Now().Add(-2 * time.Hour)
+	for key, mtime := range map[string]time.Time{
+		"items/1/a.jpg":                  old,
+		variantKey("items/1/a.jpg", 150): old,
+		"items/9/c.jpg":                  old,
+		variantKey("items/9/c.jpg", 150): old,
+		"items/4/0a.jpg":                 old,
+		// an upload in progress
+		"items/4/0b.jpg": time.Now(),
+		// an image from before item_images
+		"8.jpg": old,
+		// not written by the image code
+		".gitkeep":                       old,
+		"notes.txt":                      old,
+		"items/4/readme.txt":             old,
+		"variants/999/items/9/c.jpg":     old,
+		variantKey("items/9/notes", 150): old,
+	} {
+		if err := blobs.Put(ctx, key, []byte("image")); err != nil {
+			t.Fatalf("failed Put: %s", err.Error())
+		}
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), mtime, mtime); err != nil {
+			t.Fatalf("failed os.Chtimes: %s", err.Error())
+		}
+	}
+
+	orphanKeys := func(report ImageGCReport) []string {
+		var keys []string
+		for _, b := range report.OrphanBlobs {
+			keys = append(keys, b.Key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	wantOrphans := []string{"8.jpg", "items/4/0a.jpg", "items/9/c.jpg", variantKey("items/9/c.jpg", 150)}
+	sort.Strings(wantOrphans)
+
+	for _, dryRun := range []bool{true, false} {
+		report, err := CollectImageGarbage(ctx, sqlDB, blobs, dryRun, time.Hour)
+		if err != nil {
+			t.Fatalf("failed CollectImageGarbage: %s", err.Error())
+		}
+		if got := orphanKeys(report); !reflect.DeepEqual(got, wantOrphans) {
+			t.Fatalf("unexpected orphan blobs: %v", got)
+		}
+		if len(report.OrphanImages) != 1 || report.OrphanImages[0].ItemID != 9 {
+			t.Fatalf("unexpected orphan images: %+v", report.OrphanImages)
+		}
+		if len(report.MissingBlobs) != 1 || report.MissingBlobs[0].ItemID != 2 {
+			t.Fatalf("unexpected missing blobs: %+v", report.MissingBlobs)
+		}
+		if len(report.ItemsWithoutImages) != 1 || report.ItemsWithoutImages[0] != 3 {
+			t.Fatalf("unexpected items without images: %v", report.ItemsWithoutImages)
+		}
+		if report.Deleted == dryRun {
+			t.Fatalf("unexpected Deleted: %v", report.Deleted)
+		}
+
+		_, err = blobs.Get(ctx, "items/4/0a.jpg")
+		if dryRun && err != nil {
+			t.Fatalf("the dry run deleted a blob: %v", err)
+		}
+		if !dryRun && !errors.Is(err, ErrBlobNotFound) {
+			t.Fatalf("the orphan blob is left: %v", err)
+		}
+	}
+
+	for _, key := range []string{"items/1/a.jpg", variantKey("items/1/a.jpg", 150), "items/4/0b.jpg",
+		".gitkeep", "notes.txt", "items/4/readme.txt", "variants/999/items/9/c.jpg", variantKey("items/9/notes", 150)} {
+		if _, err := blobs.Get(ctx, key); err != nil {
+			t.Fatalf("%s is deleted: %v", key, err)
+		}
+	}
+	var rows int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM item_images WHERE item_id = 9").Scan(&rows); err != nil || rows != 0 {
+		t.Fatalf("the image of the deleted item is left: %d, %v", rows, err)
+	}
+}
@@ -0,0 +1,103 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+// LedgerRepository reads the balance ledger.
+// Entries are only written by UserRepository together with the balance change.
+type LedgerRepository interface {
+	GetEntriesByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.LedgerEntry, domain.PageInfo, error)
+}
+
+type LedgerDBRepository struct {
+	*sql.DB
+}
+
+func NewLedgerRepository(db *sql.DB) LedgerRepository {
+	return &LedgerDBRepository{DB: db}
+}
+
+// GetEntriesByUserID returns one page of the entries of a user, newest first.
+func (r *LedgerDBRepository) GetEntriesByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.LedgerEntry, domain.PageInfo, error) {
+	return queryPage(ctx, conn(ctx, r.DB), pageQuery{
+		cols: "id, user_id, entry_type, amount, balance_after, IFNULL(item_id, 0) AS item_id, created_at",
+		from: "balance_ledger WHERE user_id = ?",
+		args: []any{userID},
+	}, keyset{key: "created_at", desc: true}, page, func(rows *sql.Rows, key *any) (domain.LedgerEntry, int64, error) {
+		var entry domain.LedgerEntry
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Type, &entry.Amount, &entry.BalanceAfter, &entry.ItemID, &entry.CreatedAt, key)
+		return entry, entry.ID, err
+	})
+}
+
+func addLedgerEntry(ctx context.Context, db *sql.DB, entry domain.LedgerEntry) error {
+	var itemID any
+	if entry.ItemID != 0 {
+		itemID = entry.ItemID
+	}
+	_, err := conn(ctx, db).ExecContext(ctx, "INSERT INTO balance_ledger (user_id, entry_type, amount, balance_after, item_id) VALUES (?, ?, ?, ?, ?)", entry.UserID, entry.Type, entry.Amount, entry.BalanceAfter, itemID)
+	return err
+}
+
+// BalanceDrift is a user whose balance differs from the sum of their ledger entries.
+type BalanceDrift struct {
+	UserID int64
+	// Expected is the sum of the ledger entries.
+	Expected int64
+	// Actual is users.balance, which the adjustment keeps.
+	Actual int64
+}
+
+// ReconcileBalances appends an adjustment entry for every user whose balance
+// differs from the sum of their ledger entries, e.g. balances loaded from seed data.
+// Every drift is logged and returned. After it runs, users.balance always equals
+// SUM(balance_ledger.amount).
+func ReconcileBalances(ctx context.Context, db *sql.DB) ([]BalanceDrift, error) {
+	var drifts []BalanceDrift
+	err := NewTransactor(db).Transaction(ctx, func(ctx context.Context) error {
+		rows, err := conn(ctx, db).QueryContext(ctx, `
+SELECT u.id, IFNULL(SUM(l.amount), 0), u.balance
+FROM users u LEFT JOIN balance_ledger l ON l.user_id = u.id
+GROUP BY u.id
+HAVING u.balance != IFNULL(SUM(l.amount), 0)
+ORDER BY u.id`)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Printf("failed rows.Close: %s", err.Error())
+			}
+		}()
+		for rows.Next() {
+			var d BalanceDrift
+			if err := rows.Scan(&d.UserID, &d.Expected, &d.Actual); err != nil {
+				return err
+			}
+			drifts = append(drifts, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, d := range drifts {
+			log.Printf("balance of user %d drifted from its ledger: expected %d, actual %d", d.UserID, d.Expected, d.Actual)
+			if err := addLedgerEntry(ctx, db, domain.LedgerEntry{
+				UserID:       d.UserID,
+				Type:         domain.LedgerEntryAdjustment,
+				Amount:       d.Actual - d.Expected,
+				BalanceAfter: d.Actual,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return drifts, err
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestGetEntriesByUserID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB := newSchemaDB(t)
+	// entries 2 and 3 were made in the same second
+	if _, err := sqlDB.Exec(`INSERT INTO balance_ledger (id, user_id, entry_type, amount, balance_after, item_id, created_at) VALUES
+		(1, 1, 'top_up', 100, 100, NULL, '2023-06-01 10:00:00'),
+		(2, 1, 'purchase', -30, 70, 5, '2023-06-02 10:00:00'),
+		(3, 1, 'top_up', 50, 120, NULL, '2023-06-02 10:00:00'),
+		(4, 2, 'top_up', 10, 10, NULL, '2023-06-03 10:00:00')`); err != nil {
+		t.Fatalf("failed to insert the entries: %s", err.Error())
+	}
+
+	repo := NewLedgerRepository(sqlDB)
+	first, info, err := repo.GetEntriesByUserID(ctx, 1, domain.PageRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("failed GetEntriesByUserID: %s", err.Error())
+	}
+	if len(first) != 2 || first[0].ID != 3 || first[1].ID != 2 || first[1].ItemID != 5 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	if info.NextCursor == "" || info.PrevCursor != "" {
+		t.Fatalf("unexpected cursors of the first page: %+v", info)
+	}
+
+	last, info, err := repo.GetEntriesByUserID(ctx, 1, domain.PageRequest{Limit: 2, Cursor: info.NextCursor})
+	if err != nil {
+		t.Fatalf("failed GetEntriesByUserID: %s", err.Error())
+	}
+	if len(last) != 1 || last[0].ID != 1 || last[0].ItemID != 0 {
+		t.Fatalf("unexpected last page: %+v", last)
+	}
+	if info.NextCursor != "" || info.PrevCursor == "" {
+		t.Fatalf("unexpected cursors of the last page: %+v", info)
+	}
+}
+
+func TestReconcileBalances(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB := newSchemaDB(t)
+	// user 1 matches their ledger, user 2 has a seed balance and user 3 drifted
+	if _, err := sqlDB.Exec(`INSERT INTO users (id, name, balance) VALUES (1, 'alice', 100), (2, 'bob', 50), (3, 'carol', 20);
+		INSERT INTO balance_ledger (user_id, entry_type, amount, balance_after) VALUES
+		(1, 'top_up', 100, 100),
+		(3, 'top_up', 30, 30)`); err != nil {
+		t.Fatalf("failed to insert the users: %s", err.Error())
+	}
+
+	drifts, err := ReconcileBalances(ctx, sqlDB)
+	if err != nil {
+		t.Fatalf("failed ReconcileBalances: %s", err.Error())
+	}
+	want := []BalanceDrift{{UserID: 2, Expected: 0, Actual: 50}, {UserID: 3, Expected: 30, Actual: 20}}
+	if !reflect.DeepEqual(want, drifts) {
+		t.Fatalf("unexpected drifts: want: %+v, got: %+v", want, drifts)
+	}
+
+	var adjustment int64
+	if err := sqlDB.QueryRow("SELECT amount FROM balance_ledger WHERE user_id = 3 AND entry_type = ?", domain.LedgerEntryAdjustment).Scan(&adjustment); err != nil || adjustment != -10 {
+		t.Fatalf("unexpected adjustment: %d, %v", adjustment, err)
+	}
+
+	// nothing is left to reconcile
+	if drifts, err := ReconcileBalances(ctx, sqlDB); err != nil || len(drifts) != 0 {
+		t.Fatalf("unexpected drifts after reconciling: %+v, %v", drifts, err)
+	}
+}
@@ -0,0 +1,86 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+type LoginRepository interface {
+	// GetLockout returns how long the longest lockout of the keys still lasts, 0 when none is.
+	GetLockout(ctx context.Context, keys ...string) (time.Duration, error)
+	// AddLoginFailure counts a failed login of the key and locks it out as the throttle says.
+	// It returns the lockout it started, 0 when there is none yet.
+	AddLoginFailure(ctx context.Context, key string, throttle domain.LoginThrottle) (time.Duration, error)
+	// ResetLoginFailures forgets the failures of the key after a successful login.
+	ResetLoginFailures(ctx context.Context, key string) error
+	AddLoginAttempt(ctx context.Context, attempt domain.LoginAttempt) error
+}
+
+type LoginDBRepository struct {
+	*sql.DB
+}
+
+func NewLoginRepository(db *sql.DB) LoginRepository {
+	return &LoginDBRepository{DB: db}
+}
+
+func (r *LoginDBRepository) GetLockout(ctx context.Context, keys ...string) (time.Duration, error) {
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	// locked_until has whole seconds, a lockout ending within the second still counts as one
+	row := conn(ctx, r.DB).QueryRowContext(ctx, `SELECT IFNULL(MAX(MAX(1, CAST(ROUND((JULIANDAY(locked_until) - JULIANDAY('now', 'localtime')) * 86400) AS integer))), 0)
+		FROM login_failures WHERE key IN (`+placeholders(len(keys))+`) AND locked_until > DATETIME('now', 'localtime')`, args...)
+
+	var seconds int64
+	if err := row.Scan(&seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (r *LoginDBRepository) AddLoginFailure(ctx context.Context, key string, throttle domain.LoginThrottle) (time.Duration, error) {
+	var lockout time.Duration
+	err := NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		// the count starts over once the window has passed since the last failure or lockout
+		row := conn(ctx, r.DB).QueryRowContext(ctx, `INSERT INTO login_failures (key, failures, last_failed_at) VALUES (?, 1, DATETIME('now', 'localtime'))
+			ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN MAX(last_failed_at, IFNULL(locked_until, '')) > DATETIME('now', 'localtime', ?) THEN failures + 1 ELSE 1 END,
+				last_failed_at = excluded.last_failed_at
+			RETURNING failures`, key, fmt.Sprintf("-%d seconds", int64(throttle.Window.Seconds())))
+
+		var failures int64
+		if err := row.Scan(&failures); err != nil {
+			return err
+		}
+		lockout = throttle.LockoutAfter(failures)
+		if lockout == 0 {
+			return nil
+		}
+		_, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE login_failures SET locked_until = DATETIME('now', 'localtime', ?) WHERE key = ?",
+			fmt.Sprintf("+%d seconds", int64(lockout.Seconds())), key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+func (r *LoginDBRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM login_failures WHERE key = ?", key)
+	return err
+}
+
+func (r *LoginDBRepository) AddLoginAttempt(ctx context.Context, attempt domain.LoginAttempt) error {
+	userID := sql.NullInt64{Int64: attempt.UserID, Valid: attempt.UserID != 0}
+	_, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO login_attempts (user_id, identifier, ip, outcome) VALUES (?, ?, ?, ?)",
+		userID, attempt.Identifier, attempt.IP, attempt.Outcome)
+	return err
+}
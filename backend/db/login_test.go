@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestAddLoginFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../sql/01_schema.sql")
+	if err != nil {
+		t.Fatalf("failed os.ReadFile: %s", err.Error())
+	}
+	start := bytes.Index(schema, []byte("CREATE TABLE IF NOT EXISTS login_failures"))
+	if start < 0 {
+		t.Fatalf("the login_failures table is missing from the schema")
+	}
+	if _, err := sqlDB.Exec(string(schema[start:])); err != nil {
+		t.Fatalf("failed to create the tables: %s", err.Error())
+	}
+
+	repo := NewLoginRepository(sqlDB)
+	throttle := domain.LoginThrottle{MaxFailures: 2, Lockout: time.Minute, MaxLockout: time.Hour, Window: 15 * time.Minute}
+	fail := func(want time.Duration) {
+		t.Helper()
+		lockout, err := repo.AddLoginFailure(ctx, "user:1", throttle)
+		if err != nil {
+			t.Fatalf("failed AddLoginFailure: %s", err.Error())
+		}
+		if lockout != want {
+			t.Fatalf("unexpected lockout: want: %s, got: %s", want, lockout)
+		}
+	}
+	lockedFor := func() time.Duration {
+		t.Helper()
+		lockout, err := repo.GetLockout(ctx, "user:1", "ip:192.0.2.1")
+		if err != nil {
+			t.Fatalf("failed GetLockout: %s", err.Error())
+		}
+		return lockout
+	}
+	shift := func(modifier string) {
+		t.Helper()
+		if _, err := sqlDB.Exec("UPDATE login_failures SET last_failed_at = DATETIME(last_failed_at, ?), locked_until = DATETIME(locked_until, ?)", modifier, modifier); err != nil {
+			t.Fatalf("failed to shift the times: %s", err.Error())
+		}
+	}
+
+	fail(0)
+	if lockout := lockedFor(); lockout != 0 {
+		t.Fatalf("locked out after the first failure: %s", lockout)
+	}
+	fail(time.Minute)
+	if lockout := lockedFor(); lockout < 59*time.Second || lockout > time.Minute {
+		t.Fatalf("unexpected lockout: %s", lockout)
+	}
+
+	// failing again right after the lockout doubles it
+	shift("-61 seconds")
+	if lockout := lockedFor(); lockout != 0 {
+		t.Fatalf("the lockout has not ended: %s", lockout)
+	}
+	fail(2 * time.Minute)
+
+	// the window passed since the end of the lockout
+	shift("-20 minutes")
+	fail(0)
+
+	if err := repo.ResetLoginFailures(ctx, "user:1"); err != nil {
+		t.Fatalf("failed ResetLoginFailures: %s", err.Error())
+	}
+	fail(0)
+
+	if err := repo.AddLoginAttempt(ctx, domain.LoginAttempt{Identifier: "carol", IP: "192.0.2.1", Outcome: domain.LoginFailed}); err != nil {
+		t.Fatalf("failed AddLoginAttempt: %s", err.Error())
+	}
+	var userID sql.NullInt64
+	if err := sqlDB.QueryRow("SELECT user_id FROM login_attempts").Scan(&userID); err != nil || userID.Valid {
+		t.Fatalf("unexpected user id of an unknown user: %v, %v", userID, err)
+	}
+}
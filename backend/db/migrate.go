@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// columnMigrations adds columns to the tables created by 01_schema.sql.
+// They are applied after the seed data is loaded, because 10_data.sql
+// inserts rows positionally with the original columns only.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{table: "category", column: "sort_order", definition: "integer NOT NULL DEFAULT 0"},
+	{table: "category", column: "retired_at", definition: "text"},
+	{table: "category", column: "parent_id", definition: "integer REFERENCES category(id)"},
+	// set when the name or parent changes, which item responses show. Empty until then
+	{table: "category", column: "updated_at", definition: "text NOT NULL DEFAULT ''"},
+	// images uploaded before the type was recorded were served as JPEG
+	{table: "item_images", column: "content_type", definition: "text NOT NULL DEFAULT 'image/jpeg'"},
+	// ALTER TABLE cannot default to the current time, backfillItemImages fills it in
+	{table: "item_images", column: "updated_at", definition: "text NOT NULL DEFAULT ''"},
+	{table: "users", column: "email", definition: "text"},
+	{table: "users", column: "role", definition: "text NOT NULL DEFAULT 'user'"},
+}
+
+// Migrate adds the missing columns and fills the search index. It is safe to run any number of times.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(ctx, db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return err
+		}
+	}
+	if err := uniqueUserNames(ctx, db); err != nil {
+		return err
+	}
+	if err := backfillItemImages(ctx, db); err != nil {
+		return err
+	}
+	return syncSearchIndex(ctx, db)
+}
+
+// uniqueUserNames makes user names, and emails, unique ignoring case. Names registered before that
+// are kept by their first user and get the user id appended for the others,
+// who can still log in with their user id. Every rename is logged.
+func uniqueUserNames(ctx context.Context, db *sql.DB) error {
+	renames, err := duplicateUserNames(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, r := range renames {
+		name := fmt.Sprintf("%s#%d", r.name, r.id)
+		if _, err := db.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", name, r.id); err != nil {
+			return errors.Wrapf(err, "failed to rename user %d from %q to %q", r.id, r.name, name)
+		}
+		log.Printf("renamed user %d from %q to %q: the name is taken by user %d", r.id, r.name, name, r.firstID)
+	}
+	if _, err := db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS users_name ON users (name COLLATE NOCASE)"); err != nil {
+		return err
+	}
+	// emails were not taken before they had to be unique
+	_, err = db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email COLLATE NOCASE) WHERE email IS NOT NULL")
+	return err
+}
+
+type userRename struct {
+	id      int64
+	name    string
+	firstID int64
+}
+
+// duplicateUserNames returns the users whose name an earlier user already has, ignoring case.
+func duplicateUserNames(ctx context.Context, db *sql.DB) ([]userRename, error) {
+	rows, err := db.QueryContext(ctx, `SELECT users.id, users.name, MIN(first.id) FROM users
+		JOIN users AS first ON first.name = users.name COLLATE NOCASE AND first.id < users.id
+		GROUP BY users.id ORDER BY users.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	var renames []userRename
+	for rows.Next() {
+		var r userRename
+		if err := rows.Scan(&r.id, &r.name, &r.firstID); err != nil {
+			return nil, err
+		}
+		renames = append(renames, r)
+	}
+	return renames, rows.Err()
+}
+
+// backfillItemImages registers the single image items had before item_images,
+// which LocalBlobStore kept as <item id>.jpg.
+func backfillItemImages(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `INSERT INTO item_images (item_id, blob_key, position, updated_at)
+		SELECT id, id || '.jpg', 0, DATETIME('now', 'localtime') FROM items
+		WHERE NOT EXISTS (SELECT 1 FROM item_images WHERE item_images.item_id = items.id)`); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "UPDATE item_images SET updated_at = created_at WHERE updated_at = ''")
+	return err
+}
+
+// syncSearchIndex fills items_fts when it was created on a database that already had items.
+// The triggers in 01_schema.sql keep it in sync after that.
+func syncSearchIndex(ctx context.Context, db *sql.DB) error {
+	var indexed, items int64
+	if err := db.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM items_fts_docsize), (SELECT COUNT(*) FROM items)").Scan(&indexed, &items); err != nil {
+		return err
+	}
+	if indexed == items {
+		return nil
+	}
+
+	log.Printf("rebuild search index: %d of %d items indexed", indexed, items)
+	_, err := db.ExecContext(ctx, "INSERT INTO items_fts (items_fts) VALUES ('rebuild')")
+	return err
+}
+
+func columnExists(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
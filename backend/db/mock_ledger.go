@@ -0,0 +1,52 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ledger.go
+
+// Package db is a generated GoMock package.
+package db
+
+import (
+	context "context"
+	reflect "reflect"
+
+	domain "github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLedgerRepository is a mock of LedgerRepository interface.
+type MockLedgerRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLedgerRepositoryMockRecorder
+}
+
+// MockLedgerRepositoryMockRecorder is the mock recorder for MockLedgerRepository.
+type MockLedgerRepositoryMockRecorder struct {
+	mock *MockLedgerRepository
+}
+
+// NewMockLedgerRepository creates a new mock instance.
+func NewMockLedgerRepository(ctrl *gomock.Controller) *MockLedgerRepository {
+	mock := &MockLedgerRepository{ctrl: ctrl}
+	mock.recorder = &MockLedgerRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLedgerRepository) EXPECT() *MockLedgerRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetEntriesByUserID mocks base method.
+func (m *MockLedgerRepository) GetEntriesByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.LedgerEntry, domain.PageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEntriesByUserID", ctx, userID, page)
+	ret0, _ := ret[0].([]domain.LedgerEntry)
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetEntriesByUserID indicates an expected call of GetEntriesByUserID.
+func (mr *MockLedgerRepositoryMockRecorder) GetEntriesByUserID(ctx, userID, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntriesByUserID", reflect.TypeOf((*MockLedgerRepository)(nil).GetEntriesByUserID), ctx, userID, page)
+}
@@ -0,0 +1,100 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: login.go
+
+// Package db is a generated GoMock package.
+package db
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	domain "github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLoginRepository is a mock of LoginRepository interface.
+type MockLoginRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginRepositoryMockRecorder
+}
+
+// MockLoginRepositoryMockRecorder is the mock recorder for MockLoginRepository.
+type MockLoginRepositoryMockRecorder struct {
+	mock *MockLoginRepository
+}
+
+// NewMockLoginRepository creates a new mock instance.
+func NewMockLoginRepository(ctrl *gomock.Controller) *MockLoginRepository {
+	mock := &MockLoginRepository{ctrl: ctrl}
+	mock.recorder = &MockLoginRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginRepository) EXPECT() *MockLoginRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddLoginAttempt mocks base method.
+func (m *MockLoginRepository) AddLoginAttempt(ctx context.Context, attempt domain.LoginAttempt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLoginAttempt", ctx, attempt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLoginAttempt indicates an expected call of AddLoginAttempt.
+func (mr *MockLoginRepositoryMockRecorder) AddLoginAttempt(ctx, attempt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLoginAttempt", reflect.TypeOf((*MockLoginRepository)(nil).AddLoginAttempt), ctx, attempt)
+}
+
+// AddLoginFailure mocks base method.
+func (m *MockLoginRepository) AddLoginFailure(ctx context.Context, key string, throttle domain.LoginThrottle) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLoginFailure", ctx, key, throttle)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddLoginFailure indicates an expected call of AddLoginFailure.
+func (mr *MockLoginRepositoryMockRecorder) AddLoginFailure(ctx, key, throttle interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLoginFailure", reflect.TypeOf((*MockLoginRepository)(nil).AddLoginFailure), ctx, key, throttle)
+}
+
+// GetLockout mocks base method.
+func (m *MockLoginRepository) GetLockout(ctx context.Context, keys ...string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range keys {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetLockout", varargs...)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLockout indicates an expected call of GetLockout.
+func (mr *MockLoginRepositoryMockRecorder) GetLockout(ctx interface{}, keys ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, keys...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLockout", reflect.TypeOf((*MockLoginRepository)(nil).GetLockout), varargs...)
+}
+
+// ResetLoginFailures mocks base method.
+func (m *MockLoginRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginFailures", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginFailures indicates an expected call of ResetLoginFailures.
+func (mr *MockLoginRepositoryMockRecorder) ResetLoginFailures(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginFailures", reflect.TypeOf((*MockLoginRepository)(nil).ResetLoginFailures), ctx, key)
+}
@@ -0,0 +1,112 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: order.go
+
+// Package db is a generated GoMock package.
+package db
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	domain "github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockOrderRepository is a mock of OrderRepository interface.
+type MockOrderRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderRepositoryMockRecorder
+}
+
+// MockOrderRepositoryMockRecorder is the mock recorder for MockOrderRepository.
+type MockOrderRepositoryMockRecorder struct {
+	mock *MockOrderRepository
+}
+
+// NewMockOrderRepository creates a new mock instance.
+func NewMockOrderRepository(ctrl *gomock.Controller) *MockOrderRepository {
+	mock := &MockOrderRepository{ctrl: ctrl}
+	mock.recorder = &MockOrderRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderRepository) EXPECT() *MockOrderRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddOrder mocks base method.
+func (m *MockOrderRepository) AddOrder(ctx context.Context, order domain.Order) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOrder", ctx, order)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOrder indicates an expected call of AddOrder.
+func (mr *MockOrderRepositoryMockRecorder) AddOrder(ctx, order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockOrderRepository)(nil).AddOrder), ctx, order)
+}
+
+// GetOrder mocks base method.
+func (m *MockOrderRepository) GetOrder(ctx context.Context, id int64) (domain.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", ctx, id)
+	ret0, _ := ret[0].(domain.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockOrderRepositoryMockRecorder) GetOrder(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockOrderRepository)(nil).GetOrder), ctx, id)
+}
+
+// GetOrdersByUserID mocks base method.
+func (m *MockOrderRepository) GetOrdersByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Order, domain.PageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrdersByUserID", ctx, userID, page)
+	ret0, _ := ret[0].([]domain.Order)
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetOrdersByUserID indicates an expected call of GetOrdersByUserID.
+func (mr *MockOrderRepositoryMockRecorder) GetOrdersByUserID(ctx, userID, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersByUserID", reflect.TypeOf((*MockOrderRepository)(nil).GetOrdersByUserID), ctx, userID, page)
+}
+
+// GetOrdersNotUpdatedSince mocks base method.
+func (m *MockOrderRepository) GetOrdersNotUpdatedSince(ctx context.Context, status domain.OrderStatus, d time.Duration) ([]domain.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrdersNotUpdatedSince", ctx, status, d)
+	ret0, _ := ret[0].([]domain.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrdersNotUpdatedSince indicates an expected call of GetOrdersNotUpdatedSince.
+func (mr *MockOrderRepositoryMockRecorder) GetOrdersNotUpdatedSince(ctx, status, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersNotUpdatedSince", reflect.TypeOf((*MockOrderRepository)(nil).GetOrdersNotUpdatedSince), ctx, status, d)
+}
+
+// UpdateOrderStatus mocks base method.
+func (m *MockOrderRepository) UpdateOrderStatus(ctx context.Context, id int64, from, to domain.OrderStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrderStatus", ctx, id, from, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrderStatus indicates an expected call of UpdateOrderStatus.
+func (mr *MockOrderRepositoryMockRecorder) UpdateOrderStatus(ctx, id, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockOrderRepository)(nil).UpdateOrderStatus), ctx, id, from, to)
+}
@@ -6,6 +6,7 @@ package db
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
 	domain "github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
@@ -50,6 +51,34 @@ func (mr *MockUserRepositoryMockRecorder) AddUser(ctx, user interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockUserRepository)(nil).AddUser), ctx, user)
 }
 
+// CreditBalance mocks base method.
+func (m *MockUserRepository) CreditBalance(ctx context.Context, entry domain.LedgerEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreditBalance", ctx, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreditBalance indicates an expected call of CreditBalance.
+func (mr *MockUserRepositoryMockRecorder) CreditBalance(ctx, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreditBalance", reflect.TypeOf((*MockUserRepository)(nil).CreditBalance), ctx, entry)
+}
+
+// DebitBalance mocks base method.
+func (m *MockUserRepository) DebitBalance(ctx context.Context, entry domain.LedgerEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DebitBalance", ctx, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DebitBalance indicates an expected call of DebitBalance.
+func (mr *MockUserRepositoryMockRecorder) DebitBalance(ctx, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebitBalance", reflect.TypeOf((*MockUserRepository)(nil).DebitBalance), ctx, entry)
+}
+
 // GetUser mocks base method.
 func (m *MockUserRepository) GetUser(ctx context.Context, id int64) (domain.User, error) {
 	m.ctrl.T.Helper()
@@ -65,18 +94,62 @@ func (mr *MockUserRepositoryMockRecorder) GetUser(ctx, id interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserRepository)(nil).GetUser), ctx, id)
 }
 
-// UpdateBalance mocks base method.
-func (m *MockUserRepository) UpdateBalance(ctx context.Context, id, balance int64) error {
+// GetUserByEmail mocks base method.
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBalance", ctx, id, balance)
+	ret := m.ctrl.Call(m, "GetUserByEmail", ctx, email)
+	ret0, _ := ret[0].(domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserRepositoryMockRecorder) GetUserByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserRepository)(nil).GetUserByEmail), ctx, email)
+}
+
+// GetUserByName mocks base method.
+func (m *MockUserRepository) GetUserByName(ctx context.Context, name string) (domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByName", ctx, name)
+	ret0, _ := ret[0].(domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByName indicates an expected call of GetUserByName.
+func (mr *MockUserRepositoryMockRecorder) GetUserByName(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByName", reflect.TypeOf((*MockUserRepository)(nil).GetUserByName), ctx, name)
+}
+
+// SetUserRole mocks base method.
+func (m *MockUserRepository) SetUserRole(ctx context.Context, id int64, role domain.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, id, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockUserRepositoryMockRecorder) SetUserRole(ctx, id, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockUserRepository)(nil).SetUserRole), ctx, id, role)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, password)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateBalance indicates an expected call of UpdateBalance.
-func (mr *MockUserRepositoryMockRecorder) UpdateBalance(ctx, id, balance interface{}) *gomock.Call {
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserRepositoryMockRecorder) UpdatePassword(ctx, id, password interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBalance", reflect.TypeOf((*MockUserRepository)(nil).UpdateBalance), ctx, id, balance)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserRepository)(nil).UpdatePassword), ctx, id, password)
 }
 
 // MockItemRepository is a mock of ItemRepository interface.
@@ -102,6 +175,21 @@ func (m *MockItemRepository) EXPECT() *MockItemRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddCategory mocks base method.
+func (m *MockItemRepository) AddCategory(ctx context.Context, name string, parentID int64) (domain.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCategory", ctx, name, parentID)
+	ret0, _ := ret[0].(domain.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddCategory indicates an expected call of AddCategory.
+func (mr *MockItemRepositoryMockRecorder) AddCategory(ctx, name, parentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCategory", reflect.TypeOf((*MockItemRepository)(nil).AddCategory), ctx, name, parentID)
+}
+
 // AddItem mocks base method.
 func (m *MockItemRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
 	m.ctrl.T.Helper()
@@ -117,6 +205,35 @@ func (mr *MockItemRepositoryMockRecorder) AddItem(ctx, item interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddItem", reflect.TypeOf((*MockItemRepository)(nil).AddItem), ctx, item)
 }
 
+// AddItemImage mocks base method.
+func (m *MockItemRepository) AddItemImage(ctx context.Context, itemID int64, image domain.ImageFile) (domain.ItemImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddItemImage", ctx, itemID, image)
+	ret0, _ := ret[0].(domain.ItemImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddItemImage indicates an expected call of AddItemImage.
+func (mr *MockItemRepositoryMockRecorder) AddItemImage(ctx, itemID, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddItemImage", reflect.TypeOf((*MockItemRepository)(nil).AddItemImage), ctx, itemID, image)
+}
+
+// DeleteItemImage mocks base method.
+func (m *MockItemRepository) DeleteItemImage(ctx context.Context, itemID, imageID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteItemImage", ctx, itemID, imageID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteItemImage indicates an expected call of DeleteItemImage.
+func (mr *MockItemRepositoryMockRecorder) DeleteItemImage(ctx, itemID, imageID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteItemImage", reflect.TypeOf((*MockItemRepository)(nil).DeleteItemImage), ctx, itemID, imageID)
+}
+
 // DeleteItems mocks base method.
 func (m *MockItemRepository) DeleteItems(ctx context.Context, item_id int64) error {
 	m.ctrl.T.Helper()
@@ -177,10 +294,10 @@ func (mr *MockItemRepositoryMockRecorder) GetItem(ctx, id interface{}) *gomock.C
 }
 
 // GetItemImage mocks base method.
-func (m *MockItemRepository) GetItemImage(ctx context.Context, id int64) ([]byte, error) {
+func (m *MockItemRepository) GetItemImage(ctx context.Context, id int64) (domain.ImageFile, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetItemImage", ctx, id)
-	ret0, _ := ret[0].([]byte)
+	ret0, _ := ret[0].(domain.ImageFile)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -191,49 +308,228 @@ func (mr *MockItemRepositoryMockRecorder) GetItemImage(ctx, id interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemImage", reflect.TypeOf((*MockItemRepository)(nil).GetItemImage), ctx, id)
 }
 
-// GetItemsByUserID mocks base method.
-func (m *MockItemRepository) GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error) {
+// GetItemImageAt mocks base method.
+func (m *MockItemRepository) GetItemImageAt(ctx context.Context, itemID, index int64) (domain.ImageFile, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetItemsByUserID", ctx, userID)
-	ret0, _ := ret[0].([]domain.Item)
+	ret := m.ctrl.Call(m, "GetItemImageAt", ctx, itemID, index)
+	ret0, _ := ret[0].(domain.ImageFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemImageAt indicates an expected call of GetItemImageAt.
+func (mr *MockItemRepositoryMockRecorder) GetItemImageAt(ctx, itemID, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemImageAt", reflect.TypeOf((*MockItemRepository)(nil).GetItemImageAt), ctx, itemID, index)
+}
+
+// GetItemImageInfo mocks base method.
+func (m *MockItemRepository) GetItemImageInfo(ctx context.Context, itemID, index int64) (domain.ItemImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemImageInfo", ctx, itemID, index)
+	ret0, _ := ret[0].(domain.ItemImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemImageInfo indicates an expected call of GetItemImageInfo.
+func (mr *MockItemRepositoryMockRecorder) GetItemImageInfo(ctx, itemID, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemImageInfo", reflect.TypeOf((*MockItemRepository)(nil).GetItemImageInfo), ctx, itemID, index)
+}
+
+// GetItemImages mocks base method.
+func (m *MockItemRepository) GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemImages", ctx, itemID)
+	ret0, _ := ret[0].([]domain.ItemImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItemImages indicates an expected call of GetItemImages.
+func (mr *MockItemRepositoryMockRecorder) GetItemImages(ctx, itemID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemImages", reflect.TypeOf((*MockItemRepository)(nil).GetItemImages), ctx, itemID)
+}
+
+// GetItemWithoutImage mocks base method.
+func (m *MockItemRepository) GetItemWithoutImage(ctx context.Context, id int64) (domain.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemWithoutImage", ctx, id)
+	ret0, _ := ret[0].(domain.Item)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetItemWithoutImage indicates an expected call of GetItemWithoutImage.
+func (mr *MockItemRepositoryMockRecorder) GetItemWithoutImage(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemWithoutImage", reflect.TypeOf((*MockItemRepository)(nil).GetItemWithoutImage), ctx, id)
+}
+
+// GetItemsByUserID mocks base method.
+func (m *MockItemRepository) GetItemsByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItemsByUserID", ctx, userID, page)
+	ret0, _ := ret[0].([]domain.Item)
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // GetItemsByUserID indicates an expected call of GetItemsByUserID.
-func (mr *MockItemRepositoryMockRecorder) GetItemsByUserID(ctx, userID interface{}) *gomock.Call {
+func (mr *MockItemRepositoryMockRecorder) GetItemsByUserID(ctx, userID, page interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemsByUserID", reflect.TypeOf((*MockItemRepository)(nil).GetItemsByUserID), ctx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItemsByUserID", reflect.TypeOf((*MockItemRepository)(nil).GetItemsByUserID), ctx, userID, page)
 }
 
 // GetOnSaleItems mocks base method.
-func (m *MockItemRepository) GetOnSaleItems(ctx context.Context) ([]domain.Item, error) {
+func (m *MockItemRepository) GetOnSaleItems(ctx context.Context, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOnSaleItems", ctx)
+	ret := m.ctrl.Call(m, "GetOnSaleItems", ctx, page)
 	ret0, _ := ret[0].([]domain.Item)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetOnSaleItems indicates an expected call of GetOnSaleItems.
-func (mr *MockItemRepositoryMockRecorder) GetOnSaleItems(ctx interface{}) *gomock.Call {
+func (mr *MockItemRepositoryMockRecorder) GetOnSaleItems(ctx, page interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnSaleItems", reflect.TypeOf((*MockItemRepository)(nil).GetOnSaleItems), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnSaleItems", reflect.TypeOf((*MockItemRepository)(nil).GetOnSaleItems), ctx, page)
 }
 
-// SearchItemsByWord mocks base method.
-func (m *MockItemRepository) SearchItemsByWord(ctx context.Context, word string) ([]domain.Item, error) {
+// GetOnSaleItemsByCategoryIDs mocks base method.
+func (m *MockItemRepository) GetOnSaleItemsByCategoryIDs(ctx context.Context, categoryIDs []int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SearchItemsByWord", ctx, word)
+	ret := m.ctrl.Call(m, "GetOnSaleItemsByCategoryIDs", ctx, categoryIDs, page)
 	ret0, _ := ret[0].([]domain.Item)
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetOnSaleItemsByCategoryIDs indicates an expected call of GetOnSaleItemsByCategoryIDs.
+func (mr *MockItemRepositoryMockRecorder) GetOnSaleItemsByCategoryIDs(ctx, categoryIDs, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnSaleItemsByCategoryIDs", reflect.TypeOf((*MockItemRepository)(nil).GetOnSaleItemsByCategoryIDs), ctx, categoryIDs, page)
+}
+
+// GetSearchFacets mocks base method.
+func (m *MockItemRepository) GetSearchFacets(ctx context.Context, q domain.ItemSearchQuery) (domain.SearchFacets, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSearchFacets", ctx, q)
+	ret0, _ := ret[0].(domain.SearchFacets)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// SearchItemsByWord indicates an expected call of SearchItemsByWord.
-func (mr *MockItemRepositoryMockRecorder) SearchItemsByWord(ctx, word interface{}) *gomock.Call {
+// GetSearchFacets indicates an expected call of GetSearchFacets.
+func (mr *MockItemRepositoryMockRecorder) GetSearchFacets(ctx, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSearchFacets", reflect.TypeOf((*MockItemRepository)(nil).GetSearchFacets), ctx, q)
+}
+
+// MoveCategory mocks base method.
+func (m *MockItemRepository) MoveCategory(ctx context.Context, id, parentID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveCategory", ctx, id, parentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveCategory indicates an expected call of MoveCategory.
+func (mr *MockItemRepositoryMockRecorder) MoveCategory(ctx, id, parentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveCategory", reflect.TypeOf((*MockItemRepository)(nil).MoveCategory), ctx, id, parentID)
+}
+
+// OpenItemImage mocks base method.
+func (m *MockItemRepository) OpenItemImage(ctx context.Context, img domain.ItemImage, width int) (io.ReadSeekCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenItemImage", ctx, img, width)
+	ret0, _ := ret[0].(io.ReadSeekCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenItemImage indicates an expected call of OpenItemImage.
+func (mr *MockItemRepositoryMockRecorder) OpenItemImage(ctx, img, width interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenItemImage", reflect.TypeOf((*MockItemRepository)(nil).OpenItemImage), ctx, img, width)
+}
+
+// RenameCategory mocks base method.
+func (m *MockItemRepository) RenameCategory(ctx context.Context, id int64, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameCategory", ctx, id, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenameCategory indicates an expected call of RenameCategory.
+func (mr *MockItemRepositoryMockRecorder) RenameCategory(ctx, id, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameCategory", reflect.TypeOf((*MockItemRepository)(nil).RenameCategory), ctx, id, name)
+}
+
+// ReorderCategories mocks base method.
+func (m *MockItemRepository) ReorderCategories(ctx context.Context, ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderCategories", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReorderCategories indicates an expected call of ReorderCategories.
+func (mr *MockItemRepositoryMockRecorder) ReorderCategories(ctx, ids interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchItemsByWord", reflect.TypeOf((*MockItemRepository)(nil).SearchItemsByWord), ctx, word)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderCategories", reflect.TypeOf((*MockItemRepository)(nil).ReorderCategories), ctx, ids)
+}
+
+// ReorderItemImages mocks base method.
+func (m *MockItemRepository) ReorderItemImages(ctx context.Context, itemID int64, ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderItemImages", ctx, itemID, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReorderItemImages indicates an expected call of ReorderItemImages.
+func (mr *MockItemRepositoryMockRecorder) ReorderItemImages(ctx, itemID, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderItemImages", reflect.TypeOf((*MockItemRepository)(nil).ReorderItemImages), ctx, itemID, ids)
+}
+
+// RetireCategory mocks base method.
+func (m *MockItemRepository) RetireCategory(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetireCategory", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetireCategory indicates an expected call of RetireCategory.
+func (mr *MockItemRepositoryMockRecorder) RetireCategory(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetireCategory", reflect.TypeOf((*MockItemRepository)(nil).RetireCategory), ctx, id)
+}
+
+// SearchItems mocks base method.
+func (m *MockItemRepository) SearchItems(ctx context.Context, q domain.ItemSearchQuery, page domain.PageRequest) ([]domain.ItemSearchResult, domain.PageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchItems", ctx, q, page)
+	ret0, _ := ret[0].([]domain.ItemSearchResult)
+	ret1, _ := ret[1].(domain.PageInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchItems indicates an expected call of SearchItems.
+func (mr *MockItemRepositoryMockRecorder) SearchItems(ctx, q, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchItems", reflect.TypeOf((*MockItemRepository)(nil).SearchItems), ctx, q, page)
 }
 
 // UpdateItem mocks base method.
@@ -251,16 +547,30 @@ func (mr *MockItemRepositoryMockRecorder) UpdateItem(ctx, item interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItem", reflect.TypeOf((*MockItemRepository)(nil).UpdateItem), ctx, item)
 }
 
+// UpdateItemImage mocks base method.
+func (m *MockItemRepository) UpdateItemImage(ctx context.Context, id int64, image domain.ImageFile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateItemImage", ctx, id, image)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateItemImage indicates an expected call of UpdateItemImage.
+func (mr *MockItemRepositoryMockRecorder) UpdateItemImage(ctx, id, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItemImage", reflect.TypeOf((*MockItemRepository)(nil).UpdateItemImage), ctx, id, image)
+}
+
 // UpdateItemStatus mocks base method.
-func (m *MockItemRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+func (m *MockItemRepository) UpdateItemStatus(ctx context.Context, id int64, from domain.ItemStatus, event domain.ItemEvent) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateItemStatus", ctx, id, status)
+	ret := m.ctrl.Call(m, "UpdateItemStatus", ctx, id, from, event)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateItemStatus indicates an expected call of UpdateItemStatus.
-func (mr *MockItemRepositoryMockRecorder) UpdateItemStatus(ctx, id, status interface{}) *gomock.Call {
+func (mr *MockItemRepositoryMockRecorder) UpdateItemStatus(ctx, id, from, event interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItemStatus", reflect.TypeOf((*MockItemRepository)(nil).UpdateItemStatus), ctx, id, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItemStatus", reflect.TypeOf((*MockItemRepository)(nil).UpdateItemStatus), ctx, id, from, event)
 }
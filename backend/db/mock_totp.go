@@ -0,0 +1,121 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: totp.go
+
+// Package db is a generated GoMock package.
+package db
+
+import (
+	context "context"
+	reflect "reflect"
+
+	domain "github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTOTPRepository is a mock of TOTPRepository interface.
+type MockTOTPRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTOTPRepositoryMockRecorder
+}
+
+// MockTOTPRepositoryMockRecorder is the mock recorder for MockTOTPRepository.
+type MockTOTPRepositoryMockRecorder struct {
+	mock *MockTOTPRepository
+}
+
+// NewMockTOTPRepository creates a new mock instance.
+func NewMockTOTPRepository(ctrl *gomock.Controller) *MockTOTPRepository {
+	mock := &MockTOTPRepository{ctrl: ctrl}
+	mock.recorder = &MockTOTPRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTOTPRepository) EXPECT() *MockTOTPRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteTOTP mocks base method.
+func (m *MockTOTPRepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTOTP", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTOTP indicates an expected call of DeleteTOTP.
+func (mr *MockTOTPRepositoryMockRecorder) DeleteTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTOTP", reflect.TypeOf((*MockTOTPRepository)(nil).DeleteTOTP), ctx, userID)
+}
+
+// EnableTOTP mocks base method.
+func (m *MockTOTPRepository) EnableTOTP(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", ctx, userID, step, recoveryCodes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP.
+func (mr *MockTOTPRepositoryMockRecorder) EnableTOTP(ctx, userID, step, recoveryCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockTOTPRepository)(nil).EnableTOTP), ctx, userID, step, recoveryCodes)
+}
+
+// GetTOTP mocks base method.
+func (m *MockTOTPRepository) GetTOTP(ctx context.Context, userID int64) (domain.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", ctx, userID)
+	ret0, _ := ret[0].(domain.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTP indicates an expected call of GetTOTP.
+func (mr *MockTOTPRepositoryMockRecorder) GetTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockTOTPRepository)(nil).GetTOTP), ctx, userID)
+}
+
+// SetPendingTOTP mocks base method.
+func (m *MockTOTPRepository) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPendingTOTP", ctx, userID, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPendingTOTP indicates an expected call of SetPendingTOTP.
+func (mr *MockTOTPRepositoryMockRecorder) SetPendingTOTP(ctx, userID, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPendingTOTP", reflect.TypeOf((*MockTOTPRepository)(nil).SetPendingTOTP), ctx, userID, secret)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockTOTPRepository) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockTOTPRepositoryMockRecorder) UseRecoveryCode(ctx, userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockTOTPRepository)(nil).UseRecoveryCode), ctx, userID, code)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockTOTPRepository) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockTOTPRepositoryMockRecorder) UseTOTPStep(ctx, userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockTOTPRepository)(nil).UseTOTPStep), ctx, userID, step)
+}
@@ -0,0 +1,105 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+// ErrOrderStatusMismatch is returned when a conditional status update finds the order in another status.
+var ErrOrderStatusMismatch = newError(ErrConflict, "order_status_changed", "order status has been changed")
+
+type OrderRepository interface {
+	AddOrder(ctx context.Context, order domain.Order) (int64, error)
+	GetOrder(ctx context.Context, id int64) (domain.Order, error)
+	GetOrdersByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Order, domain.PageInfo, error)
+	GetOrdersNotUpdatedSince(ctx context.Context, status domain.OrderStatus, d time.Duration) ([]domain.Order, error)
+	UpdateOrderStatus(ctx context.Context, id int64, from, to domain.OrderStatus) error
+}
+
+type OrderDBRepository struct {
+	*sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) OrderRepository {
+	return &OrderDBRepository{DB: db}
+}
+
+func (r *OrderDBRepository) AddOrder(ctx context.Context, order domain.Order) (int64, error) {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO orders (item_id, buyer_id, seller_id, price, status) VALUES (?, ?, ?, ?, ?)", order.ItemID, order.BuyerID, order.SellerID, order.Price, order.Status)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *OrderDBRepository) GetOrder(ctx context.Context, id int64) (domain.Order, error) {
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT * FROM orders WHERE id = ?", id)
+
+	var order domain.Order
+	return order, row.Scan(&order.ID, &order.ItemID, &order.BuyerID, &order.SellerID, &order.Price, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+}
+
+// GetOrdersByUserID returns one page of the orders a user bought or sold, newest first.
+func (r *OrderDBRepository) GetOrdersByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Order, domain.PageInfo, error) {
+	return queryPage(ctx, conn(ctx, r.DB), pageQuery{
+		cols: "orders.*",
+		from: "orders WHERE buyer_id = ? OR seller_id = ?",
+		args: []any{userID, userID},
+	}, keyset{key: "orders.created_at", desc: true}, page, func(rows *sql.Rows, key *any) (domain.Order, int64, error) {
+		var order domain.Order
+		err := rows.Scan(&order.ID, &order.ItemID, &order.BuyerID, &order.SellerID, &order.Price, &order.Status, &order.CreatedAt, &order.UpdatedAt, key)
+		return order, order.ID, err
+	})
+}
+
+// GetOrdersNotUpdatedSince returns the orders that have stayed in status for longer than d.
+func (r *OrderDBRepository) GetOrdersNotUpdatedSince(ctx context.Context, status domain.OrderStatus, d time.Duration) ([]domain.Order, error) {
+	return r.queryOrders(ctx, "SELECT * FROM orders WHERE status = ? AND updated_at <= DATETIME('now', 'localtime', ?) ORDER BY id", status, fmt.Sprintf("-%d seconds", int64(d.Seconds())))
+}
+
+func (r *OrderDBRepository) queryOrders(ctx context.Context, query string, args ...any) ([]domain.Order, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	var orders []domain.Order
+	for rows.Next() {
+		var order domain.Order
+		if err := rows.Scan(&order.ID, &order.ItemID, &order.BuyerID, &order.SellerID, &order.Price, &order.Status, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// UpdateOrderStatus changes the status only when the order is still in from.
+func (r *OrderDBRepository) UpdateOrderStatus(ctx context.Context, id int64, from, to domain.OrderStatus) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE orders SET status = ?, updated_at = DATETIME('now', 'localtime') WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrOrderStatusMismatch
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestGetOrdersByUserID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB := newSchemaDB(t)
+	// user 1 bought 1 and 3 and sold 4, orders 2 and 3 were made in the same second
+	if _, err := sqlDB.Exec(`INSERT INTO orders (id, item_id, buyer_id, seller_id, price, status, created_at) VALUES
+		(1, 10, 1, 2, 100, 0, '2023-06-01 10:00:00'),
+		(2, 20, 3, 2, 100, 0, '2023-06-02 10:00:00'),
+		(3, 30, 1, 2, 100, 0, '2023-06-02 10:00:00'),
+		(4, 40, 2, 1, 100, 0, '2023-06-03 10:00:00')`); err != nil {
+		t.Fatalf("failed to insert the orders: %s", err.Error())
+	}
+
+	repo := NewOrderRepository(sqlDB)
+	var ids []int64
+	page := domain.PageRequest{Limit: 2}
+	for {
+		orders, info, err := repo.GetOrdersByUserID(ctx, 1, page)
+		if err != nil {
+			t.Fatalf("failed GetOrdersByUserID: %s", err.Error())
+		}
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+		if info.NextCursor == "" {
+			break
+		}
+		page.Cursor = info.NextCursor
+	}
+	if want := []int64{4, 3, 1}; !equalIDs(ids, want) {
+		t.Fatalf("unexpected orders: want: %v, got: %v", want, ids)
+	}
+}
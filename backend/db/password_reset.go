@@ -0,0 +1,65 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidResetToken is returned for unknown, used and expired password reset tokens.
+var ErrInvalidResetToken = newError(ErrInvalidInput, "invalid_reset_token", "reset token is invalid or expired")
+
+type PasswordResetRepository interface {
+	// AddPasswordReset issues a password reset token of the user valid for ttl.
+	AddPasswordReset(ctx context.Context, userID int64, ttl time.Duration) (string, error)
+	// UsePasswordReset uses up the token and returns its user. The other tokens of the user stop working too.
+	UsePasswordReset(ctx context.Context, token string) (int64, error)
+}
+
+type PasswordResetDBRepository struct {
+	*sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &PasswordResetDBRepository{DB: db}
+}
+
+func (r *PasswordResetDBRepository) AddPasswordReset(ctx context.Context, userID int64, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM password_resets WHERE expires_at <= DATETIME('now', 'localtime')"); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, DATETIME('now', 'localtime', ?))",
+			hashToken(token), userID, fmt.Sprintf("+%d seconds", int64(ttl.Seconds())))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (r *PasswordResetDBRepository) UsePasswordReset(ctx context.Context, token string) (int64, error) {
+	var userID int64
+	err := NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		row := conn(ctx, r.DB).QueryRowContext(ctx, "DELETE FROM password_resets WHERE token_hash = ? AND expires_at > DATETIME('now', 'localtime') RETURNING user_id", hashToken(token))
+		if err := row.Scan(&userID); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		_, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM password_resets WHERE user_id = ?", userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
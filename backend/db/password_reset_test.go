@@ -0,0 +1,66 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestUsePasswordReset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../sql/01_schema.sql")
+	if err != nil {
+		t.Fatalf("failed os.ReadFile: %s", err.Error())
+	}
+	start := bytes.Index(schema, []byte("CREATE TABLE IF NOT EXISTS password_resets"))
+	if start < 0 {
+		t.Fatalf("the password_resets table is missing from the schema")
+	}
+	if _, err := sqlDB.Exec(string(schema[start:])); err != nil {
+		t.Fatalf("failed to create the table: %s", err.Error())
+	}
+
+	repo := NewPasswordResetRepository(sqlDB)
+	first, err := repo.AddPasswordReset(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddPasswordReset: %s", err.Error())
+	}
+	second, err := repo.AddPasswordReset(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddPasswordReset: %s", err.Error())
+	}
+	other, err := repo.AddPasswordReset(ctx, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddPasswordReset: %s", err.Error())
+	}
+
+	if userID, err := repo.UsePasswordReset(ctx, second); err != nil || userID != 1 {
+		t.Fatalf("unexpected result of UsePasswordReset: %d, %v", userID, err)
+	}
+	// used, and the older token of the same user
+	for _, token := range []string{second, first, "unknown"} {
+		if _, err := repo.UsePasswordReset(ctx, token); !errors.Is(err, ErrInvalidResetToken) {
+			t.Fatalf("unexpected error for %s: %v", token, err)
+		}
+	}
+
+	if _, err := sqlDB.Exec("UPDATE password_resets SET expires_at = DATETIME('now', 'localtime', '-1 seconds') WHERE user_id = 2"); err != nil {
+		t.Fatalf("failed to expire the token: %s", err.Error())
+	}
+	if _, err := repo.UsePasswordReset(ctx, other); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("unexpected error for an expired token: %v", err)
+	}
+}
@@ -2,25 +2,42 @@
 package db
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"fmt"
 	"io"
 	"log"
-	"os"
-	"strconv"
-	"sync"
+	"strings"
 
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
 )
 
+// FILE_DIR is where LocalBlobStore keeps images unless IMAGE_DIR is set.
 const FILE_DIR = "./images/"
 
+var (
+	// ErrItemStatusMismatch is returned when a conditional status update finds the item in another status.
+	ErrItemStatusMismatch = newError(ErrConflict, "item_status_changed", "item status has been changed")
+	// ErrItemNotEditable is returned for edits of items that are sold or withdrawn.
+	ErrItemNotEditable = newError(ErrPreconditionFailed, "item_not_editable", "sold or withdrawn items cannot be edited")
+	// ErrInsufficientBalance is returned when a debit would make the balance negative.
+	ErrInsufficientBalance = newError(ErrPreconditionFailed, "insufficient_balance", "insufficient balance")
+	// ErrUserNameTaken is returned when another user has the name, ignoring case.
+	ErrUserNameTaken = newError(ErrConflict, "user_name_taken", "user name is already taken")
+	// ErrUserEmailTaken is returned when another user has the email, ignoring case.
+	ErrUserEmailTaken = newError(ErrConflict, "user_email_taken", "email is already taken")
+)
+
 type UserRepository interface {
 	AddUser(ctx context.Context, user domain.User) (int64, error)
 	GetUser(ctx context.Context, id int64) (domain.User, error)
-	UpdateBalance(ctx context.Context, id int64, balance int64) error
+	GetUserByName(ctx context.Context, name string) (domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	SetUserRole(ctx context.Context, id int64, role domain.Role) error
+	DebitBalance(ctx context.Context, entry domain.LedgerEntry) error
+	CreditBalance(ctx context.Context, entry domain.LedgerEntry) error
 }
 
 type UserDBRepository struct {
@@ -32,61 +49,152 @@ func NewUserRepository(db *sql.DB) UserRepository {
 }
 
 func (r *UserDBRepository) AddUser(ctx context.Context, user domain.User) (int64, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?)", user.Name, user.Password); err != nil {
+	email := sql.NullString{String: user.Email, Valid: user.Email != ""}
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "INSERT INTO users (name, password, email) VALUES (?, ?, ?) RETURNING id", user.Name, user.Password, email)
+
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			if strings.Contains(sqliteErr.Error(), "users.email") {
+				return 0, ErrUserEmailTaken
+			}
+			return 0, ErrUserNameTaken
+		}
 		return 0, err
 	}
-	// TODO: if other insert query is executed at the same time, it might return wrong id
-	// http.StatusConflict(409) 既に同じIDがあった場合
-	row := r.QueryRowContext(ctx, "SELECT id FROM users WHERE rowid = LAST_INSERT_ROWID()")
+	return id, nil
+}
 
-	var id int64
-	return id, row.Scan(&id)
+const userColumns = "id, name, password, balance, IFNULL(email, ''), role"
+
+func scanUser(row *sql.Row) (domain.User, error) {
+	var user domain.User
+	return user, row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance, &user.Email, &user.Role)
 }
 
 func (r *UserDBRepository) GetUser(ctx context.Context, id int64) (domain.User, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM users WHERE id = ?", id)
+	return scanUser(conn(ctx, r.DB).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
 
-	var user domain.User
-	return user, row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance)
+// GetUserByName finds the user ignoring the case of the name.
+func (r *UserDBRepository) GetUserByName(ctx context.Context, name string) (domain.User, error) {
+	return scanUser(conn(ctx, r.DB).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE name = ? COLLATE NOCASE", name))
+}
+
+// GetUserByEmail finds the user ignoring the case of the email.
+func (r *UserDBRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	return scanUser(conn(ctx, r.DB).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ? COLLATE NOCASE", email))
 }
 
-func (r *UserDBRepository) UpdateBalance(ctx context.Context, id int64, balance int64) error {
-	if _, err := r.ExecContext(ctx, "UPDATE users SET balance = ? WHERE id = ?", balance, id); err != nil {
+// UpdatePassword replaces the password hash of the user.
+func (r *UserDBRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", password, id)
+	if err != nil {
 		return err
 	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *UserDBRepository) SetUserRole(ctx context.Context, id int64, role domain.Role) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
+// DebitBalance subtracts entry.Amount only when the user still has enough balance,
+// and records the movement in the ledger.
+func (r *UserDBRepository) DebitBalance(ctx context.Context, entry domain.LedgerEntry) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		row := conn(ctx, r.DB).QueryRowContext(ctx, "UPDATE users SET balance = balance - ? WHERE id = ? AND balance >= ? RETURNING balance", entry.Amount, entry.UserID, entry.Amount)
+		if err := row.Scan(&entry.BalanceAfter); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				if _, err := r.GetUser(ctx, entry.UserID); err != nil {
+					return err
+				}
+				return ErrInsufficientBalance
+			}
+			return err
+		}
+		entry.Amount = -entry.Amount
+		return addLedgerEntry(ctx, r.DB, entry)
+	})
+}
+
+// CreditBalance adds entry.Amount and records the movement in the ledger.
+func (r *UserDBRepository) CreditBalance(ctx context.Context, entry domain.LedgerEntry) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		row := conn(ctx, r.DB).QueryRowContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ? RETURNING balance", entry.Amount, entry.UserID)
+		if err := row.Scan(&entry.BalanceAfter); err != nil {
+			return err
+		}
+		return addLedgerEntry(ctx, r.DB, entry)
+	})
+}
+
 type ItemRepository interface {
 	AddItem(ctx context.Context, item domain.Item) (domain.Item, error)
 	DeleteItems(ctx context.Context, item_id int64) error
 	UpdateItem(ctx context.Context, item domain.Item) (domain.Item, error)
+	UpdateItemImage(ctx context.Context, id int64, image domain.ImageFile) error
 	GetItem(ctx context.Context, id int64) (domain.Item, error)
-	GetItemImage(ctx context.Context, id int64) ([]byte, error)
-	GetOnSaleItems(ctx context.Context) ([]domain.Item, error)
-	GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error)
+	GetItemWithoutImage(ctx context.Context, id int64) (domain.Item, error)
+	GetItemImage(ctx context.Context, id int64) (domain.ImageFile, error)
+	GetItemImageAt(ctx context.Context, itemID, index int64) (domain.ImageFile, error)
+	GetItemImageInfo(ctx context.Context, itemID, index int64) (domain.ItemImage, error)
+	OpenItemImage(ctx context.Context, img domain.ItemImage, width int) (io.ReadSeekCloser, error)
+	GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error)
+	AddItemImage(ctx context.Context, itemID int64, image domain.ImageFile) (domain.ItemImage, error)
+	ReorderItemImages(ctx context.Context, itemID int64, ids []int64) error
+	DeleteItemImage(ctx context.Context, itemID, imageID int64) error
+	GetOnSaleItems(ctx context.Context, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error)
+	GetOnSaleItemsByCategoryIDs(ctx context.Context, categoryIDs []int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error)
+	GetItemsByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error)
 	GetCategory(ctx context.Context, id int64) (domain.Category, error)
 	GetCategories(ctx context.Context) ([]domain.Category, error)
-	UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error
-	SearchItemsByWord(ctx context.Context, word string) ([]domain.Item, error)
+	AddCategory(ctx context.Context, name string, parentID int64) (domain.Category, error)
+	RenameCategory(ctx context.Context, id int64, name string) error
+	MoveCategory(ctx context.Context, id, parentID int64) error
+	ReorderCategories(ctx context.Context, ids []int64) error
+	RetireCategory(ctx context.Context, id int64) error
+	UpdateItemStatus(ctx context.Context, id int64, from domain.ItemStatus, event domain.ItemEvent) error
+	SearchItems(ctx context.Context, q domain.ItemSearchQuery, page domain.PageRequest) ([]domain.ItemSearchResult, domain.PageInfo, error)
+	GetSearchFacets(ctx context.Context, q domain.ItemSearchQuery) (domain.SearchFacets, error)
 }
 
 type ItemDBRepository struct {
 	*sql.DB
+	Blobs BlobStore
 }
 
-func NewItemRepository(db *sql.DB) ItemRepository {
-	return &ItemDBRepository{DB: db}
+func NewItemRepository(db *sql.DB, blobs BlobStore) ItemRepository {
+	return &ItemDBRepository{DB: db, Blobs: blobs}
 }
 
 func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, nil, item.Status); err != nil {
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, nil, item.Status); err != nil {
 		return domain.Item{}, err
 	}
 	// TODO: if other insert query is executed at the same time, it might return wrong id
 	// http.StatusConflict(409) 既に同じIDがあった場合
-	// row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE rowid = LAST_INSERT_ROWID()")
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE name=? AND price=? ORDER BY rowid DESC LIMIT 1", item.Name, item.Price)
+	// row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT * FROM items WHERE rowid = LAST_INSERT_ROWID()")
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT * FROM items WHERE name=? AND price=? ORDER BY rowid DESC LIMIT 1", item.Name, item.Price)
 
 	var res domain.Item
 	err := row.Scan(&res.ID, &res.Name, &res.Price, &res.Description, &res.CategoryID, &res.UserID, &res.Image, &res.Status, &res.CreatedAt, &res.UpdatedAt)
@@ -94,7 +202,7 @@ func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (domai
 		return domain.Item{}, err
 	}
 
-	err = saveImageLocal(res.ID, item.Image)
+	_, err = r.AddItemImage(ctx, res.ID, domain.ImageFile{ContentType: item.ImageContentType, Data: item.Image})
 	if err != nil {
 		deleteErr := r.DeleteItems(ctx, res.ID)
 		if deleteErr != nil {
@@ -107,52 +215,39 @@ func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (domai
 }
 
 func (r *ItemDBRepository) DeleteItems(ctx context.Context, item_id int64) error {
-	if _, err := r.ExecContext(ctx, "DELETE FROM items WHERE id = ?", item_id); err != nil {
+	images, err := r.GetItemImages(ctx, item_id)
+	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func saveImageLocal(id int64, file []byte) error {
-	if file == nil {
-		return fmt.Errorf("file is not specidied")
-	}
-	out, err := os.Create(FILE_DIR + strconv.FormatInt(id, 10) + ".jpg")
-	if err != nil {
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM item_images WHERE item_id = ?", item_id); err != nil {
 		return err
 	}
-	defer func() {
-		if err := out.Close(); err != nil {
-			log.Printf("failed out.Close: %s", err.Error())
-		}
-	}()
-
-	reader := bytes.NewReader(file)
-	if _, err := io.Copy(out, reader); err != nil {
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM items WHERE id = ?", item_id); err != nil {
 		return err
 	}
-
+	for _, img := range images {
+		r.deleteImageBlobs(ctx, img.BlobKey)
+	}
 	return nil
 }
 
 func (r *ItemDBRepository) UpdateItem(ctx context.Context, item domain.Item) (domain.Item, error) {
-	if _, err := r.ExecContext(ctx, "UPDATE items SET name = ?, category_id = ?, price = ?, description = ? WHERE id = ?", item.Name, item.CategoryID, item.Price, item.Description, item.ID); err != nil {
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE items SET name = ?, category_id = ?, price = ?, description = ?, updated_at = DATETIME('now', 'localtime') WHERE id = ?", item.Name, item.CategoryID, item.Price, item.Description, item.ID); err != nil {
 		return domain.Item{}, err
 	}
 
-	err := saveImageLocal(item.ID, item.Image)
-	if err != nil {
-		return domain.Item{}, err
+	// the images are managed one by one, so an update without an image keeps them
+	if item.Image != nil {
+		if err := r.UpdateItemImage(ctx, item.ID, domain.ImageFile{ContentType: item.ImageContentType, Data: item.Image}); err != nil {
+			return domain.Item{}, err
+		}
 	}
 
 	return r.GetItem(ctx, item.ID)
 }
 
 func (r *ItemDBRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE id = ?", id)
-
-	var item domain.Item
-	err := row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
+	item, err := r.GetItemWithoutImage(ctx, id)
 	if err != nil {
 		return domain.Item{}, err
 	}
@@ -161,58 +256,93 @@ func (r *ItemDBRepository) GetItem(ctx context.Context, id int64) (domain.Item,
 	if err != nil {
 		return domain.Item{}, err
 	}
-	item.Image = img
+	item.Image, item.ImageContentType = img.Data, img.ContentType
 
 	return item, nil
 }
 
-func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int64) ([]byte, error) {
-	f, err := os.OpenFile(FILE_DIR+strconv.FormatInt(id, 10)+".jpg", os.O_RDONLY, 0400)
+// GetItemWithoutImage returns the row of an item without reading its cover from the blob store.
+func (r *ItemDBRepository) GetItemWithoutImage(ctx context.Context, id int64) (domain.Item, error) {
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT * FROM items WHERE id = ?", id)
+
+	var item domain.Item
+	err := row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
 	if err != nil {
-		return nil, err
+		return domain.Item{}, err
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Printf("failed file close: %s", err.Error())
-		}
-	}()
+	return item, nil
+}
 
-	var dest []byte
-	blob := bytes.NewBuffer(dest)
-	if _, err := io.Copy(blob, f); err != nil {
-		return nil, err
+// onSaleItemsOrder lists the latest updated items first.
+var onSaleItemsOrder = keyset{key: "items.updated_at", desc: true}
+
+func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
+	return queryPage(ctx, conn(ctx, r.DB), pageQuery{
+		cols: "items.*",
+		from: "items WHERE status = ?",
+		args: []any{domain.ItemStatusOnSale},
+	}, onSaleItemsOrder, page, scanItem)
+}
+
+// GetOnSaleItemsByCategoryIDs returns the items on sale in any of categoryIDs.
+func (r *ItemDBRepository) GetOnSaleItemsByCategoryIDs(ctx context.Context, categoryIDs []int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
+	if len(categoryIDs) == 0 {
+		return nil, domain.PageInfo{}, nil
 	}
+	args := []any{domain.ItemStatusOnSale}
+	for _, id := range categoryIDs {
+		args = append(args, id)
+	}
+
+	return queryPage(ctx, conn(ctx, r.DB), pageQuery{
+		cols: "items.*",
+		from: "items WHERE status = ? AND category_id IN (" + placeholders(len(categoryIDs)) + ")",
+		args: args,
+	}, onSaleItemsOrder, page, scanItem)
+}
 
-	return blob.Bytes(), err
+// GetItemsByUserID lists the items of the seller in the order they were created.
+func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64, page domain.PageRequest) ([]domain.Item, domain.PageInfo, error) {
+	return queryPage(ctx, conn(ctx, r.DB), pageQuery{
+		cols: "items.*",
+		from: "items WHERE seller_id = ?",
+		args: []any{userID},
+	}, keyset{key: "items.created_at"}, page, scanItem)
 }
 
-func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE status = ? ORDER BY updated_at desc", domain.ItemStatusOnSale)
+// UpdateItemStatus applies event to an item in from, only when the event can happen
+// to it and the item is still in from.
+func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int64, from domain.ItemStatus, event domain.ItemEvent) error {
+	to, err := from.Apply(event)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("failed rows.Close: %s", err.Error())
-		}
-	}()
 
-	var items []domain.Item
-	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
-			return nil, err
-		}
-		items = append(items, item)
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE items SET status = ?, updated_at = DATETIME('now', 'localtime') WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrItemStatusMismatch
 	}
-	return items, nil
+	return nil
+}
+
+// GetCategory returns retired categories too, so existing items keep their category.
+func (r *ItemDBRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT id, name, IFNULL(parent_id, 0), sort_order, IFNULL(retired_at, ''), updated_at FROM category WHERE id = ?", id)
+
+	var cat domain.Category
+	return cat, row.Scan(&cat.ID, &cat.Name, &cat.ParentID, &cat.SortOrder, &cat.RetiredAt, &cat.UpdatedAt)
 }
 
-func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE seller_id = ?", userID)
+// GetCategories returns every category, retired ones included, in display order.
+func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, "SELECT id, name, IFNULL(parent_id, 0), sort_order, IFNULL(retired_at, ''), updated_at FROM category ORDER BY sort_order, id")
 	if err != nil {
 		return nil, err
 	}
@@ -222,82 +352,84 @@ func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) (
 		}
 	}()
 
-	var items []domain.Item
+	var cats []domain.Category
 	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
+		var cat domain.Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.ParentID, &cat.SortOrder, &cat.RetiredAt, &cat.UpdatedAt); err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		cats = append(cats, cat)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return items, nil
+	return cats, nil
 }
 
-func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
-	if _, err := r.ExecContext(ctx, "UPDATE items SET status = ? WHERE id = ?", status, id); err != nil {
-		return err
+// AddCategory appends a category at the end of the display order.
+// A parentID of 0 adds a root category.
+func (r *ItemDBRepository) AddCategory(ctx context.Context, name string, parentID int64) (domain.Category, error) {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO category (name, parent_id, sort_order) SELECT ?, NULLIF(?, 0), IFNULL(MAX(sort_order), 0) + 1 FROM category", name, parentID)
+	if err != nil {
+		return domain.Category{}, err
 	}
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return domain.Category{}, err
+	}
+	return r.GetCategory(ctx, id)
 }
 
-/*
-$ head -6 10_data.sql
-BEGIN TRANSACTION;
-
-INSERT INTO "category" VALUES(1,'food');
-INSERT INTO "category" VALUES(2,'fashion');
-INSERT INTO "category" VALUES(3,'furniture');
-*/
-var (
-	categories = []domain.Category{
-		{ID: 1, Name: "food"},
-		{ID: 2, Name: "fashion"},
-		{ID: 3, Name: "furniture"},
+func (r *ItemDBRepository) RenameCategory(ctx context.Context, id int64, name string) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE category SET name = ?, updated_at = DATETIME('now', 'localtime') WHERE id = ?", name, id)
+	if err != nil {
+		return err
 	}
-	categoryMu sync.RWMutex
-)
+	return expectAffected(res)
+}
 
-func (r *ItemDBRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
-	if !(1 <= id && id <= int64(len(categories))) {
-		return domain.Category{}, fmt.Errorf("invalid category ID: %d", id)
+// MoveCategory puts the category under parentID, or at the root when parentID is 0.
+func (r *ItemDBRepository) MoveCategory(ctx context.Context, id, parentID int64) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE category SET parent_id = NULLIF(?, 0), updated_at = DATETIME('now', 'localtime') WHERE id = ?", parentID, id)
+	if err != nil {
+		return err
 	}
-
-	categoryMu.RLock()
-	defer categoryMu.RUnlock()
-	return categories[id-1], nil
+	return expectAffected(res)
 }
 
-func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category, error) {
-	categoryMu.RLock()
-	defer categoryMu.RUnlock()
-	return categories, nil
+// ReorderCategories sets the display order to the order of ids.
+func (r *ItemDBRepository) ReorderCategories(ctx context.Context, ids []int64) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		for i, id := range ids {
+			res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE category SET sort_order = ? WHERE id = ?", i+1, id)
+			if err != nil {
+				return err
+			}
+			if err := expectAffected(res); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (r *ItemDBRepository) SearchItemsByWord(ctx context.Context, word string) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE name like ?", "%"+word+"%")
+// RetireCategory stops the category from being used for new listings.
+func (r *ItemDBRepository) RetireCategory(ctx context.Context, id int64) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE category SET retired_at = IFNULL(retired_at, DATETIME('now', 'localtime')) WHERE id = ?", id)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("failed rows.Close: %s", err.Error())
-		}
-	}()
+	return expectAffected(res)
+}
 
-	var items []domain.Item
-	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
-			return nil, err
-		}
-		items = append(items, item)
+// expectAffected returns sql.ErrNoRows when an update matched nothing.
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	if n == 0 {
+		return sql.ErrNoRows
 	}
-
-	return items, nil
+	return nil
 }
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// minSearchTermLength is the shortest term the trigram tokenizer can match.
+	minSearchTermLength = 3
+	// snippetLength is the snippet size in characters. Every character is a token with trigrams.
+	snippetLength = 32
+)
+
+// SearchItems returns the items matching every word and filter in q.
+// Words shorter than the trigram index can match fall back to LIKE, which cannot rank.
+func (r *ItemDBRepository) SearchItems(ctx context.Context, q domain.ItemSearchQuery, page domain.PageRequest) ([]domain.ItemSearchResult, domain.PageInfo, error) {
+	src := newSearchSource(q, noFacet)
+
+	pq := pageQuery{cols: "items.*", from: src.from + src.where()}
+	if src.fts {
+		pq.cols += ", highlight(items_fts, 0, ?, ?), snippet(items_fts, 1, ?, ?, '…', ?)"
+		pq.args = append(pq.args, domain.HighlightStart, domain.HighlightEnd, domain.HighlightStart, domain.HighlightEnd, snippetLength)
+	}
+	pq.args = append(pq.args, src.args...)
+
+	return queryPage(ctx, conn(ctx, r.DB), pq, searchOrder(q.Sort, src.fts), page, func(rows *sql.Rows, key *any) (domain.ItemSearchResult, int64, error) {
+		var res domain.ItemSearchResult
+		item := &res.Item
+		dest := []any{&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt}
+		if src.fts {
+			dest = append(dest, &res.NameHighlight, &res.Snippet)
+		}
+		if err := rows.Scan(append(dest, key)...); err != nil {
+			return res, 0, err
+		}
+		if !src.fts {
+			res.NameHighlight = markTerms(item.Name, src.terms)
+			res.Snippet = snippetAround(item.Description, src.terms, snippetLength)
+		}
+		return res, item.ID, nil
+	})
+}
+
+// GetSearchFacets counts the items matching q per category and price bucket.
+func (r *ItemDBRepository) GetSearchFacets(ctx context.Context, q domain.ItemSearchQuery) (domain.SearchFacets, error) {
+	var facets domain.SearchFacets
+
+	src := newSearchSource(q, categoryFacet)
+	err := r.countGroups(ctx, "SELECT items.category_id, COUNT(*) FROM "+src.from+src.where()+" GROUP BY items.category_id", src.args, func(id, count int64) {
+		facets.Categories = append(facets.Categories, domain.CategoryFacet{CategoryID: id, Count: count})
+	})
+	if err != nil {
+		return domain.SearchFacets{}, err
+	}
+
+	bounds := domain.PriceBucketBounds
+	facets.Prices = make([]domain.PriceFacet, len(bounds)+1)
+	for i := range facets.Prices {
+		if i > 0 {
+			facets.Prices[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			facets.Prices[i].Max = bounds[i]
+		}
+	}
+
+	// bucket i holds the prices below bounds[i] and not below bounds[i-1]
+	bucket := "CASE"
+	var args []any
+	for i, bound := range bounds {
+		bucket += " WHEN items.price < ? THEN " + strconv.Itoa(i)
+		args = append(args, bound)
+	}
+	bucket += " ELSE " + strconv.Itoa(len(bounds)) + " END"
+
+	src = newSearchSource(q, priceFacet)
+	err = r.countGroups(ctx, "SELECT "+bucket+" AS bucket, COUNT(*) FROM "+src.from+src.where()+" GROUP BY bucket", append(args, src.args...), func(i, count int64) {
+		facets.Prices[i].Count = count
+	})
+	if err != nil {
+		return domain.SearchFacets{}, err
+	}
+
+	return facets, nil
+}
+
+func (r *ItemDBRepository) countGroups(ctx context.Context, query string, args []any, fn func(key, count int64)) error {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed rows.Close: %s", err.Error())
+		}
+	}()
+
+	for rows.Next() {
+		var key, count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		fn(key, count)
+	}
+	return rows.Err()
+}
+
+// searchFacet is the filter a facet count leaves out.
+type searchFacet int
+
+const (
+	noFacet searchFacet = iota
+	categoryFacet
+	priceFacet
+)
+
+// searchSource is the FROM and WHERE shared by a search and its facet counts.
+type searchSource struct {
+	from  string
+	conds []string
+	args  []any
+	terms []string
+	// fts is set when the words are matched with the full-text index.
+	fts bool
+}
+
+func newSearchSource(q domain.ItemSearchQuery, omit searchFacet) searchSource {
+	src := searchSource{from: "items", terms: strings.Fields(q.Word)}
+
+	src.fts = len(src.terms) > 0
+	for _, term := range src.terms {
+		if utf8.RuneCountInString(term) < minSearchTermLength {
+			src.fts = false
+		}
+	}
+	if src.fts {
+		src.from = "items_fts JOIN items ON items.id = items_fts.rowid"
+		src.add("items_fts MATCH ?", matchQuery(src.terms))
+	} else {
+		for _, term := range src.terms {
+			pattern := "%" + escapeLike(term) + "%"
+			src.add(`(items.name LIKE ? ESCAPE '\' OR items.description LIKE ? ESCAPE '\')`, pattern, pattern)
+		}
+	}
+
+	if len(q.CategoryIDs) > 0 && omit != categoryFacet {
+		args := make([]any, len(q.CategoryIDs))
+		for i, id := range q.CategoryIDs {
+			args[i] = id
+		}
+		src.add("items.category_id IN ("+placeholders(len(args))+")", args...)
+	}
+	if q.MinPrice != nil && omit != priceFacet {
+		src.add("items.price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil && omit != priceFacet {
+		src.add("items.price <= ?", *q.MaxPrice)
+	}
+	statuses := q.Statuses
+	if len(statuses) == 0 {
+		statuses = domain.SearchableItemStatuses
+	}
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	src.add("items.status IN ("+placeholders(len(args))+")", args...)
+	if q.SellerID != 0 {
+		src.add("items.seller_id = ?", q.SellerID)
+	}
+	return src
+}
+
+func (s *searchSource) add(cond string, args ...any) {
+	s.conds = append(s.conds, cond)
+	s.args = append(s.args, args...)
+}
+
+func (s searchSource) where() string {
+	if len(s.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(s.conds, " AND ")
+}
+
+func searchOrder(sort domain.ItemSearchSort, fts bool) keyset {
+	switch sort {
+	case domain.ItemSearchSortNewest:
+		return keyset{key: "items.created_at", desc: true}
+	case domain.ItemSearchSortPriceAsc:
+		return keyset{key: "items.price"}
+	case domain.ItemSearchSortPriceDesc:
+		return keyset{key: "items.price", desc: true}
+	}
+	if fts {
+		// bm25 rank is lower for better matches
+		return keyset{key: "rank"}
+	}
+	return onSaleItemsOrder
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// matchQuery quotes each term as an FTS5 phrase so operators in user input are not parsed.
+func matchQuery(terms []string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(phrases, " ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// markTerms marks every occurrence of terms in text, ignoring ASCII case like LIKE does.
+func markTerms(text string, terms []string) string {
+	lower := asciiLower(text)
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		n := 0
+		for _, term := range terms {
+			if len(term) > n && strings.HasPrefix(lower[i:], asciiLower(term)) {
+				n = len(term)
+			}
+		}
+		if n > 0 {
+			b.WriteString(domain.HighlightStart + text[i:i+n] + domain.HighlightEnd)
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// snippetAround cuts about length characters of text around the first match and marks the terms.
+func snippetAround(text string, terms []string, length int) string {
+	lower := asciiLower(text)
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, asciiLower(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	runes := []rune(text)
+	start := 0
+	if first > 0 {
+		start = utf8.RuneCountInString(text[:first]) - length/4
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := markTerms(string(runes[start:end]), terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// asciiLower lowercases ASCII letters only, so byte offsets stay the same as in s.
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+// newSchemaDB returns a database with every table of the schema but items_fts, which
+// needs the sqlite_fts5 tag. Searches without a word do not use the index.
+func newSchemaDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	sqlDB.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../sql/01_schema.sql")
+	if err != nil {
+		t.Fatalf("failed os.ReadFile: %s", err.Error())
+	}
+	start := bytes.Index(schema, []byte("-- full-text index"))
+	end := bytes.Index(schema, []byte("CREATE TABLE IF NOT EXISTS users"))
+	if start < 0 || end < start {
+		t.Fatalf("the full-text index is missing from the schema")
+	}
+	if _, err := sqlDB.Exec(string(schema[:start]) + string(schema[end:])); err != nil {
+		t.Fatalf("failed to create the tables: %s", err.Error())
+	}
+	return sqlDB
+}
+
+func TestSearchItemsStatuses(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB := newSchemaDB(t)
+	// one item in every status, item n has status n-1
+	if _, err := sqlDB.Exec(`INSERT INTO items (id, name, price, description, category_id, seller_id, status) VALUES
+		(1, 'draft', 100, '', 1, 1, 0), (2, 'on sale', 100, '', 1, 1, 1), (3, 'sold', 100, '', 1, 1, 2),
+		(4, 'paused', 100, '', 1, 1, 3), (5, 'withdrawn', 100, '', 1, 1, 4)`); err != nil {
+		t.Fatalf("failed to insert the items: %s", err.Error())
+	}
+
+	cases := map[string]struct {
+		statuses []domain.ItemStatus
+		sellerID int64
+		wantIDs  []int64
+	}{
+		"on sale and sold items by default": {wantIDs: []int64{2, 3}},
+		"no drafts of a seller":             {sellerID: 1, wantIDs: []int64{2, 3}},
+		"the statuses asked for":            {statuses: []domain.ItemStatus{domain.ItemStatusSoldOut}, wantIDs: []int64{3}},
+	}
+
+	repo := &ItemDBRepository{DB: sqlDB}
+	for name, tt := range cases {
+		q := domain.ItemSearchQuery{Statuses: tt.statuses, SellerID: tt.sellerID, Sort: domain.ItemSearchSortPriceAsc}
+		items, _, err := repo.SearchItems(ctx, q, domain.PageRequest{Limit: 10})
+		if err != nil {
+			t.Fatalf("%s: failed SearchItems: %s", name, err.Error())
+		}
+		var ids []int64
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if !equalIDs(ids, tt.wantIDs) {
+			t.Fatalf("%s: unexpected items: want: %v, got: %v", name, tt.wantIDs, ids)
+		}
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown and expired refresh tokens, and those of revoked sessions.
+	ErrInvalidRefreshToken = newError(ErrUnauthorized, "invalid_refresh_token", "refresh token is invalid or expired")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is presented again.
+	// Someone else may have it, so its session is revoked.
+	ErrRefreshTokenReused = newError(ErrUnauthorized, "refresh_token_reused", "refresh token has already been used, the session is revoked")
+)
+
+type SessionRepository interface {
+	// AddSession starts a session with a refresh token valid for ttl.
+	AddSession(ctx context.Context, userID int64, ttl time.Duration) (domain.Session, string, error)
+	// RotateRefreshToken uses up the refresh token and returns the next one of its session.
+	RotateRefreshToken(ctx context.Context, refreshToken string, ttl time.Duration) (domain.Session, string, error)
+	GetSession(ctx context.Context, id string) (domain.Session, error)
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userID int64) error
+}
+
+type SessionDBRepository struct {
+	*sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &SessionDBRepository{DB: db}
+}
+
+func (r *SessionDBRepository) AddSession(ctx context.Context, userID int64, ttl time.Duration) (domain.Session, string, error) {
+	var session domain.Session
+	var refreshToken string
+	err := NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		id, err := randomToken(16)
+		if err != nil {
+			return err
+		}
+		row := conn(ctx, r.DB).QueryRowContext(ctx, "INSERT INTO sessions (id, user_id) VALUES (?, ?) RETURNING id, user_id, created_at", id, userID)
+		if err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt); err != nil {
+			return err
+		}
+		refreshToken, err = r.addRefreshToken(ctx, session.ID, ttl)
+		return err
+	})
+	return session, refreshToken, err
+}
+
+func (r *SessionDBRepository) RotateRefreshToken(ctx context.Context, refreshToken string, ttl time.Duration) (domain.Session, string, error) {
+	var session domain.Session
+	var next string
+	var reused bool
+	err := NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		row := conn(ctx, r.DB).QueryRowContext(ctx, `SELECT sessions.id, sessions.user_id, sessions.created_at, IFNULL(sessions.revoked_at, ''),
+			refresh_tokens.used_at IS NOT NULL, refresh_tokens.expires_at > DATETIME('now', 'localtime')
+			FROM refresh_tokens JOIN sessions ON sessions.id = refresh_tokens.session_id WHERE refresh_tokens.token_hash = ?`, hashToken(refreshToken))
+		var used, live bool
+		if err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt, &used, &live); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if session.IsRevoked() || !live {
+			return ErrInvalidRefreshToken
+		}
+		if used {
+			// revoked in this transaction, which has to be committed
+			reused = true
+			return r.RevokeSession(ctx, session.ID)
+		}
+
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE refresh_tokens SET used_at = DATETIME('now', 'localtime') WHERE token_hash = ?", hashToken(refreshToken)); err != nil {
+			return err
+		}
+		// used tokens are kept until they expire to tell when they come back
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM refresh_tokens WHERE session_id = ? AND expires_at <= DATETIME('now', 'localtime')", session.ID); err != nil {
+			return err
+		}
+		var err error
+		next, err = r.addRefreshToken(ctx, session.ID, ttl)
+		return err
+	})
+	if err != nil {
+		return domain.Session{}, "", err
+	}
+	if reused {
+		return domain.Session{}, "", ErrRefreshTokenReused
+	}
+	return session, next, nil
+}
+
+func (r *SessionDBRepository) GetSession(ctx context.Context, id string) (domain.Session, error) {
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT id, user_id, created_at, IFNULL(revoked_at, '') FROM sessions WHERE id = ?", id)
+
+	var session domain.Session
+	return session, row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt)
+}
+
+func (r *SessionDBRepository) RevokeSession(ctx context.Context, id string) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE sessions SET revoked_at = IFNULL(revoked_at, DATETIME('now', 'localtime')) WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUserSessions logs the user out everywhere.
+func (r *SessionDBRepository) RevokeUserSessions(ctx context.Context, userID int64) error {
+	_, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE sessions SET revoked_at = DATETIME('now', 'localtime') WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+func (r *SessionDBRepository) addRefreshToken(ctx context.Context, sessionID string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES (?, ?, DATETIME('now', 'localtime', ?))",
+		hashToken(token), sessionID, fmt.Sprintf("+%d seconds", int64(ttl.Seconds()))); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored, so a leaked database cannot be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
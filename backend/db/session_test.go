@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../sql/01_schema.sql")
+	if err != nil {
+		t.Fatalf("failed os.ReadFile: %s", err.Error())
+	}
+	// the session tables only, items_fts needs the sqlite_fts5 tag
+	start := bytes.Index(schema, []byte("CREATE TABLE IF NOT EXISTS sessions"))
+	if start < 0 {
+		t.Fatalf("the sessions table is missing from the schema")
+	}
+	if _, err := sqlDB.Exec(string(schema[start:])); err != nil {
+		t.Fatalf("failed to create the tables: %s", err.Error())
+	}
+
+	repo := NewSessionRepository(sqlDB)
+	session, first, err := repo.AddSession(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddSession: %s", err.Error())
+	}
+
+	rotated, second, err := repo.RotateRefreshToken(ctx, first, time.Hour)
+	if err != nil {
+		t.Fatalf("failed RotateRefreshToken: %s", err.Error())
+	}
+	if rotated.ID != session.ID || rotated.UserID != 1 || second == first {
+		t.Fatalf("unexpected rotation: %+v, %s", rotated, second)
+	}
+	if _, _, err := repo.RotateRefreshToken(ctx, "unknown", time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error for an unknown token: %v", err)
+	}
+
+	// the first token comes back after it was rotated
+	if _, _, err := repo.RotateRefreshToken(ctx, first, time.Hour); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("unexpected error for a reused token: %v", err)
+	}
+	if got, err := repo.GetSession(ctx, session.ID); err != nil || !got.IsRevoked() {
+		t.Fatalf("the session is not revoked: %+v, %v", got, err)
+	}
+	if _, _, err := repo.RotateRefreshToken(ctx, second, time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error for a token of a revoked session: %v", err)
+	}
+
+	expired, third, err := repo.AddSession(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddSession: %s", err.Error())
+	}
+	if _, err := sqlDB.Exec("UPDATE refresh_tokens SET expires_at = DATETIME('now', 'localtime', '-1 seconds') WHERE session_id = ?", expired.ID); err != nil {
+		t.Fatalf("failed to expire the token: %s", err.Error())
+	}
+	if _, _, err := repo.RotateRefreshToken(ctx, third, time.Hour); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error for an expired token: %v", err)
+	}
+
+	other, _, err := repo.AddSession(ctx, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("failed AddSession: %s", err.Error())
+	}
+	if err := repo.RevokeUserSessions(ctx, 1); err != nil {
+		t.Fatalf("failed RevokeUserSessions: %s", err.Error())
+	}
+	if got, err := repo.GetSession(ctx, expired.ID); err != nil || !got.IsRevoked() {
+		t.Fatalf("the session of user 1 is not revoked: %+v, %v", got, err)
+	}
+	if got, err := repo.GetSession(ctx, other.ID); err != nil || got.IsRevoked() {
+		t.Fatalf("the session of user 2 is revoked: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,128 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	// ErrTOTPEnabled is returned when enrolling a user who already has an authenticator.
+	ErrTOTPEnabled = newError(ErrConflict, "totp_enabled", "two-factor authentication is already enabled")
+	// ErrTOTPCodeUsed is returned for a code of a time step that was already used.
+	ErrTOTPCodeUsed = newError(ErrUnauthorized, "totp_code_used", "the code has already been used")
+	// ErrInvalidRecoveryCode is returned for unknown and used recovery codes.
+	ErrInvalidRecoveryCode = newError(ErrUnauthorized, "invalid_recovery_code", "recovery code is invalid or used")
+)
+
+type TOTPRepository interface {
+	// SetPendingTOTP stores a new secret to be confirmed, replacing the pending one.
+	SetPendingTOTP(ctx context.Context, userID int64, secret string) error
+	GetTOTP(ctx context.Context, userID int64) (domain.TOTP, error)
+	// EnableTOTP enables the pending authenticator confirmed with the code of step,
+	// replacing the recovery codes.
+	EnableTOTP(ctx context.Context, userID, step int64, recoveryCodes []string) error
+	// UseTOTPStep accepts the code of step once, and none of an earlier step after it.
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	// DeleteTOTP turns two-factor authentication off and deletes the recovery codes.
+	DeleteTOTP(ctx context.Context, userID int64) error
+}
+
+type TOTPDBRepository struct {
+	*sql.DB
+}
+
+func NewTOTPRepository(db *sql.DB) TOTPRepository {
+	return &TOTPDBRepository{DB: db}
+}
+
+func (r *TOTPDBRepository) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, `INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret WHERE enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (r *TOTPDBRepository) GetTOTP(ctx context.Context, userID int64) (domain.TOTP, error) {
+	row := conn(ctx, r.DB).QueryRowContext(ctx, "SELECT user_id, secret, IFNULL(enabled_at, ''), last_used_step FROM user_totp WHERE user_id = ?", userID)
+
+	var totp domain.TOTP
+	return totp, row.Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastUsedStep)
+}
+
+func (r *TOTPDBRepository) EnableTOTP(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE user_totp SET enabled_at = DATETIME('now', 'localtime'), last_used_step = ? WHERE user_id = ? AND enabled_at IS NULL", step, userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrTOTPEnabled
+		}
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		for _, code := range recoveryCodes {
+			if _, err := conn(ctx, r.DB).ExecContext(ctx, "INSERT INTO recovery_codes (code_hash, user_id) VALUES (?, ?)", hashToken(code), userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *TOTPDBRepository) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+func (r *TOTPDBRepository) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	res, err := conn(ctx, r.DB).ExecContext(ctx, "UPDATE recovery_codes SET used_at = DATETIME('now', 'localtime') WHERE code_hash = ? AND user_id = ? AND used_at IS NULL", hashToken(code), userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
+
+func (r *TOTPDBRepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	return NewTransactor(r.DB).Transaction(ctx, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.DB).ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ?", userID)
+		return err
+	})
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTOTPRepository(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../sql/01_schema.sql")
+	if err != nil {
+		t.Fatalf("failed os.ReadFile: %s", err.Error())
+	}
+	start := bytes.Index(schema, []byte("CREATE TABLE IF NOT EXISTS user_totp"))
+	if start < 0 {
+		t.Fatalf("the user_totp table is missing from the schema")
+	}
+	if _, err := sqlDB.Exec(string(schema[start:])); err != nil {
+		t.Fatalf("failed to create the tables: %s", err.Error())
+	}
+
+	repo := NewTOTPRepository(sqlDB)
+	// enrolling again before confirming replaces the secret
+	for _, secret := range []string{"FIRST", "SECOND"} {
+		if err := repo.SetPendingTOTP(ctx, 1, secret); err != nil {
+			t.Fatalf("failed SetPendingTOTP: %s", err.Error())
+		}
+	}
+	if totp, err := repo.GetTOTP(ctx, 1); err != nil || totp.Secret != "SECOND" || totp.IsEnabled() {
+		t.Fatalf("unexpected pending authenticator: %+v, %v", totp, err)
+	}
+
+	if err := repo.EnableTOTP(ctx, 1, 100, []string{"code1", "code2"}); err != nil {
+		t.Fatalf("failed EnableTOTP: %s", err.Error())
+	}
+	if err := repo.SetPendingTOTP(ctx, 1, "THIRD"); !errors.Is(err, ErrTOTPEnabled) {
+		t.Fatalf("unexpected error for enrolling again: %v", err)
+	}
+	if totp, err := repo.GetTOTP(ctx, 1); err != nil || totp.Secret != "SECOND" || !totp.IsEnabled() || totp.LastUsedStep != 100 {
+		t.Fatalf("unexpected authenticator: %+v, %v", totp, err)
+	}
+
+	// the step of the confirmation, and earlier ones, cannot be used again
+	for step, wantErr := range map[int64]error{99: ErrTOTPCodeUsed, 100: ErrTOTPCodeUsed, 101: nil} {
+		if err := repo.UseTOTPStep(ctx, 1, step); !errors.Is(err, wantErr) {
+			t.Fatalf("unexpected error for step %d: %v", step, err)
+		}
+	}
+
+	if err := repo.UseRecoveryCode(ctx, 1, "code1"); err != nil {
+		t.Fatalf("failed UseRecoveryCode: %s", err.Error())
+	}
+	if err := repo.UseRecoveryCode(ctx, 1, "code1"); !errors.Is(err, ErrInvalidRecoveryCode) {
+		t.Fatalf("unexpected error for a used code: %v", err)
+	}
+	if err := repo.UseRecoveryCode(ctx, 2, "code2"); !errors.Is(err, ErrInvalidRecoveryCode) {
+		t.Fatalf("unexpected error for the code of another user: %v", err)
+	}
+
+	if err := repo.DeleteTOTP(ctx, 1); err != nil {
+		t.Fatalf("failed DeleteTOTP: %s", err.Error())
+	}
+	if _, err := repo.GetTOTP(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("unexpected error after DeleteTOTP: %v", err)
+	}
+	if err := repo.UseRecoveryCode(ctx, 1, "code2"); !errors.Is(err, ErrInvalidRecoveryCode) {
+		t.Fatalf("unexpected error for a code after DeleteTOTP: %v", err)
+	}
+}
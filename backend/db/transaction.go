@@ -0,0 +1,67 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// Transactor runs a unit of work in a single database transaction.
+// Repositories called with the context passed to fn join that transaction.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+type DBTransactor struct {
+	*sql.DB
+}
+
+func NewTransactor(db *sql.DB) Transactor {
+	return &DBTransactor{DB: db}
+}
+
+func (t *DBTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	// join the outer transaction if there is one
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("failed tx.Rollback: %s", err.Error())
+			}
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("failed tx.Rollback: %s", rbErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// executor is satisfied by both *sql.DB and *sql.Tx.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction bound to ctx, or db when there is none.
+func conn(ctx context.Context, db *sql.DB) executor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+func TestUniqueUserNames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	// users 2 and 3 were registered before names had to be unique
+	if _, err := sqlDB.Exec(`CREATE TABLE users (id integer primary key autoincrement, name varchar(50), password binary(60), balance integer default 0, email text, role text NOT NULL DEFAULT 'user');
+		INSERT INTO users (id, name, password) VALUES (1, 'alice', ''), (2, 'Alice', ''), (3, 'alice', ''), (4, 'bob', '');`); err != nil {
+		t.Fatalf("failed to create the table: %s", err.Error())
+	}
+
+	if err := uniqueUserNames(ctx, sqlDB); err != nil {
+		t.Fatalf("failed uniqueUserNames: %s", err.Error())
+	}
+	// it runs on every start
+	if err := uniqueUserNames(ctx, sqlDB); err != nil {
+		t.Fatalf("failed uniqueUserNames again: %s", err.Error())
+	}
+
+	repo := NewUserRepository(sqlDB)
+	for id, want := range map[int64]string{1: "alice", 2: "Alice#2", 3: "alice#3", 4: "bob"} {
+		user, err := repo.GetUser(ctx, id)
+		if err != nil {
+			t.Fatalf("failed GetUser: %s", err.Error())
+		}
+		if user.Name != want {
+			t.Fatalf("unexpected name of user %d: want: %s, got: %s", id, want, user.Name)
+		}
+	}
+
+	if _, err := repo.AddUser(ctx, domain.User{Name: "BOB"}); !errors.Is(err, ErrUserNameTaken) {
+		t.Fatalf("unexpected error: want: %v, got: %v", ErrUserNameTaken, err)
+	}
+	id, err := repo.AddUser(ctx, domain.User{Name: "carol"})
+	if err != nil {
+		t.Fatalf("failed AddUser: %s", err.Error())
+	}
+	user, err := repo.GetUserByName(ctx, "CAROL")
+	if err != nil {
+		t.Fatalf("failed GetUserByName: %s", err.Error())
+	}
+	if user.ID != id {
+		t.Fatalf("unexpected user: want: %d, got: %d", id, user.ID)
+	}
+
+	// users without an email do not conflict, the others do ignoring case
+	id, err = repo.AddUser(ctx, domain.User{Name: "dave", Email: "dave@example.com"})
+	if err != nil {
+		t.Fatalf("failed AddUser: %s", err.Error())
+	}
+	if _, err := repo.AddUser(ctx, domain.User{Name: "eve", Email: "Dave@Example.com"}); !errors.Is(err, ErrUserEmailTaken) {
+		t.Fatalf("unexpected error: want: %v, got: %v", ErrUserEmailTaken, err)
+	}
+	if user, err := repo.GetUserByEmail(ctx, "DAVE@example.com"); err != nil || user.ID != id {
+		t.Fatalf("unexpected user by email: %+v, %v", user, err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	// users of the seed data get the role column from the migration
+	if _, err := sqlDB.Exec(`CREATE TABLE users (id integer primary key autoincrement, name varchar(50), password binary(60), balance integer default 0);
+		INSERT INTO users (id, name, password) VALUES (1, 'alice', '');`); err != nil {
+		t.Fatalf("failed to create the table: %s", err.Error())
+	}
+	for _, column := range []string{"email text", "role text NOT NULL DEFAULT 'user'"} {
+		if _, err := sqlDB.Exec("ALTER TABLE users ADD COLUMN " + column); err != nil {
+			t.Fatalf("failed to add the column: %s", err.Error())
+		}
+	}
+
+	repo := NewUserRepository(sqlDB)
+	if user, err := repo.GetUser(ctx, 1); err != nil || user.Role != domain.RoleUser {
+		t.Fatalf("unexpected user: %+v, %v", user, err)
+	}
+	if err := repo.SetUserRole(ctx, 1, domain.RoleModerator); err != nil {
+		t.Fatalf("failed SetUserRole: %s", err.Error())
+	}
+	if user, err := repo.GetUser(ctx, 1); err != nil || user.Role != domain.RoleModerator {
+		t.Fatalf("unexpected user: %+v, %v", user, err)
+	}
+	if err := repo.SetUserRole(ctx, 2, domain.RoleAdmin); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("unexpected error for an unknown user: %v", err)
+	}
+}
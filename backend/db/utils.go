@@ -47,6 +47,15 @@ func Initialize(ctx context.Context, db *sql.DB) error {
 		}
 	}
 
+	if err := Migrate(ctx, db); err != nil {
+		return errors.Wrap(err, "Failed to migrate")
+	}
+
+	// seed balances are not in the ledger yet
+	if _, err := ReconcileBalances(ctx, db); err != nil {
+		return errors.Wrap(err, "Failed to reconcile balances")
+	}
+
 	return nil
 }
 
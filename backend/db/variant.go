@@ -0,0 +1,108 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const variantJPEGQuality = 85
+
+// variantPrefix starts the key of every cached variant.
+const variantPrefix = "variants/"
+
+// variantKey is where the resized copy of the blob under key is cached.
+func variantKey(key string, width int) string {
+	return fmt.Sprintf("%s%d/%s", variantPrefix, width, key)
+}
+
+// OpenItemImage opens img, or its variant scaled down to fit in width x width when width is not 0.
+// The variant is made on the first request and kept in the blob store.
+// Images already small enough are opened as they are.
+func (r *ItemDBRepository) OpenItemImage(ctx context.Context, img domain.ItemImage, width int) (io.ReadSeekCloser, error) {
+	if width == 0 {
+		return r.Blobs.Open(ctx, img.BlobKey)
+	}
+
+	cached, err := r.Blobs.Open(ctx, variantKey(img.BlobKey, width))
+	if !errors.Is(err, ErrBlobNotFound) {
+		return cached, err
+	}
+
+	data, err := r.Blobs.Get(ctx, img.BlobKey)
+	if err != nil {
+		return nil, err
+	}
+	// the header tells whether the image fits, so small images are served as stored without decoding them
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= width && cfg.Height <= width {
+		return nopCloser{bytes.NewReader(data)}, nil
+	}
+
+	variant, err := resizeImage(domain.ImageFile{ContentType: img.ContentType, Data: data}, width)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Blobs.Put(ctx, variantKey(img.BlobKey, width), variant.Data); err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(variant.Data)}, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// deleteImageBlobs removes an image with its cached variants.
+func (r *ItemDBRepository) deleteImageBlobs(ctx context.Context, key string) {
+	r.deleteBlob(ctx, key)
+	for _, width := range domain.ImageVariantWidths {
+		r.deleteBlob(ctx, variantKey(key, width))
+	}
+}
+
+// resizeImage scales img down to fit in width x width, keeping the aspect ratio.
+func resizeImage(img domain.ImageFile, width int) (domain.ImageFile, error) {
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return domain.ImageFile{}, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		w, h = width, (h*width+w-1)/w
+	} else {
+		w, h = (w*width+h-1)/h, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	// keep the transparency of PNG and WebP
+	if o, ok := src.(interface{ Opaque() bool }); img.ContentType == "image/png" || (ok && !o.Opaque()) {
+		contentType = "image/png"
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: variantJPEGQuality})
+	}
+	if err != nil {
+		return domain.ImageFile{}, err
+	}
+	return domain.ImageFile{ContentType: contentType, Data: buf.Bytes()}, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+func TestOpenItemImage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed sql.Open: %s", err.Error())
+	}
+	defer sqlDB.Close()
+	// one connection, since every connection to :memory: is a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	if _, err := sqlDB.Exec(`CREATE TABLE item_images (id integer primary key, item_id integer, blob_key text, content_type text, position integer, created_at text, updated_at text);
+		INSERT INTO item_images VALUES (1, 1, 'items/1/a.jpg', 'image/jpeg', 0, '', '');`); err != nil {
+		t.Fatalf("failed to create item_images: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 800, 400)), nil); err != nil {
+		t.Fatalf("failed jpeg.Encode: %s", err.Error())
+	}
+	blobs := NewLocalBlobStore(t.TempDir())
+	if err := blobs.Put(ctx, "items/1/a.jpg", buf.Bytes()); err != nil {
+		t.Fatalf("failed Put: %s", err.Error())
+	}
+	r := &ItemDBRepository{DB: sqlDB, Blobs: blobs}
+
+	img, err := r.GetItemImageInfo(ctx, 1, 0)
+	if err != nil {
+		t.Fatalf("failed GetItemImageInfo: %s", err.Error())
+	}
+	read := func(width int) []byte {
+		t.Helper()
+		f, err := r.OpenItemImage(ctx, img, width)
+		if err != nil {
+			t.Fatalf("failed OpenItemImage: %s", err.Error())
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("failed io.ReadAll: %s", err.Error())
+		}
+		return data
+	}
+
+	variant := read(400)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(variant))
+	if err != nil || cfg.Width != 400 || cfg.Height != 200 {
+		t.Fatalf("unexpected variant: %dx%d, %v", cfg.Width, cfg.Height, err)
+	}
+	cached, err := blobs.Get(ctx, variantKey("items/1/a.jpg", 400))
+	if err != nil || !bytes.Equal(cached, variant) {
+		t.Fatalf("the variant is not cached: %v", err)
+	}
+	if !bytes.Equal(read(400), variant) {
+		t.Fatalf("unexpected variant from the cache")
+	}
+
+	// not scaled up, nor cached
+	if !bytes.Equal(read(1024), buf.Bytes()) {
+		t.Fatalf("want the original image")
+	}
+	if _, err := blobs.Get(ctx, variantKey("items/1/a.jpg", 1024)); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("unexpected cache of the original: %v", err)
+	}
+
+	// small images are not decoded: only the header of this one is readable
+	truncated := buf.Bytes()[:buf.Len()/2]
+	if err := blobs.Put(ctx, "items/1/b.jpg", truncated); err != nil {
+		t.Fatalf("failed Put: %s", err.Error())
+	}
+	f, err := r.OpenItemImage(ctx, domain.ItemImage{BlobKey: "items/1/b.jpg", ContentType: "image/jpeg"}, 1024)
+	if err != nil {
+		t.Fatalf("failed OpenItemImage: %s", err.Error())
+	}
+	defer f.Close()
+	if data, err := io.ReadAll(f); err != nil || !bytes.Equal(data, truncated) {
+		t.Fatalf("want the stored image: %v", err)
+	}
+
+	r.deleteImageBlobs(ctx, "items/1/a.jpg")
+	if _, err := blobs.Get(ctx, variantKey("items/1/a.jpg", 400)); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("the variant is left after the image is deleted: %v", err)
+	}
+
+	if _, err := r.GetItemImageInfo(ctx, 1, 1); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("unexpected error for a missing image: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package domain
+
+type Category struct {
+	ID   int64
+	Name string
+	// ParentID is 0 for a root category.
+	ParentID  int64
+	SortOrder int64
+	// RetiredAt is empty while the category can be used for new listings.
+	RetiredAt string
+	// UpdatedAt is when the name or parent last changed, empty if never.
+	UpdatedAt string
+}
+
+func (c Category) IsRetired() bool {
+	return c.RetiredAt != ""
+}
+
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode
+}
+
+// BuildCategoryTree nests cats under their parents, keeping the order of cats.
+// A category whose parent is missing becomes a root.
+func BuildCategoryTree(cats []Category) []*CategoryNode {
+	nodes := make(map[int64]*CategoryNode, len(cats))
+	for _, cat := range cats {
+		nodes[cat.ID] = &CategoryNode{Category: cat}
+	}
+
+	var roots []*CategoryNode
+	for _, cat := range cats {
+		node := nodes[cat.ID]
+		parent, ok := nodes[cat.ParentID]
+		if !ok || cat.ParentID == cat.ID {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return roots
+}
+
+// CategoryPath returns the categories from the root down to id.
+func CategoryPath(cats []Category, id int64) []Category {
+	byID := make(map[int64]Category, len(cats))
+	for _, cat := range cats {
+		byID[cat.ID] = cat
+	}
+
+	var path []Category
+	seen := make(map[int64]bool)
+	for cat, ok := byID[id]; ok && !seen[cat.ID]; cat, ok = byID[cat.ParentID] {
+		seen[cat.ID] = true
+		path = append([]Category{cat}, path...)
+	}
+	return path
+}
+
+// IsRetiredPath reports whether any category on path is retired.
+// Retiring a category retires everything below it.
+func IsRetiredPath(path []Category) bool {
+	for _, cat := range path {
+		if cat.IsRetired() {
+			return true
+		}
+	}
+	return false
+}
+
+// DescendantCategoryIDs returns id followed by the ids of every category below it.
+func DescendantCategoryIDs(cats []Category, id int64) []int64 {
+	children := make(map[int64][]int64)
+	for _, cat := range cats {
+		if cat.ParentID != cat.ID {
+			children[cat.ParentID] = append(children[cat.ParentID], cat.ID)
+		}
+	}
+
+	ids := []int64{id}
+	seen := map[int64]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
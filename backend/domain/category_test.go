@@ -0,0 +1,111 @@
+package domain_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+var testCategories = []domain.Category{
+	{ID: 1, Name: "fashion"},
+	{ID: 2, Name: "tops", ParentID: 1},
+	{ID: 3, Name: "t-shirts", ParentID: 2},
+	{ID: 4, Name: "shoes", ParentID: 1},
+	{ID: 5, Name: "food"},
+}
+
+func TestCategoryPath(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		id   int64
+		want []int64
+	}{
+		"root":       {id: 1, want: []int64{1}},
+		"leaf":       {id: 3, want: []int64{1, 2, 3}},
+		"not found":  {id: 9, want: nil},
+		"other root": {id: 5, want: []int64{5}},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []int64
+			for _, cat := range domain.CategoryPath(testCategories, tt.id) {
+				got = append(got, cat.ID)
+			}
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Fatalf("unexpected path: want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCategoryPathStopsOnCycle(t *testing.T) {
+	t.Parallel()
+
+	cats := []domain.Category{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 1}}
+	if got := domain.CategoryPath(cats, 1); len(got) != 2 {
+		t.Fatalf("unexpected path length: want: 2, got: %d", len(got))
+	}
+}
+
+func TestIsRetiredPath(t *testing.T) {
+	t.Parallel()
+
+	cats := []domain.Category{
+		{ID: 1, Name: "fashion", RetiredAt: "2023-06-01 00:00:00"},
+		{ID: 2, Name: "tops", ParentID: 1},
+		{ID: 3, Name: "food"},
+	}
+	if !domain.IsRetiredPath(domain.CategoryPath(cats, 2)) {
+		t.Fatalf("child of a retired category: want retired")
+	}
+	if domain.IsRetiredPath(domain.CategoryPath(cats, 3)) {
+		t.Fatalf("category without a retired ancestor: want not retired")
+	}
+}
+
+func TestDescendantCategoryIDs(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		id   int64
+		want []int64
+	}{
+		"whole subtree": {id: 1, want: []int64{1, 2, 4, 3}},
+		"middle":        {id: 2, want: []int64{2, 3}},
+		"leaf":          {id: 3, want: []int64{3}},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := domain.DescendantCategoryIDs(testCategories, tt.id)
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Fatalf("unexpected ids: want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	t.Parallel()
+
+	roots := domain.BuildCategoryTree(testCategories)
+	if len(roots) != 2 || roots[0].ID != 1 || roots[1].ID != 5 {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	fashion := roots[0]
+	if len(fashion.Children) != 2 || fashion.Children[0].ID != 2 || fashion.Children[1].ID != 4 {
+		t.Fatalf("unexpected children: %+v", fashion.Children)
+	}
+	if len(fashion.Children[0].Children) != 1 || fashion.Children[0].Children[0].ID != 3 {
+		t.Fatalf("unexpected grandchildren: %+v", fashion.Children[0].Children)
+	}
+}
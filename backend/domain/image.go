@@ -0,0 +1,25 @@
+package domain
+
+// MaxItemImages is how many images an item can have.
+const MaxItemImages = 10
+
+// ImageVariantWidths are the sizes images are served scaled down to, in pixels on the longer side.
+var ImageVariantWidths = []int{150, 400, 1024}
+
+// ItemImage is one image of an item. The image at Position 0 is the cover.
+type ItemImage struct {
+	ID          int64
+	ItemID      int64
+	BlobKey     string
+	ContentType string
+	Position    int64
+	CreatedAt   string
+	// UpdatedAt changes with the blob and the position, which is what the image URLs show.
+	UpdatedAt string
+}
+
+// ImageFile is the content of an image with its MIME type.
+type ImageFile struct {
+	ContentType string
+	Data        []byte
+}
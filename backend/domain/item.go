@@ -1,13 +1,97 @@
 package domain
 
+import "fmt"
+
 type ItemStatus int
 
 const (
 	ItemStatusInitial ItemStatus = iota
 	ItemStatusOnSale
 	ItemStatusSoldOut
+	// ItemStatusPaused is temporarily hidden from the listing by the seller.
+	ItemStatusPaused
+	// ItemStatusWithdrawn is taken off the market by the seller.
+	ItemStatusWithdrawn
+)
+
+func (s ItemStatus) String() string {
+	switch s {
+	case ItemStatusInitial:
+		return "initial"
+	case ItemStatusOnSale:
+		return "on_sale"
+	case ItemStatusSoldOut:
+		return "sold_out"
+	case ItemStatusPaused:
+		return "paused"
+	case ItemStatusWithdrawn:
+		return "withdrawn"
+	}
+	return fmt.Sprintf("ItemStatus(%d)", int(s))
+}
+
+// ItemEvent is what moves an item from one status to another. Who may move an item
+// depends on the event: the seller sells, pauses, withdraws and relists, a buyer
+// purchases, and only a cancelled order puts a sold item back on sale.
+type ItemEvent int
+
+const (
+	ItemEventSell ItemEvent = iota
+	ItemEventPause
+	ItemEventWithdraw
+	ItemEventRelist
+	ItemEventPurchase
+	ItemEventCancelOrder
 )
 
+type itemTransition struct {
+	from []ItemStatus
+	to   ItemStatus
+}
+
+// itemTransitions lists the statuses each event moves an item from, and where to.
+var itemTransitions = map[ItemEvent]itemTransition{
+	// only a draft is sold; relisting goes through ItemEventRelist
+	ItemEventSell:        {from: []ItemStatus{ItemStatusInitial}, to: ItemStatusOnSale},
+	ItemEventPause:       {from: []ItemStatus{ItemStatusOnSale}, to: ItemStatusPaused},
+	ItemEventWithdraw:    {from: []ItemStatus{ItemStatusInitial, ItemStatusOnSale, ItemStatusPaused}, to: ItemStatusWithdrawn},
+	ItemEventRelist:      {from: []ItemStatus{ItemStatusPaused, ItemStatusWithdrawn}, to: ItemStatusOnSale},
+	ItemEventPurchase:    {from: []ItemStatus{ItemStatusOnSale}, to: ItemStatusSoldOut},
+	ItemEventCancelOrder: {from: []ItemStatus{ItemStatusSoldOut}, to: ItemStatusOnSale},
+}
+
+// ItemStatusTransitionError is returned for a transition the state machine does not allow.
+type ItemStatusTransitionError struct {
+	From ItemStatus
+	To   ItemStatus
+}
+
+func (e *ItemStatusTransitionError) Error() string {
+	return fmt.Sprintf("item cannot change from %s to %s", e.From, e.To)
+}
+
+// Apply returns the status e moves s to, or an *ItemStatusTransitionError when e
+// cannot happen to an item in s.
+func (s ItemStatus) Apply(e ItemEvent) (ItemStatus, error) {
+	t := itemTransitions[e]
+	for _, from := range t.from {
+		if from == s {
+			return t.to, nil
+		}
+	}
+	return s, &ItemStatusTransitionError{From: s, To: t.to}
+}
+
+// Editable reports whether the seller can still edit an item in s. Sold and withdrawn
+// items are kept as they were.
+func (s ItemStatus) Editable() bool {
+	switch s {
+	case ItemStatusInitial, ItemStatusOnSale, ItemStatusPaused:
+		return true
+	}
+	return false
+}
+
 type Item struct {
 	ID          int64
 	Name        string
@@ -16,25 +100,29 @@ type Item struct {
 	CategoryID  int64
 	UserID      int64
 	Image       []byte
-	Status      ItemStatus
-	CreatedAt   string
-	UpdatedAt   string
+	// ImageContentType is the MIME type of Image.
+	ImageContentType string
+	Status           ItemStatus
+	CreatedAt        string
+	UpdatedAt        string
 }
 
 type GetItemResponse struct {
-	ID           int64      `json:"id"`
-	Name         string     `json:"name"`
-	CategoryID   int64      `json:"category_id"`
-	CategoryName string     `json:"category_name"`
-	UserID       int64      `json:"user_id"`
-	Price        int64      `json:"price"`
-	Description  string     `json:"description"`
-	Status       ItemStatus `json:"status"`
-}
-
-type Category struct {
-	ID   int64
-	Name string
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	CategoryID   int64  `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	// CategoryPath is the breadcrumb from the root category down to CategoryID.
+	CategoryPath []CategoryPathEntry `json:"category_path,omitempty"`
+	UserID       int64               `json:"user_id"`
+	Price        int64               `json:"price"`
+	Description  string              `json:"description"`
+	Status       ItemStatus          `json:"status"`
+}
+
+type CategoryPathEntry struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
 }
 
 func (i *Item) ConvertToGetItemResponse() GetItemResponse {
@@ -0,0 +1,79 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/pkg/errors"
+)
+
+func TestItemStatusApply(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		from    domain.ItemStatus
+		event   domain.ItemEvent
+		want    domain.ItemStatus
+		wantErr bool
+	}{
+		"sell a draft":                 {from: domain.ItemStatusInitial, event: domain.ItemEventSell, want: domain.ItemStatusOnSale},
+		"purchase an item on sale":     {from: domain.ItemStatusOnSale, event: domain.ItemEventPurchase, want: domain.ItemStatusSoldOut},
+		"pause an item on sale":        {from: domain.ItemStatusOnSale, event: domain.ItemEventPause, want: domain.ItemStatusPaused},
+		"relist a paused item":         {from: domain.ItemStatusPaused, event: domain.ItemEventRelist, want: domain.ItemStatusOnSale},
+		"withdraw a draft":             {from: domain.ItemStatusInitial, event: domain.ItemEventWithdraw, want: domain.ItemStatusWithdrawn},
+		"withdraw a paused item":       {from: domain.ItemStatusPaused, event: domain.ItemEventWithdraw, want: domain.ItemStatusWithdrawn},
+		"relist a withdrawn item":      {from: domain.ItemStatusWithdrawn, event: domain.ItemEventRelist, want: domain.ItemStatusOnSale},
+		"cancel the order of an item":  {from: domain.ItemStatusSoldOut, event: domain.ItemEventCancelOrder, want: domain.ItemStatusOnSale},
+		"relist a sold item":           {from: domain.ItemStatusSoldOut, event: domain.ItemEventRelist, want: domain.ItemStatusOnSale, wantErr: true},
+		"sell a withdrawn item":        {from: domain.ItemStatusWithdrawn, event: domain.ItemEventSell, want: domain.ItemStatusOnSale, wantErr: true},
+		"relist a draft":               {from: domain.ItemStatusInitial, event: domain.ItemEventRelist, want: domain.ItemStatusOnSale, wantErr: true},
+		"purchase a draft":             {from: domain.ItemStatusInitial, event: domain.ItemEventPurchase, want: domain.ItemStatusSoldOut, wantErr: true},
+		"purchase a paused item":       {from: domain.ItemStatusPaused, event: domain.ItemEventPurchase, want: domain.ItemStatusSoldOut, wantErr: true},
+		"pause a draft":                {from: domain.ItemStatusInitial, event: domain.ItemEventPause, want: domain.ItemStatusPaused, wantErr: true},
+		"withdraw a sold item":         {from: domain.ItemStatusSoldOut, event: domain.ItemEventWithdraw, want: domain.ItemStatusWithdrawn, wantErr: true},
+		"sell an item already on sale": {from: domain.ItemStatusOnSale, event: domain.ItemEventSell, want: domain.ItemStatusOnSale, wantErr: true},
+		"cancel an item not sold":      {from: domain.ItemStatusPaused, event: domain.ItemEventCancelOrder, want: domain.ItemStatusOnSale, wantErr: true},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.from.Apply(tt.event)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if got != tt.want {
+					t.Fatalf("unexpected status: want: %s, got: %s", tt.want, got)
+				}
+				return
+			}
+			var transitionErr *domain.ItemStatusTransitionError
+			if !errors.As(err, &transitionErr) {
+				t.Fatalf("unexpected error: want: *domain.ItemStatusTransitionError, got: %v", err)
+			}
+			if transitionErr.From != tt.from || transitionErr.To != tt.want {
+				t.Fatalf("unexpected transition: want: %s -> %s, got: %s -> %s", tt.from, tt.want, transitionErr.From, transitionErr.To)
+			}
+		})
+	}
+}
+
+func TestItemStatusEditable(t *testing.T) {
+	t.Parallel()
+	cases := map[domain.ItemStatus]bool{
+		domain.ItemStatusInitial:   true,
+		domain.ItemStatusOnSale:    true,
+		domain.ItemStatusPaused:    true,
+		domain.ItemStatusSoldOut:   false,
+		domain.ItemStatusWithdrawn: false,
+	}
+
+	for status, want := range cases {
+		if got := status.Editable(); got != want {
+			t.Errorf("unexpected result of %s: want: %t, got: %t", status, want, got)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package domain
+
+type LedgerEntryType string
+
+const (
+	// LedgerEntryAdjustment reconciles a balance that was not recorded in the ledger.
+	LedgerEntryAdjustment LedgerEntryType = "adjustment"
+	LedgerEntryTopUp      LedgerEntryType = "top_up"
+	LedgerEntryPurchase   LedgerEntryType = "purchase"
+	LedgerEntrySale       LedgerEntryType = "sale"
+	LedgerEntryRefund     LedgerEntryType = "refund"
+	LedgerEntryFee        LedgerEntryType = "fee"
+)
+
+// LedgerEntry is one movement of a user's balance.
+// Amount is positive for credits and negative for debits.
+type LedgerEntry struct {
+	ID           int64
+	UserID       int64
+	Type         LedgerEntryType
+	Amount       int64
+	BalanceAfter int64
+	ItemID       int64
+	CreatedAt    string
+}
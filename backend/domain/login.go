@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+type LoginOutcome string
+
+const (
+	LoginSucceeded LoginOutcome = "success"
+	LoginFailed    LoginOutcome = "failure"
+	// LoginLocked is an attempt rejected without checking the password.
+	LoginLocked LoginOutcome = "locked"
+	// LoginChallenged is a right password of a user who still has to send a code of the authenticator.
+	LoginChallenged LoginOutcome = "challenged"
+)
+
+// LoginAttempt is a line of the login audit trail.
+type LoginAttempt struct {
+	ID int64
+	// UserID is 0 when no user has the name or id.
+	UserID int64
+	// Identifier is the name or the user id the client sent.
+	Identifier string
+	IP         string
+	Outcome    LoginOutcome
+	CreatedAt  string
+}
+
+// LoginThrottle is how failed logins of an account or a client are slowed down.
+type LoginThrottle struct {
+	// MaxFailures are allowed before the first lockout. 0 turns the throttle off.
+	MaxFailures int64
+	// Lockout is the first lockout. Every further failure doubles it, up to MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// Window is how long failures are remembered after the last one or the end of the lockout.
+	Window time.Duration
+}
+
+// LockoutAfter is how long the throttle locks out after the given number of failures in a row.
+func (t LoginThrottle) LockoutAfter(failures int64) time.Duration {
+	if t.MaxFailures <= 0 || failures < t.MaxFailures {
+		return 0
+	}
+	d := t.Lockout
+	for i := t.MaxFailures; i < failures && d < t.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > t.MaxLockout {
+		return t.MaxLockout
+	}
+	return d
+}
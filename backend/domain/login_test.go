@@ -0,0 +1,39 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestLoginThrottleLockoutAfter(t *testing.T) {
+	t.Parallel()
+	throttle := domain.LoginThrottle{MaxFailures: 5, Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	cases := map[string]struct {
+		throttle domain.LoginThrottle
+		failures int64
+		want     time.Duration
+	}{
+		"below the limit":  {throttle: throttle, failures: 4},
+		"at the limit":     {throttle: throttle, failures: 5, want: time.Minute},
+		"one more":         {throttle: throttle, failures: 6, want: 2 * time.Minute},
+		"two more":         {throttle: throttle, failures: 7, want: 4 * time.Minute},
+		"capped":           {throttle: throttle, failures: 9, want: 10 * time.Minute},
+		"far over the cap": {throttle: throttle, failures: 1000, want: 10 * time.Minute},
+		"turned off":       {throttle: domain.LoginThrottle{}, failures: 1000},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.throttle.LockoutAfter(tt.failures); got != tt.want {
+				t.Fatalf("unexpected lockout: want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
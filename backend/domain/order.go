@@ -0,0 +1,26 @@
+package domain
+
+type OrderStatus int
+
+const (
+	// OrderStatusReserved means the buyer has paid and the money is held in escrow.
+	OrderStatusReserved OrderStatus = iota
+	OrderStatusShipped
+	// OrderStatusDelivered means the seller has reported the item delivered.
+	OrderStatusDelivered
+	// OrderStatusCompleted means the escrow has been released to the seller.
+	OrderStatusCompleted
+	// OrderStatusCancelled means the escrow has been refunded to the buyer.
+	OrderStatusCancelled
+)
+
+type Order struct {
+	ID        int64
+	ItemID    int64
+	BuyerID   int64
+	SellerID  int64
+	Price     int64
+	Status    OrderStatus
+	CreatedAt string
+	UpdatedAt string
+}
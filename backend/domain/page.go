@@ -0,0 +1,15 @@
+package domain
+
+// PageRequest asks for up to Limit rows from the position in Cursor.
+// An empty Cursor starts at the first row.
+type PageRequest struct {
+	Limit  int64
+	Cursor string
+}
+
+// PageInfo holds opaque cursors to the neighbouring pages.
+// A cursor is empty when there is no page in that direction.
+type PageInfo struct {
+	NextCursor string
+	PrevCursor string
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"html"
+	"strings"
+)
+
+// Search results mark matched text with these control characters.
+// RenderHighlight turns them into HTML after escaping the item text.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+type ItemSearchResult struct {
+	Item
+	// NameHighlight is the item name with every match marked.
+	NameHighlight string
+	// Snippet is the part of the description around the best match.
+	Snippet string
+}
+
+// RenderHighlight escapes s and wraps the marked matches in <mark> tags.
+func RenderHighlight(s string) string {
+	return strings.NewReplacer(HighlightStart, "<mark>", HighlightEnd, "</mark>").Replace(html.EscapeString(s))
+}
+
+type ItemSearchSort string
+
+const (
+	// ItemSearchSortRelevance orders by match rank. Without a word, or with words too short
+	// for the full-text index, it lists the latest updated items first like GET /items.
+	ItemSearchSortRelevance ItemSearchSort = "relevance"
+	ItemSearchSortNewest    ItemSearchSort = "newest"
+	ItemSearchSortPriceAsc  ItemSearchSort = "price_asc"
+	ItemSearchSortPriceDesc ItemSearchSort = "price_desc"
+)
+
+func (s ItemSearchSort) IsValid() bool {
+	switch s {
+	case ItemSearchSortRelevance, ItemSearchSortNewest, ItemSearchSortPriceAsc, ItemSearchSortPriceDesc:
+		return true
+	}
+	return false
+}
+
+// SearchableItemStatuses are the only statuses anyone can search for, and the ones searched
+// when a query names none. Drafts and items their sellers took down are not found.
+var SearchableItemStatuses = []ItemStatus{ItemStatusOnSale, ItemStatusSoldOut}
+
+// IsSearchable reports whether items in s can be searched for.
+func (s ItemStatus) IsSearchable() bool {
+	for _, status := range SearchableItemStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemSearchQuery narrows a search. Zero values do not filter, except that no Statuses
+// means SearchableItemStatuses.
+type ItemSearchQuery struct {
+	Word string
+	// CategoryIDs should already include the subcategories.
+	CategoryIDs []int64
+	// MinPrice and MaxPrice are inclusive.
+	MinPrice *int64
+	MaxPrice *int64
+	Statuses []ItemStatus
+	SellerID int64
+	Sort     ItemSearchSort
+}
+
+// PriceBucketBounds split prices into the buckets counted by the price facet.
+var PriceBucketBounds = []int64{1000, 3000, 5000, 10000}
+
+type CategoryFacet struct {
+	CategoryID int64
+	Count      int64
+}
+
+type PriceFacet struct {
+	Min int64
+	// Max is exclusive. 0 means no upper bound.
+	Max   int64
+	Count int64
+}
+
+// SearchFacets counts the matching items per category and price bucket.
+// Each facet ignores its own filter, so the other choices stay visible.
+type SearchFacets struct {
+	Categories []CategoryFacet
+	Prices     []PriceFacet
+}
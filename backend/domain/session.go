@@ -0,0 +1,14 @@
+package domain
+
+// Session is a login. Its access tokens carry its ID, and it holds one usable refresh token at a time.
+type Session struct {
+	ID        string
+	UserID    int64
+	CreatedAt string
+	// RevokedAt is empty until the user logs out or the session is revoked otherwise.
+	RevokedAt string
+}
+
+func (s Session) IsRevoked() bool {
+	return s.RevokedAt != ""
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// TimeLayout is how the database stores times, in the local time zone.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// ParseTime reads a time stored in the database.
+func ParseTime(s string) (time.Time, error) {
+	return time.ParseInLocation(TimeLayout, s, time.Local)
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// TOTPDigits and TOTPPeriod are the defaults of authenticator apps, which some of them only support.
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// TOTPSkew is how many periods a code may be off, for clocks running a little late or early.
+	TOTPSkew = 1
+)
+
+// totpModulo is 10^TOTPDigits.
+const totpModulo = 1000000
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is the authenticator of a user. It is pending until the user confirms it with a code.
+type TOTP struct {
+	UserID int64
+	// Secret is base32 encoded, as authenticator apps take it.
+	Secret    string
+	EnabledAt string
+	// LastUsedStep is the time step of the last accepted code, which cannot be used again.
+	LastUsedStep int64
+}
+
+func (t TOTP) IsEnabled() bool {
+	return t.EnabledAt != ""
+}
+
+// NewTOTPSecret returns a random 160 bit secret, the size RFC 4226 recommends for SHA-1.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPStep is the time step of t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode is the code of the secret at the time step, as RFC 6238 computes it with SHA-1.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%totpModulo), nil
+}
+
+// MatchTOTP returns the time step the code is valid for around now, within TOTPSkew.
+func MatchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := TOTPStep(now)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		want, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI is the otpauth URI authenticator apps read from a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(int64(TOTPPeriod/time.Second)))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
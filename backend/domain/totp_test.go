@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+	// the last 6 of the 8 digits in RFC 6238 Appendix B
+	cases := map[string]struct {
+		unix int64
+		want string
+	}{
+		"59":          {unix: 59, want: "287082"},
+		"1111111109":  {unix: 1111111109, want: "081804"},
+		"1111111111":  {unix: 1111111111, want: "050471"},
+		"1234567890":  {unix: 1234567890, want: "005924"},
+		"2000000000":  {unix: 2000000000, want: "279037"},
+		"20000000000": {unix: 20000000000, want: "353130"},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := domain.TOTPCode(rfcSecret, domain.TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatalf("failed TOTPCode: %s", err.Error())
+			}
+			if got != tt.want {
+				t.Fatalf("unexpected code: want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1111111111, 0)
+	step := domain.TOTPStep(now)
+
+	for offset, wantOK := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, err := domain.TOTPCode(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatalf("failed TOTPCode: %s", err.Error())
+		}
+		got, ok := domain.MatchTOTP(rfcSecret, code, now)
+		if ok != wantOK || (ok && got != step+offset) {
+			t.Fatalf("unexpected match of the code %d steps off: %d, %v", offset, got, ok)
+		}
+	}
+
+	uri := domain.TOTPProvisioningURI("Mercari", "alice", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Mercari:alice?") || !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Fatalf("unexpected provisioning URI: %s", uri)
+	}
+}
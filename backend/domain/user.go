@@ -1,8 +1,33 @@
 package domain
 
+// Role is what a user may do besides using the market. Each role has every permission of the ones below it.
+type Role string
+
+const (
+	RoleUser Role = "user"
+	// RoleModerator manages the categories.
+	RoleModerator Role = "moderator"
+	// RoleAdmin also resets the data, reads the access log and gives roles.
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleUser: 1, RoleModerator: 2, RoleAdmin: 3}
+
+func (r Role) IsValid() bool {
+	return roleRanks[r] > 0
+}
+
+// Includes tells whether r has every permission of other. Unknown roles include none, and are included by none.
+func (r Role) Includes(other Role) bool {
+	return r.IsValid() && other.IsValid() && roleRanks[r] >= roleRanks[other]
+}
+
 type User struct {
 	ID       int64
 	Password string
 	Name     string
 	Balance  int64
+	// Email is where password reset links are sent. It is empty for users who did not give one.
+	Email string
+	Role  Role
 }
@@ -0,0 +1,36 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		role     domain.Role
+		required domain.Role
+		want     bool
+	}{
+		"same role":              {role: domain.RoleModerator, required: domain.RoleModerator, want: true},
+		"admin over moderator":   {role: domain.RoleAdmin, required: domain.RoleModerator, want: true},
+		"user under moderator":   {role: domain.RoleUser, required: domain.RoleModerator},
+		"moderator under admin":  {role: domain.RoleModerator, required: domain.RoleAdmin},
+		"no role, as old tokens": {role: "", required: domain.RoleUser},
+		"unknown role":           {role: "root", required: domain.RoleUser},
+		"unknown required role":  {role: domain.RoleAdmin, required: "root"},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.role.Includes(tt.required); got != tt.want {
+				t.Fatalf("unexpected result: want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// errNotItemOwner is the response for every mutation of an item listed by someone else.
+var errNotItemOwner = echo.NewHTTPError(http.StatusForbidden, "you are not the owner of this item")
+
+// authorizeItemOwner returns the item when it was listed by userID.
+// It answers 404 for a missing item and 403 for someone else's item.
+// Only the row is read, so an item whose image blob is missing can still be changed.
+func (h *Handler) authorizeItemOwner(ctx context.Context, userID, itemID int64) (domain.Item, error) {
+	item, err := h.ItemRepo.GetItemWithoutImage(ctx, itemID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, "item not found")
+		}
+		return domain.Item{}, toHTTPError(err)
+	}
+	if item.UserID != userID {
+		return domain.Item{}, errNotItemOwner
+	}
+	return item, nil
+}
+
+// RequireRole only lets users whose token carries role, or a role above it, through.
+// Tokens issued before roles carry none and are denied.
+func (h *Handler) RequireRole(role domain.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+			}
+			claims, ok := token.Claims.(*JwtCustomClaims)
+			if !ok || claims.UserID < 0 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+			}
+			if !claims.Role.Includes(role) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("%s only", role))
+			}
+			return next(c)
+		}
+	}
+}
+
+type setUserRoleRequest struct {
+	Role domain.Role `json:"role" validate:"required"`
+}
+
+// SetUserRole gives the user a role. Their sessions are revoked, since their tokens carry the old one.
+func (h *Handler) SetUserRole(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid userID type")
+	}
+
+	req := new(setUserRoleRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+	if !req.Role.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, validationErrorResponse{Message: "validation failed", Errors: []fieldError{
+			{Field: "role", Rule: "oneof", Param: fmt.Sprintf("%s %s %s", domain.RoleUser, domain.RoleModerator, domain.RoleAdmin)},
+		}})
+	}
+
+	adminID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	// so that there is always an admin left
+	if userID == adminID {
+		return echo.NewHTTPError(http.StatusBadRequest, "you cannot change your own role")
+	}
+
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := h.UserRepo.SetUserRole(ctx, userID, req.Role); err != nil {
+			return err
+		}
+		return h.SessionRepo.RevokeUserSessions(ctx, userID)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GrantAdminRoles makes the users in AdminUserIDs admins, so that someone can give roles
+// on a new database and after Initialize. Ids no user has are skipped.
+func (h *Handler) GrantAdminRoles(ctx context.Context) error {
+	for _, id := range h.AdminUserIDs {
+		if err := h.UserRepo.SetUserRole(ctx, id, domain.RoleAdmin); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Printf("no user %d of ADMIN_USER_IDS", id)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
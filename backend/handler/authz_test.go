@@ -0,0 +1,137 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequireRole(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		claims         *handler.JwtCustomClaims
+		required       domain.Role
+		wantStatusCode int
+	}{
+		"200: admin passes":              {claims: &handler.JwtCustomClaims{UserID: 1, Role: domain.RoleAdmin}, required: domain.RoleAdmin, wantStatusCode: http.StatusOK},
+		"200: admin passes as moderator": {claims: &handler.JwtCustomClaims{UserID: 1, Role: domain.RoleAdmin}, required: domain.RoleModerator, wantStatusCode: http.StatusOK},
+		"401: invalid user id":           {claims: &handler.JwtCustomClaims{UserID: -1, Role: domain.RoleAdmin}, required: domain.RoleAdmin, wantStatusCode: http.StatusUnauthorized},
+		"403: moderator is not admin":    {claims: &handler.JwtCustomClaims{UserID: 2, Role: domain.RoleModerator}, required: domain.RoleAdmin, wantStatusCode: http.StatusForbidden},
+		"403: users are denied":          {claims: &handler.JwtCustomClaims{UserID: 3, Role: domain.RoleUser}, required: domain.RoleModerator, wantStatusCode: http.StatusForbidden},
+		"403: token without a role":      {claims: &handler.JwtCustomClaims{UserID: 1}, required: domain.RoleModerator, wantStatusCode: http.StatusForbidden},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/initialize", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: tt.claims})
+
+			h := &handler.Handler{}
+			next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+			checkStatusCode(t, h.RequireRole(tt.required)(next)(c), rec, tt.wantStatusCode)
+		})
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		userID         string
+		body           string
+		setRoleErr     error
+		wantSet        bool
+		wantStatusCode int
+	}{
+		"204: made moderator": {
+			userID:         "2",
+			body:           `{"role": "moderator"}`,
+			wantSet:        true,
+			wantStatusCode: http.StatusNoContent,
+		},
+		"400: unknown role": {
+			userID:         "2",
+			body:           `{"role": "root"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"400: own role": {
+			userID:         "1",
+			body:           `{"role": "user"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"404: unknown user": {
+			userID:         "99",
+			body:           `{"role": "admin"}`,
+			setRoleErr:     sql.ErrNoRows,
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPut, "/admin/users/"+tt.userID+"/role", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("userID")
+			c.SetParamValues(tt.userID)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, Role: domain.RoleAdmin}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			if tt.wantSet || tt.setRoleErr != nil {
+				userRepo.EXPECT().SetUserRole(gomock.Any(), gomock.Any(), gomock.Any()).Return(tt.setRoleErr).Times(1)
+			}
+			// their tokens carry the old role
+			if tt.wantSet {
+				sessionRepo.EXPECT().RevokeUserSessions(gomock.Any(), int64(2)).Return(nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{UserRepo: userRepo, SessionRepo: sessionRepo, Tx: tx}
+			checkStatusCode(t, h.SetUserRole(c), rec, tt.wantStatusCode)
+		})
+	}
+}
+
+func TestGrantAdminRoles(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userRepo := db.NewMockUserRepository(ctrl)
+	gomock.InOrder(
+		userRepo.EXPECT().SetUserRole(gomock.Any(), int64(1), domain.RoleAdmin).Return(nil).Times(1),
+		// ids no user has are skipped
+		userRepo.EXPECT().SetUserRole(gomock.Any(), int64(99), domain.RoleAdmin).Return(sql.ErrNoRows).Times(1),
+		userRepo.EXPECT().SetUserRole(gomock.Any(), int64(2), domain.RoleAdmin).Return(nil).Times(1),
+	)
+
+	h := &handler.Handler{UserRepo: userRepo, AdminUserIDs: []int64{1, 99, 2}}
+	if err := h.GrantAdminRoles(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// imageCacheControl lets browsers and CDNs reuse an image for a minute, then revalidate it with the ETag.
+	imageCacheControl = "public, max-age=60"
+	// itemCacheControl makes clients revalidate every time, since price and status change at any moment.
+	itemCacheControl = "no-cache"
+)
+
+// imageETag names the content served for img at width.
+// Blob keys are never reused, so the key identifies the bytes.
+func imageETag(img domain.ItemImage, width int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", img.BlobKey, width)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// notModified evaluates If-None-Match and, when it is missing, If-Modified-Since,
+// as RFC 9110 orders them. etag and modified may be empty or zero when unknown.
+func notModified(req *http.Request, etag string, modified time.Time) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			// weak comparison
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	// Last-Modified is sent in whole seconds
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// setLastModified sends the time stored in the database as Last-Modified.
+// It returns the zero time when the stored time cannot be read.
+func setLastModified(c echo.Context, stored string) time.Time {
+	t, err := domain.ParseTime(stored)
+	if err != nil {
+		return time.Time{}
+	}
+	c.Response().Header().Set(echo.HeaderLastModified, t.UTC().Format(http.TimeFormat))
+	return t
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+type categoryRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+	// ParentID is only read when adding a category. 0 adds a root category.
+	ParentID int64 `json:"parent_id" validate:"min=0"`
+}
+
+type moveCategoryRequest struct {
+	ParentID int64 `json:"parent_id" validate:"min=0"`
+}
+
+type categoryTreeResponse struct {
+	ID       int64                  `json:"id"`
+	Name     string                 `json:"name"`
+	Children []categoryTreeResponse `json:"children"`
+}
+
+type reorderCategoriesRequest struct {
+	IDs []int64 `json:"ids" validate:"required"`
+}
+
+type adminCategoryResponse struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	ParentID  int64  `json:"parent_id"`
+	SortOrder int64  `json:"sort_order"`
+	RetiredAt string `json:"retired_at,omitempty"`
+}
+
+func convertToAdminCategoryResponse(cat domain.Category) adminCategoryResponse {
+	return adminCategoryResponse{
+		ID:        cat.ID,
+		Name:      cat.Name,
+		ParentID:  cat.ParentID,
+		SortOrder: cat.SortOrder,
+		RetiredAt: cat.RetiredAt,
+	}
+}
+
+// GetCategoryTree returns the categories nested under their parents.
+// Retired categories are left out together with everything below them.
+func (h *Handler) GetCategoryTree(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToCategoryTreeResponse(domain.BuildCategoryTree(cats)))
+}
+
+func convertToCategoryTreeResponse(nodes []*domain.CategoryNode) []categoryTreeResponse {
+	res := make([]categoryTreeResponse, 0, len(nodes))
+	for _, node := range nodes {
+		if node.IsRetired() {
+			continue
+		}
+		res = append(res, categoryTreeResponse{
+			ID:       node.ID,
+			Name:     node.Name,
+			Children: convertToCategoryTreeResponse(node.Children),
+		})
+	}
+	return res
+}
+
+// AdminGetCategories lists every category, retired ones included.
+func (h *Handler) AdminGetCategories(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	res := make([]adminCategoryResponse, len(cats))
+	for i, cat := range cats {
+		res[i] = convertToAdminCategoryResponse(cat)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) AddCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(categoryRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	if req.ParentID != 0 {
+		if _, err := h.ItemRepo.GetCategory(ctx, req.ParentID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusBadRequest, "parent category not found")
+			}
+			return toHTTPError(err)
+		}
+	}
+
+	cat, err := h.ItemRepo.AddCategory(ctx, req.Name, req.ParentID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToAdminCategoryResponse(cat))
+}
+
+func (h *Handler) RenameCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := strconv.ParseInt(c.Param("categoryID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID type")
+	}
+
+	req := new(categoryRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.RenameCategory(ctx, categoryID, req.Name); err != nil {
+		return categoryError(err)
+	}
+
+	return h.respondWithCategory(c, categoryID)
+}
+
+// MoveCategory puts the category under another parent, or at the root when parent_id is 0.
+func (h *Handler) MoveCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := strconv.ParseInt(c.Param("categoryID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID type")
+	}
+
+	req := new(moveCategoryRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	// check and move in one transaction so concurrent moves cannot build a cycle
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		cats, err := h.ItemRepo.GetCategories(ctx)
+		if err != nil {
+			return toHTTPError(err)
+		}
+		if len(domain.CategoryPath(cats, categoryID)) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "category not found")
+		}
+		if req.ParentID != 0 {
+			if len(domain.CategoryPath(cats, req.ParentID)) == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "parent category not found")
+			}
+			for _, id := range domain.DescendantCategoryIDs(cats, categoryID) {
+				if id == req.ParentID {
+					return echo.NewHTTPError(http.StatusBadRequest, "a category cannot be moved below itself")
+				}
+			}
+		}
+
+		if err := h.ItemRepo.MoveCategory(ctx, categoryID, req.ParentID); err != nil {
+			return categoryError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return h.respondWithCategory(c, categoryID)
+}
+
+// ReorderCategories sets the display order to the order of the given ids.
+func (h *Handler) ReorderCategories(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(reorderCategoriesRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.ReorderCategories(ctx, req.IDs); err != nil {
+		return categoryError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RetireCategory hides the category from new listings.
+// Items already in the category keep it.
+func (h *Handler) RetireCategory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categoryID, err := strconv.ParseInt(c.Param("categoryID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID type")
+	}
+
+	if err := h.ItemRepo.RetireCategory(ctx, categoryID); err != nil {
+		return categoryError(err)
+	}
+
+	return h.respondWithCategory(c, categoryID)
+}
+
+// respondWithCategory answers with the category as it is after a change.
+func (h *Handler) respondWithCategory(c echo.Context, id int64) error {
+	cat, err := h.ItemRepo.GetCategory(c.Request().Context(), id)
+	if err != nil {
+		return categoryError(err)
+	}
+	return c.JSON(http.StatusOK, convertToAdminCategoryResponse(cat))
+}
+
+func categoryError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "category not found")
+	}
+	return toHTTPError(err)
+}
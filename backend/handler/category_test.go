@@ -0,0 +1,232 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetCategoriesHidesRetired(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/items/categories", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{
+		{ID: 2, Name: "fashion", SortOrder: 1},
+		{ID: 1, Name: "food", SortOrder: 2, RetiredAt: "2023-06-01 00:00:00"},
+		{ID: 3, Name: "furniture", SortOrder: 3},
+		{ID: 4, Name: "snacks", ParentID: 1, SortOrder: 4},
+	}, nil).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	if err := h.GetCategories(c); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var resp []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+	}
+	if len(resp) != 2 || resp[0].ID != 2 || resp[1].ID != 3 {
+		t.Fatalf("unexpected categories: %s", rec.Body.String())
+	}
+}
+
+func TestAddItemToRetiredCategory(t *testing.T) {
+	t.Parallel()
+
+	// the form lists the item in category 1
+	cases := map[string]struct {
+		cats []domain.Category
+	}{
+		"400: retired category": {
+			cats: []domain.Category{{ID: 1, Name: "food", RetiredAt: "2023-06-01 00:00:00"}},
+		},
+		"400: child of a retired parent": {
+			cats: []domain.Category{
+				{ID: 2, Name: "food", RetiredAt: "2023-06-01 00:00:00"},
+				{ID: 1, Name: "snacks", ParentID: 2},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, contentType := newItemForm(t)
+			req := httptest.NewRequest(http.MethodPost, "/items", body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetCategories(gomock.Any()).Return(tt.cats, nil).Times(1)
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			err := h.AddItem(c)
+			echoErr, ok := err.(*echo.HTTPError)
+			if !ok || echoErr.Code != http.StatusBadRequest {
+				t.Fatalf("unexpected error: want: 400, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestReorderCategories(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/admin/categories/order", bytes.NewBufferString(`{"ids": [3, 1, 2]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().ReorderCategories(gomock.Any(), []int64{3, 1, 2}).Return(nil).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	if err := h.ReorderCategories(c); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code: want: %d, got: %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestMoveCategory(t *testing.T) {
+	t.Parallel()
+	cats := []domain.Category{
+		{ID: 1, Name: "fashion"},
+		{ID: 2, Name: "tops", ParentID: 1},
+		{ID: 3, Name: "food"},
+	}
+	cases := map[string]struct {
+		categoryID     string
+		body           string
+		wantMove       bool
+		wantParentID   int64
+		wantStatusCode int
+	}{
+		"200: move under another root":   {categoryID: "3", body: `{"parent_id": 1}`, wantMove: true, wantParentID: 1, wantStatusCode: http.StatusOK},
+		"200: move to the root":          {categoryID: "2", body: `{"parent_id": 0}`, wantMove: true, wantStatusCode: http.StatusOK},
+		"400: move below itself":         {categoryID: "1", body: `{"parent_id": 1}`, wantStatusCode: http.StatusBadRequest},
+		"400: move below its descendant": {categoryID: "1", body: `{"parent_id": 2}`, wantStatusCode: http.StatusBadRequest},
+		"400: unknown parent":            {categoryID: "3", body: `{"parent_id": 9}`, wantStatusCode: http.StatusBadRequest},
+		"404: unknown category":          {categoryID: "9", body: `{"parent_id": 1}`, wantStatusCode: http.StatusNotFound},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPut, "/admin/categories/"+tt.categoryID+"/parent", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("categoryID")
+			c.SetParamValues(tt.categoryID)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetCategories(gomock.Any()).Return(cats, nil).Times(1)
+			if tt.wantMove {
+				id, _ := strconv.ParseInt(tt.categoryID, 10, 64)
+				itemRepo.EXPECT().MoveCategory(gomock.Any(), id, tt.wantParentID).Return(nil).Times(1)
+				itemRepo.EXPECT().GetCategory(gomock.Any(), id).Return(domain.Category{ID: id, ParentID: tt.wantParentID}, nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{ItemRepo: itemRepo, Tx: tx}
+			if err := h.MoveCategory(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			// the response is the moved category
+			var resp struct {
+				ParentID int64 `json:"parent_id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+			}
+			if resp.ParentID != tt.wantParentID {
+				t.Fatalf("unexpected parent: want: %d, got: %d", tt.wantParentID, resp.ParentID)
+			}
+		})
+	}
+}
+
+func TestGetOnSaleItemsIncludesDescendants(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/items?category_id=1", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{
+		{ID: 1, Name: "fashion"},
+		{ID: 2, Name: "tops", ParentID: 1},
+		{ID: 3, Name: "food"},
+	}, nil).Times(1)
+	itemRepo.EXPECT().GetOnSaleItemsByCategoryIDs(gomock.Any(), []int64{1, 2}, gomock.Any()).Return([]domain.Item{
+		{ID: 10, Name: "T-shirt", CategoryID: 2, Status: domain.ItemStatusOnSale},
+	}, domain.PageInfo{}, nil).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	if err := h.GetOnSaleItems(c); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var resp []struct {
+		ID           int64  `json:"id"`
+		CategoryName string `json:"category_name"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+	}
+	if len(resp) != 1 || resp[0].ID != 10 || resp[0].CategoryName != "tops" {
+		t.Fatalf("unexpected items: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	// Code is a machine readable snake case code, such as not_found or insufficient_balance.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	Details   any    `json:"details,omitempty"`
+}
+
+// toHTTPError maps an error to its status code. This is the one place the kinds
+// of db errors get their status codes. HTTP errors are kept as they are.
+func toHTTPError(err error) error {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	var transitionErr *domain.ItemStatusTransitionError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return echo.NewHTTPError(http.StatusNotFound, "not found").SetInternal(err)
+	case errors.Is(err, db.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error()).SetInternal(err)
+	case errors.Is(err, db.ErrUnauthorized):
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+	case errors.Is(err, db.ErrInvalidInput):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	case errors.Is(err, db.ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, err.Error()).SetInternal(err)
+	case errors.Is(err, db.ErrPreconditionFailed), errors.As(err, &transitionErr):
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error()).SetInternal(err)
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+// HTTPErrorHandler writes every error as an errorResponse. The messages of
+// server errors are logged with the request ID instead of being sent.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	httpErr := toHTTPError(err).(*echo.HTTPError)
+	res := errorResponse{
+		Code:      errorCode(httpErr),
+		Message:   http.StatusText(httpErr.Code),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+	switch m := httpErr.Message.(type) {
+	case string:
+		res.Message = m
+	case validationErrorResponse:
+		res.Code = "validation_failed"
+		res.Message = m.Message
+		res.Details = m.Errors
+	case error:
+		res.Message = m.Error()
+	}
+	if httpErr.Code >= http.StatusInternalServerError {
+		log.Printf("request %s: %d: %v", res.RequestID, httpErr.Code, err)
+		res.Message = http.StatusText(httpErr.Code)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(httpErr.Code)
+	} else {
+		err = c.JSON(httpErr.Code, res)
+	}
+	if err != nil {
+		log.Printf("failed to write the error response: %s", err.Error())
+	}
+}
+
+// errorCode is the code of the db error behind the HTTP error,
+// or the status text in snake case.
+func errorCode(httpErr *echo.HTTPError) string {
+	var dbErr *db.Error
+	if cause, ok := httpErr.Message.(error); ok && errors.As(cause, &dbErr) {
+		return dbErr.Code
+	}
+	if errors.As(httpErr.Internal, &dbErr) {
+		return dbErr.Code
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(httpErr.Code), " ", "_"))
+}
@@ -0,0 +1,150 @@
+package handler_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		err            error
+		method         string
+		wantStatusCode int
+		wantCode       string
+		wantMessage    string
+		wantDetails    bool
+	}{
+		"HTTP error": {
+			err:            echo.NewHTTPError(http.StatusNotFound, "item not found"),
+			wantStatusCode: http.StatusNotFound,
+			wantCode:       "not_found",
+			wantMessage:    "item not found",
+		},
+		"HTTP error with a db error": {
+			err:            echo.NewHTTPError(http.StatusPreconditionFailed, db.ErrInsufficientBalance),
+			wantStatusCode: http.StatusPreconditionFailed,
+			wantCode:       "insufficient_balance",
+			wantMessage:    "insufficient balance",
+		},
+		"conflict": {
+			err:            errors.Wrap(db.ErrUserNameTaken, "failed AddUser"),
+			wantStatusCode: http.StatusConflict,
+			wantCode:       "user_name_taken",
+			wantMessage:    "failed AddUser: user name is already taken",
+		},
+		"invalid input": {
+			err:            db.ErrInvalidCursor,
+			wantStatusCode: http.StatusBadRequest,
+			wantCode:       "invalid_cursor",
+			wantMessage:    "invalid cursor",
+		},
+		"no rows": {
+			err:            sql.ErrNoRows,
+			wantStatusCode: http.StatusNotFound,
+			wantCode:       "not_found",
+			wantMessage:    "not found",
+		},
+		"status transition": {
+			err:            &domain.ItemStatusTransitionError{From: domain.ItemStatusSoldOut, To: domain.ItemStatusOnSale},
+			wantStatusCode: http.StatusPreconditionFailed,
+			wantCode:       "precondition_failed",
+		},
+		"server error is not sent": {
+			err:            echo.NewHTTPError(http.StatusInternalServerError, errors.New("database is locked")),
+			wantStatusCode: http.StatusInternalServerError,
+			wantCode:       "internal_server_error",
+			wantMessage:    "Internal Server Error",
+		},
+		"raw error": {
+			err:            errors.New("database is locked"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantCode:       "internal_server_error",
+			wantMessage:    "Internal Server Error",
+		},
+		"no body for HEAD": {
+			err:            echo.NewHTTPError(http.StatusNotFound, "item not found"),
+			method:         http.MethodHead,
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			e.HTTPErrorHandler = handler.HTTPErrorHandler
+			e.Use(middleware.RequestID())
+			e.Any("/", func(c echo.Context) error { return tt.err })
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			if method == http.MethodHead {
+				if rec.Body.Len() != 0 {
+					t.Fatalf("unexpected body: %s", rec.Body.String())
+				}
+				return
+			}
+			var resp struct {
+				Code      string `json:"code"`
+				Message   string `json:"message"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if tt.wantCode != resp.Code {
+				t.Fatalf("unexpected code: want: %s, got: %s", tt.wantCode, resp.Code)
+			}
+			if tt.wantMessage != "" && tt.wantMessage != resp.Message {
+				t.Fatalf("unexpected message: want: %s, got: %s", tt.wantMessage, resp.Message)
+			}
+			if resp.RequestID == "" || resp.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+				t.Fatalf("unexpected request id: %q, header: %q", resp.RequestID, rec.Header().Get(echo.HeaderXRequestID))
+			}
+		})
+	}
+}
+
+func TestHTTPErrorHandlerValidation(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
+	e.POST("/register", (&handler.Handler{}).Register)
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"password": "password"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: want: %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+	want := `{"code":"validation_failed","message":"validation failed","details":[{"field":"name","rule":"required"}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("unexpected body:\nwant: %s\ngot:  %s", want, got)
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -9,10 +10,12 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/mail"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
@@ -25,6 +28,10 @@ var (
 
 type JwtCustomClaims struct {
 	UserID int64 `json:"user_id"`
+	// SessionID is checked on every request, so the token stops working once the session is revoked.
+	SessionID string `json:"sid"`
+	// Role is the role of the user when the token was issued. Changing it revokes the sessions.
+	Role domain.Role `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -33,8 +40,11 @@ type InitializeResponse struct {
 }
 
 type registerRequest struct {
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Name string `json:"name" validate:"required,max=50"`
+	// bcrypt only reads the first 72 bytes
+	Password string `json:"password" validate:"required,maxbytes=72"`
+	// Email is optional. Password reset links are sent to it.
+	Email string `json:"email" validate:"max=254,email"`
 }
 
 type registerResponse struct {
@@ -57,19 +67,20 @@ type getOnSaleItemsResponse struct {
 }
 
 type getCategoriesResponse struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
 }
 
 type sellRequest struct {
-	ItemID int64 `json:"item_id"`
+	ItemID int64 `json:"item_id" validate:"required,min=1"`
 }
 
 type itemRequest struct {
-	Name        string `form:"name"`
-	CategoryID  int64  `form:"category_id"`
-	Price       int64  `form:"price"`
-	Description string `form:"description"`
+	Name        string `form:"name" validate:"required,max=50"`
+	CategoryID  int64  `form:"category_id" validate:"required,min=1"`
+	Price       int64  `form:"price" validate:"required,min=1"`
+	Description string `form:"description" validate:"max=1000"`
 }
 
 type addItemResponse struct {
@@ -77,35 +88,108 @@ type addItemResponse struct {
 }
 
 type AddBalanceRequest struct {
-	Balance int64 `json:"balance"`
+	Balance int64 `json:"balance" validate:"required,min=1"`
+	// TOTPCode is needed from StepUpAmount on, a code of the authenticator or a recovery code.
+	TOTPCode string `json:"totp_code"`
 }
 
 type GetBalanceResponse struct {
 	Balance int64 `json:"balance"`
 }
 
+type getBalanceHistoryResponse struct {
+	Balance int64                 `json:"balance"`
+	Entries []balanceHistoryEntry `json:"entries"`
+}
+
+type balanceHistoryEntry struct {
+	ID           int64                  `json:"id"`
+	Type         domain.LedgerEntryType `json:"type"`
+	Amount       int64                  `json:"amount"`
+	BalanceAfter int64                  `json:"balance_after"`
+	ItemID       int64                  `json:"item_id,omitempty"`
+	CreatedAt    string                 `json:"created_at"`
+}
+
+// loginRequest identifies the user by name, or by user_id when name is empty.
 type loginRequest struct {
-	UserID   int64  `json:"user_id"`
-	Password string `json:"password"`
+	UserID   int64  `json:"user_id" validate:"required_without=name"`
+	Name     string `json:"name" validate:"required_without=user_id"`
+	Password string `json:"password" validate:"required"`
+}
+
+type nameAvailabilityResponse struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
 }
 
 type loginResponse struct {
 	ID    int64  `json:"id"`
 	Name  string `json:"name"`
 	Token string `json:"token"`
+	// ExpiresIn is the lifetime of Token in seconds.
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type Handler struct {
-	DB       *sql.DB
-	UserRepo db.UserRepository
-	ItemRepo db.ItemRepository
-}
-
-func GetSecret() string {
-	if secret := os.Getenv("SECRET"); secret != "" {
-		return secret
-	}
-	return "secret-key"
+	DB          *sql.DB
+	UserRepo    db.UserRepository
+	ItemRepo    db.ItemRepository
+	LedgerRepo  db.LedgerRepository
+	OrderRepo   db.OrderRepository
+	SessionRepo db.SessionRepository
+	// PasswordResetRepo keeps the tokens of the reset links Mailer sends.
+	PasswordResetRepo db.PasswordResetRepository
+	Mailer            mail.Mailer
+	// LoginRepo counts failed logins and keeps the audit trail of every attempt.
+	LoginRepo db.LoginRepository
+	TOTPRepo  db.TOTPRepository
+	Tx        db.Transactor
+	// EscrowTimeout is how long an order waits for its next step. Orders not shipped by then
+	// are refunded, and shipped or delivered orders not confirmed by then pay the seller.
+	EscrowTimeout time.Duration
+	// AdminUserIDs are made admins on every start and after Initialize.
+	AdminUserIDs []int64
+	// AccessTokenTTL and RefreshTokenTTL are the lifetimes of the tokens a login issues.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Keys sign the access tokens and verify them.
+	Keys *Keyset
+	// PasswordPolicy applies to registrations, password changes and resets.
+	PasswordPolicy PasswordPolicy
+	// PasswordResetTTL is how long a reset link works.
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is the page of the reset links, which the token is appended to.
+	PasswordResetURL string
+	// ResetEmailThrottle and ResetIPThrottle limit the reset emails asked for an address and by a client.
+	ResetEmailThrottle domain.LoginThrottle
+	ResetIPThrottle    domain.LoginThrottle
+	// AccountThrottle and IPThrottle lock out accounts and clients failing to log in too often.
+	AccountThrottle domain.LoginThrottle
+	IPThrottle      domain.LoginThrottle
+	// StepUpAmount is the top-up from which users with two-factor authentication have to send a code.
+	// 0 never asks.
+	StepUpAmount int64
+
+	// background is the work left running after the response, such as sending mails.
+	background sync.WaitGroup
+}
+
+// Wait blocks until the work the handlers left running in the background is done.
+func (h *Handler) Wait() {
+	h.background.Wait()
+}
+
+// goBackground runs fn after the response, with a context that is not canceled with the request.
+func (h *Handler) goBackground(name string, fn func(ctx context.Context) error) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		if err := fn(context.Background()); err != nil {
+			log.Printf("failed to %s: %s", name, err.Error())
+		}
+	}()
 }
 
 func (h *Handler) Initialize(c echo.Context) error {
@@ -118,6 +202,10 @@ func (h *Handler) Initialize(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to initialize"))
 	}
+	// the seed data has no admins
+	if err := h.GrantAdminRoles(c.Request().Context()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to grant admin roles"))
+	}
 
 	return c.JSON(http.StatusOK, InitializeResponse{Message: "Success"})
 }
@@ -127,75 +215,119 @@ func (h *Handler) AccessLog(c echo.Context) error {
 }
 
 func (h *Handler) Register(c echo.Context) error {
-	// TODO: validation
-	// http.StatusBadRequest(400)
 	req := new(registerRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+	if err := h.checkPassword("password", req.Password, req.Name); err != nil {
+		return err
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	userID, err := h.UserRepo.AddUser(c.Request().Context(), domain.User{Name: req.Name, Password: string(hash)})
+	userID, err := h.UserRepo.AddUser(c.Request().Context(), domain.User{Name: req.Name, Password: string(hash), Email: req.Email})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, registerResponse{ID: userID, Name: req.Name})
 }
 
+// GetNameAvailability tells whether a name can still be registered.
+func (h *Handler) GetNameAvailability(c echo.Context) error {
+	name := c.QueryParam("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+
+	_, err := h.UserRepo.GetUserByName(c.Request().Context(), name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, nameAvailabilityResponse{Name: name, Available: err != nil})
+}
+
+// Login checks the password and starts a session, or returns a challenge token for LoginTOTP
+// when the user has two-factor authentication. Failed logins are counted per account and
+// per client, and either is locked out for a while when it fails too often.
 func (h *Handler) Login(c echo.Context) error {
 	ctx := c.Request().Context()
-	// TODO: validation
-	// http.StatusBadRequest(400)
 	req := new(loginRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bindRequest(c, req); err != nil {
+		return err
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, req.UserID)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	var user domain.User
+	var err error
+	if req.Name != "" {
+		user, err = h.UserRepo.GetUserByName(ctx, req.Name)
+	} else {
+		user, err = h.UserRepo.GetUser(ctx, req.UserID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return toHTTPError(err)
+	}
+
+	attempt := domain.LoginAttempt{UserID: user.ID, Identifier: loginIdentifier(req), IP: c.RealIP()}
+	accountKey, clientKey := loginKeys(req, user, attempt.IP)
+	if err := h.checkLockout(c, attempt, accountKey, clientKey); err != nil {
+		return err
+	}
+
+	// unknown users are checked against a dummy hash, so they take as long as wrong passwords
+	hash := []byte(user.Password)
+	if user.ID == 0 {
+		hash = dummyPasswordHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user.ID == 0 {
+		if err != nil && err != bcrypt.ErrMismatchedHashAndPassword {
+			return toHTTPError(err)
+		}
+		if err := h.recordLoginFailure(ctx, attempt, accountKey, clientKey); err != nil {
+			return err
+		}
+		return invalidLogin()
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return echo.NewHTTPError(http.StatusUnauthorized, err)
+	// the second step checks the code of the authenticator
+	totp, err := h.TOTPRepo.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return toHTTPError(err)
+	}
+	if totp.IsEnabled() {
+		attempt.Outcome = domain.LoginChallenged
+		if err := h.LoginRepo.AddLoginAttempt(ctx, attempt); err != nil {
+			return toHTTPError(err)
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return h.respondWithChallenge(c, user)
 	}
 
-	// Set custom claims
-	claims := &JwtCustomClaims{
-		req.UserID,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
-		},
+	attempt.Outcome = domain.LoginSucceeded
+	if err := h.LoginRepo.ResetLoginFailures(ctx, accountKey); err != nil {
+		return toHTTPError(err)
+	}
+	if err := h.LoginRepo.AddLoginAttempt(ctx, attempt); err != nil {
+		return toHTTPError(err)
 	}
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Generate encoded token and send it as response.
-	encodedToken, err := token.SignedString([]byte(GetSecret()))
+
+	session, refreshToken, err := h.SessionRepo.AddSession(ctx, user.ID, h.RefreshTokenTTL)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	return c.JSON(http.StatusOK, loginResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Token: encodedToken,
-	})
+	return h.respondWithTokens(c, user, session, refreshToken)
 }
 
 func (h *Handler) AddItem(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	req := new(itemRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bindRequest(c, req); err != nil {
+		return err
 	}
 
 	userID, err := getUserID(c)
@@ -203,30 +335,27 @@ func (h *Handler) AddItem(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	_, err = h.ItemRepo.GetCategory(ctx, req.CategoryID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID")
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := h.checkListingCategory(ctx, req.CategoryID, 0); err != nil {
+		return err
 	}
 
-	imageByte, err := getImageByte(c)
+	image, err := getImage(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		return err
 	}
 
 	item, err := h.ItemRepo.AddItem(c.Request().Context(), domain.Item{
-		Name:        req.Name,
-		CategoryID:  req.CategoryID,
-		UserID:      userID,
-		Price:       req.Price,
-		Description: req.Description,
-		Image:       imageByte,
-		Status:      domain.ItemStatusInitial,
+		Name:             req.Name,
+		CategoryID:       req.CategoryID,
+		UserID:           userID,
+		Price:            req.Price,
+		Description:      req.Description,
+		Image:            image.Data,
+		ImageContentType: image.ContentType,
+		Status:           domain.ItemStatusInitial,
 	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, addItemResponse{ID: int64(item.ID)})
@@ -237,47 +366,71 @@ func (h *Handler) UpdateItem(c echo.Context) error {
 
 	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	req := new(itemRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("itemRequest c.Bind() error: %v", err))
+	if err := bindRequest(c, req); err != nil {
+		return err
 	}
 
-	_, err = getUserID(c)
+	userID, err := getUserID(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	_, err = h.ItemRepo.GetCategory(ctx, req.CategoryID)
+	current, err := h.authorizeItemOwner(ctx, userID, itemID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID")
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("GetCategory() error: %v", err))
+		return err
+	}
+	if !current.Status.Editable() {
+		return toHTTPError(db.ErrItemNotEditable)
+	}
+
+	// an item can stay in a retired category but cannot move into one
+	if err := h.checkListingCategory(ctx, req.CategoryID, current.CategoryID); err != nil {
+		return err
 	}
 
-	imageByte, err := getImageByte(c)
+	image, err := getImage(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("getImageByte error: %v", err))
+		return err
 	}
 
 	item, err := h.ItemRepo.UpdateItem(c.Request().Context(), domain.Item{
-		ID:          itemID,
-		Name:        req.Name,
-		CategoryID:  req.CategoryID,
-		Price:       req.Price,
-		Description: req.Description,
-		Image:       imageByte,
+		ID:               itemID,
+		Name:             req.Name,
+		CategoryID:       req.CategoryID,
+		Price:            req.Price,
+		Description:      req.Description,
+		Image:            image.Data,
+		ImageContentType: image.ContentType,
 	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, item.ConvertToGetItemResponse())
 }
 
+// checkListingCategory rejects a category that does not exist or is retired,
+// directly or through one of its ancestors. keep is the item's current
+// category, which is accepted even when retired.
+func (h *Handler) checkListingCategory(ctx context.Context, id, keep int64) error {
+	cats, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	path := domain.CategoryPath(cats, id)
+	if len(path) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID")
+	}
+	if domain.IsRetiredPath(path) && id != keep {
+		return echo.NewHTTPError(http.StatusBadRequest, "category is retired")
+	}
+	return nil
+}
+
 func getImageByte(c echo.Context) ([]byte, error) {
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -307,50 +460,189 @@ func getImageByte(c echo.Context) ([]byte, error) {
 func (h *Handler) Sell(c echo.Context) error {
 	ctx := c.Request().Context()
 	req := new(sellRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
 
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, req.ItemID)
-	// TODO: not found handling
-	// http.StatusPreconditionFailed(412)
+	item, err := h.authorizeItemOwner(ctx, userID, req.ItemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		// not found handling
+		// http.StatusPreconditionFailed(412)
+		if echoErr, ok := err.(*echo.HTTPError); ok && echoErr.Code == http.StatusNotFound {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, echoErr.Message)
+		}
+		return err
 	}
 
-	// TODO: check req.UserID and item.UserID
-	// http.StatusPreconditionFailed(412)
-	// TODO: only update when status is initial
-	// http.StatusPreconditionFailed(412)
-	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, item.Status, domain.ItemEventSell); err != nil {
+		return toHTTPError(err)
 	}
+	item.Status = domain.ItemStatusOnSale
 
-	return c.JSON(http.StatusOK, "successful")
+	return c.JSON(http.StatusOK, item.ConvertToGetItemResponse())
 }
 
+// DeleteItem removes an item that has not been sold.
+func (h *Handler) DeleteItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.authorizeItemOwner(ctx, userID, itemID)
+	if err != nil {
+		return err
+	}
+	// sold items are kept for their order
+	if item.Status == domain.ItemStatusSoldOut {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "sold items cannot be deleted")
+	}
+
+	if err := h.ItemRepo.DeleteItems(ctx, item.ID); err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateItemImage replaces the cover image of an item.
+func (h *Handler) UpdateItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if _, err := h.authorizeItemOwner(ctx, userID, itemID); err != nil {
+		return err
+	}
+
+	image, err := getImage(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.UpdateItemImage(ctx, itemID, image); err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PauseItem hides an item on sale until it is relisted.
+func (h *Handler) PauseItem(c echo.Context) error {
+	return h.changeItemStatus(c, domain.ItemEventPause)
+}
+
+// WithdrawItem takes an item off the market.
+func (h *Handler) WithdrawItem(c echo.Context) error {
+	return h.changeItemStatus(c, domain.ItemEventWithdraw)
+}
+
+// RelistItem puts a paused or withdrawn item back on sale.
+func (h *Handler) RelistItem(c echo.Context) error {
+	return h.changeItemStatus(c, domain.ItemEventRelist)
+}
+
+func (h *Handler) changeItemStatus(c echo.Context, event domain.ItemEvent) error {
+	ctx := c.Request().Context()
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	item, err := h.authorizeItemOwner(ctx, userID, itemID)
+	if err != nil {
+		return err
+	}
+	to, err := item.Status.Apply(event)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, item.Status, event); err != nil {
+		return toHTTPError(err)
+	}
+	item.Status = to
+
+	return c.JSON(http.StatusOK, item.ConvertToGetItemResponse())
+}
+
+// GetOnSaleItems lists the items on sale. With category_id it only lists
+// items in that category and the categories below it.
 func (h *Handler) GetOnSaleItems(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	items, err := h.ItemRepo.GetOnSaleItems(ctx)
+	cats, err := h.ItemRepo.GetCategories(ctx)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err)
+		return toHTTPError(err)
 	}
 
-	var res []getOnSaleItemsResponse
-	for _, item := range items {
-		cats, err := h.ItemRepo.GetCategories(ctx)
+	page, err := getPageRequest(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var items []domain.Item
+	var info domain.PageInfo
+	if v := c.QueryParam("category_id"); v != "" {
+		categoryID, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid category_id type")
 		}
-		for _, cat := range cats {
-			if cat.ID == item.CategoryID {
-				res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: cat.Name})
-			}
+		if len(domain.CategoryPath(cats, categoryID)) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "category not found")
+		}
+		items, info, err = h.ItemRepo.GetOnSaleItemsByCategoryIDs(ctx, domain.DescendantCategoryIDs(cats, categoryID), page)
+		if err != nil {
+			return toHTTPError(err)
+		}
+	} else {
+		items, info, err = h.ItemRepo.GetOnSaleItems(ctx, page)
+		if err != nil {
+			return toHTTPError(err)
 		}
 	}
 
+	categoryNames := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		categoryNames[cat.ID] = cat.Name
+	}
+
+	var res []getOnSaleItemsResponse
+	for _, item := range items {
+		name, ok := categoryNames[item.CategoryID]
+		if !ok {
+			continue
+		}
+		res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: name})
+	}
+
+	setPageHeaders(c, info)
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -359,22 +651,43 @@ func (h *Handler) GetItem(c echo.Context) error {
 
 	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, itemID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	// the response has no image, so the blob store is not touched, not even for a 304
+	item, err := h.ItemRepo.GetItemWithoutImage(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	category, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
+	cats, err := h.ItemRepo.GetCategories(ctx)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
+	}
+	path := domain.CategoryPath(cats, item.CategoryID)
+	if len(path) == 0 {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("category %d not found", item.CategoryID))
 	}
+
+	// revalidated by the latest updated_at of the item and the categories on its path, whose names
+	// are in the response. Changes within the same second as the cached copy go unnoticed
+	updatedAt := item.UpdatedAt
+	for _, cat := range path {
+		// both are stored as DATETIME('now', 'localtime'), which sorts as text
+		if cat.UpdatedAt > updatedAt {
+			updatedAt = cat.UpdatedAt
+		}
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, itemCacheControl)
+	if notModified(c.Request(), "", setLastModified(c, updatedAt)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
 	res := item.ConvertToGetItemResponse()
-	res.CategoryName = category.Name
+	res.CategoryName = path[len(path)-1].Name
+	for _, cat := range path {
+		res.CategoryPath = append(res.CategoryPath, domain.CategoryPathEntry{ID: cat.ID, Name: cat.Name})
+	}
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -383,21 +696,26 @@ func (h *Handler) GetUserItems(c echo.Context) error {
 
 	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid userID type")
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid userID type")
 	}
 
-	items, err := h.ItemRepo.GetItemsByUserID(ctx, userID)
+	page, err := getPageRequest(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	items, info, err := h.ItemRepo.GetItemsByUserID(ctx, userID, page)
 	// TODO: not found handling
 	// http.StatusNotFound(404)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	var res []getUserItemsResponse
 	for _, item := range items {
 		cat, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
+			return toHTTPError(err)
 		}
 		res = append(res, getUserItemsResponse{
 			ID:           item.ID,
@@ -407,6 +725,7 @@ func (h *Handler) GetUserItems(c echo.Context) error {
 		})
 	}
 
+	setPageHeaders(c, info)
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -417,94 +736,64 @@ func (h *Handler) GetCategories(c echo.Context) error {
 	// TODO: not found handling
 	// http.StatusNotFound(404)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	res := make([]getCategoriesResponse, len(cats))
-	for i, cat := range cats {
-		res[i] = getCategoriesResponse{ID: cat.ID, Name: cat.Name}
+	// retired categories and everything below them cannot be chosen for new listings
+	res := make([]getCategoriesResponse, 0, len(cats))
+	for _, cat := range cats {
+		if domain.IsRetiredPath(domain.CategoryPath(cats, cat.ID)) {
+			continue
+		}
+		res = append(res, getCategoriesResponse{ID: cat.ID, Name: cat.Name, ParentID: cat.ParentID})
 	}
 
 	return c.JSON(http.StatusOK, res)
 }
 
+// GetImage serves the cover image. size scales it down to one of domain.ImageVariantWidths.
 func (h *Handler) GetImage(c echo.Context) error {
-	ctx := c.Request().Context()
-
 	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid itemID type")
-	}
-
-	data, err := h.ItemRepo.GetItemImage(ctx, itemID)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err)
-	}
-
-	return c.Blob(http.StatusOK, "image/jpeg", data)
-}
-
-func (h *Handler) SearchItems(c echo.Context) error {
-	ctx := c.Request().Context()
-
-	// get search word
-	searchWord := c.Request().URL.Query().Get("name")
-	if searchWord == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "please specified search word")
-	}
-
-	items, err := h.ItemRepo.SearchItemsByWord(ctx, searchWord)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	categories, err := h.ItemRepo.GetCategories(ctx)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-	res := make([]domain.GetItemResponse, len(items))
-	for i, item := range items {
-		res[i] = item.ConvertToGetItemResponse()
-		// TODO: refactor here...
-		if !(0 <= res[i].CategoryID && res[i].CategoryID <= int64(len(categories))) {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("invalid category ID: %d", res[i].CategoryID))
-		}
-		res[i].CategoryName = categories[res[i].CategoryID-1].Name
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
 	}
 
-	return c.JSON(http.StatusOK, res)
+	return h.serveItemImage(c, itemID, 0)
 }
 
 func (h *Handler) AddBalance(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	// validation
 	req := new(AddBalanceRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
-	}
-	if req.Balance <= 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("negative added balance is invalid: %d", req.Balance))
+	if err := bindRequest(c, req); err != nil {
+		return err
 	}
 
 	userID, err := getUserID(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
+	if err := h.requireStepUp(c, userID, req.Balance, req.TOTPCode); err != nil {
+		return err
+	}
 
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	if err != nil {
+	if err := h.UserRepo.CreditBalance(ctx, domain.LedgerEntry{
+		UserID: userID,
+		Type:   domain.LedgerEntryTopUp,
+		Amount: req.Balance,
+	}); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance+req.Balance); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	user, err := h.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		return toHTTPError(err)
 	}
 
-	return c.JSON(http.StatusOK, "successful")
+	return c.JSON(http.StatusOK, GetBalanceResponse{Balance: user.Balance})
 }
 
 func (h *Handler) GetBalance(c echo.Context) error {
@@ -520,13 +809,13 @@ func (h *Handler) GetBalance(c echo.Context) error {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, GetBalanceResponse{Balance: user.Balance})
 }
 
-func (h *Handler) Purchase(c echo.Context) error {
+func (h *Handler) GetBalanceHistory(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	userID, err := getUserID(c)
@@ -534,66 +823,122 @@ func (h *Handler) Purchase(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	page, err := getPageRequest(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	// TODO: use transaction
-	buyer, err := h.UserRepo.GetUser(ctx, userID)
+	user, err := h.UserRepo.GetUser(ctx, userID)
 	if err != nil {
-		// not found handling
 		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusPreconditionFailed, err)
+			return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
 
-	// TODO: this request can be reduced by updating UpdateItemStatus
-	// e.g.) UpdateItemStatusIfOnSale, UpdateItemStatus(context, itemID, beforeCondition, afterCondition)
-	item, err := h.ItemRepo.GetItem(ctx, itemID)
+	entries, info, err := h.LedgerRepo.GetEntriesByUserID(ctx, userID, page)
 	if err != nil {
-		// not found handling
-		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusPreconditionFailed, err)
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return toHTTPError(err)
 	}
-	// update only when item status is on sale
-	if item.Status != domain.ItemStatusOnSale {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("item is not on sale"))
+	setPageHeaders(c, info)
+
+	res := getBalanceHistoryResponse{
+		Balance: user.Balance,
+		Entries: make([]balanceHistoryEntry, len(entries)),
 	}
-	// not to buy own items. 自身の商品を買おうとしていたら、http.StatusPreconditionFailed(412)
-	if buyer.ID == item.UserID {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("failed to buy because of user owned item"))
+	for i, entry := range entries {
+		res.Entries[i] = balanceHistoryEntry{
+			ID:           entry.ID,
+			Type:         entry.Type,
+			Amount:       entry.Amount,
+			BalanceAfter: entry.BalanceAfter,
+			ItemID:       entry.ItemID,
+			CreatedAt:    entry.CreatedAt,
+		}
 	}
 
-	sellerID := item.UserID
-	seller, err := h.UserRepo.GetUser(ctx, sellerID)
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) Purchase(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
 	if err != nil {
-		// not found handling
-		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusPreconditionFailed, err)
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	// if it is fail here, item status is still sold
-	// balance consistency
-	if buyer.Balance-item.Price < 0 {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("failed to buy because of lack of balances: balance: %d, price: %d", buyer.Balance, item.Price))
-	}
-	if err := h.ItemRepo.UpdateItemStatus(ctx, itemID, domain.ItemStatusSoldOut); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-	if err := h.UserRepo.UpdateBalance(ctx, userID, buyer.Balance-item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
 	}
-	if err := h.UserRepo.UpdateBalance(ctx, sellerID, seller.Balance+item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+
+	// item status, buyer balance and the order are updated in one transaction,
+	// so a failure on the way never leaves an item sold without payment
+	var order domain.Order
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		buyer, err := h.UserRepo.GetUser(ctx, userID)
+		if err != nil {
+			// not found handling
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusPreconditionFailed, err)
+			}
+			return toHTTPError(err)
+		}
+
+		// the row only: the image is not needed and would be read under the write lock
+		item, err := h.ItemRepo.GetItemWithoutImage(ctx, itemID)
+		if err != nil {
+			// not found handling
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusPreconditionFailed, err)
+			}
+			return toHTTPError(err)
+		}
+		// update only when item status is on sale
+		if item.Status != domain.ItemStatusOnSale {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("item is not on sale"))
+		}
+		// not to buy own items. 自身の商品を買おうとしていたら、http.StatusPreconditionFailed(412)
+		if buyer.ID == item.UserID {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("failed to buy because of user owned item"))
+		}
+		// balance consistency
+		if buyer.Balance-item.Price < 0 {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("failed to buy because of lack of balances: balance: %d, price: %d", buyer.Balance, item.Price))
+		}
+
+		// conditional updates: a concurrent buyer who got here first makes these fail
+		if err := h.ItemRepo.UpdateItemStatus(ctx, itemID, domain.ItemStatusOnSale, domain.ItemEventPurchase); err != nil {
+			return toHTTPError(err)
+		}
+		if err := h.UserRepo.DebitBalance(ctx, domain.LedgerEntry{
+			UserID: userID,
+			Type:   domain.LedgerEntryPurchase,
+			Amount: item.Price,
+			ItemID: itemID,
+		}); err != nil {
+			return toHTTPError(err)
+		}
+		// the seller is paid when the order is completed
+		orderID, err := h.OrderRepo.AddOrder(ctx, domain.Order{
+			ItemID:   itemID,
+			BuyerID:  userID,
+			SellerID: item.UserID,
+			Price:    item.Price,
+			Status:   domain.OrderStatusReserved,
+		})
+		if err != nil {
+			return toHTTPError(err)
+		}
+		order, err = h.OrderRepo.GetOrder(ctx, orderID)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
 	}
 
-	return c.JSON(http.StatusOK, "successful")
+	return c.JSON(http.StatusOK, convertToOrderResponse(order))
 }
 
 func getUserID(c echo.Context) (int64, error) {
@@ -613,6 +958,50 @@ func getUserID(c echo.Context) (int64, error) {
 	return claims.UserID, nil
 }
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// The item lists stay plain arrays, so their cursors are sent in these headers.
+const (
+	HeaderNextCursor = "X-Next-Cursor"
+	HeaderPrevCursor = "X-Prev-Cursor"
+)
+
+// getPageRequest reads the limit and cursor query parameters.
+func getPageRequest(c echo.Context) (domain.PageRequest, error) {
+	limit, err := getLimit(c)
+	if err != nil {
+		return domain.PageRequest{}, err
+	}
+	return domain.PageRequest{Limit: limit, Cursor: c.QueryParam("cursor")}, nil
+}
+
+func getLimit(c echo.Context) (int64, error) {
+	limit := int64(defaultPageLimit)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid limit: %s", v)
+		}
+		limit = n
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
+
+func setPageHeaders(c echo.Context, info domain.PageInfo) {
+	if info.NextCursor != "" {
+		c.Response().Header().Set(HeaderNextCursor, info.NextCursor)
+	}
+	if info.PrevCursor != "" {
+		c.Response().Header().Set(HeaderPrevCursor, info.PrevCursor)
+	}
+}
+
 func getEnv(key string, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
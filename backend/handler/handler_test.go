@@ -2,12 +2,15 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
@@ -16,6 +19,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestGetBalance(t *testing.T) {
@@ -111,19 +115,22 @@ func TestPostBalance(t *testing.T) {
 		userID              int64
 		injectorForUserRepo func(*db.MockUserRepository)
 		wantStatusCode      int
+		wantBalance         int64
 	}{
 		"200: correctly add balance": {
 			reqBalance: 10,
 			userID:     1,
 			injectorForUserRepo: func(m *db.MockUserRepository) {
-				m.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{
-					ID:      1,
-					Balance: 57,
-				}, nil).Times(1)
 				// updating is DB logic, so the check after updating is unneeded
-				m.EXPECT().UpdateBalance(gomock.Any(), int64(1), int64(67)).Return(nil)
+				m.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+					UserID: 1,
+					Type:   domain.LedgerEntryTopUp,
+					Amount: 10,
+				}).Return(nil).Times(1)
+				m.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{ID: 1, Balance: 110}, nil).Times(1)
 			},
 			wantStatusCode: http.StatusOK,
+			wantBalance:    110,
 		},
 		"400: failed because of negative balance": {
 			reqBalance:          -1,
@@ -141,7 +148,7 @@ func TestPostBalance(t *testing.T) {
 			reqBalance: 1,
 			userID:     3,
 			injectorForUserRepo: func(m *db.MockUserRepository) {
-				m.EXPECT().GetUser(gomock.Any(), int64(3)).Return(domain.User{}, sql.ErrNoRows).Times(1)
+				m.EXPECT().CreditBalance(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows).Times(1)
 			},
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
@@ -149,7 +156,7 @@ func TestPostBalance(t *testing.T) {
 			reqBalance: 1,
 			userID:     9999,
 			injectorForUserRepo: func(m *db.MockUserRepository) {
-				m.EXPECT().GetUser(gomock.Any(), int64(9999)).Return(domain.User{}, errors.New("strange error")).Times(1)
+				m.EXPECT().CreditBalance(gomock.Any(), gomock.Any()).Return(errors.New("strange error")).Times(1)
 			},
 			wantStatusCode: http.StatusInternalServerError,
 		},
@@ -197,19 +204,138 @@ func TestPostBalance(t *testing.T) {
 					return
 				}
 			}
+
+			// the response carries the balance after the top-up
+			var resp handler.GetBalanceResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+			}
+			if resp.Balance != tt.wantBalance {
+				t.Fatalf("unexpected balance: want: %d, got: %d", tt.wantBalance, resp.Balance)
+			}
+		})
+	}
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		url                   string
+		userID                int64
+		injectorForUserRepo   func(*db.MockUserRepository)
+		injectorForLedgerRepo func(*db.MockLedgerRepository)
+		wantStatusCode        int
+		wantEntries           int
+		wantNextCursor        string
+	}{
+		"200: correctly got history": {
+			url:    "/balance/history?limit=2&cursor=prev",
+			userID: 1,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{ID: 1, Balance: 70}, nil).Times(1)
+			},
+			injectorForLedgerRepo: func(m *db.MockLedgerRepository) {
+				m.EXPECT().GetEntriesByUserID(gomock.Any(), int64(1), domain.PageRequest{Limit: 2, Cursor: "prev"}).Return([]domain.LedgerEntry{
+					{ID: 3, UserID: 1, Type: domain.LedgerEntryPurchase, Amount: -30, BalanceAfter: 70, ItemID: 5},
+					{ID: 2, UserID: 1, Type: domain.LedgerEntryTopUp, Amount: 50, BalanceAfter: 100},
+				}, domain.PageInfo{NextCursor: "next"}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+			wantEntries:    2,
+			wantNextCursor: "next",
+		},
+		"400: failed because of an invalid limit": {
+			url:                   "/balance/history?limit=-1",
+			userID:                1,
+			injectorForUserRepo:   func(_ *db.MockUserRepository) {},
+			injectorForLedgerRepo: func(_ *db.MockLedgerRepository) {},
+			wantStatusCode:        http.StatusBadRequest,
+		},
+		"401: failed because of an invalid user id": {
+			url:                   "/balance/history",
+			userID:                -1,
+			injectorForUserRepo:   func(_ *db.MockUserRepository) {},
+			injectorForLedgerRepo: func(_ *db.MockLedgerRepository) {},
+			wantStatusCode:        http.StatusUnauthorized,
+		},
+		"412: user not found": {
+			url:    "/balance/history",
+			userID: 2,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUser(gomock.Any(), int64(2)).Return(domain.User{}, sql.ErrNoRows).Times(1)
+			},
+			injectorForLedgerRepo: func(_ *db.MockLedgerRepository) {},
+			wantStatusCode:        http.StatusPreconditionFailed,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: tt.userID}})
+
+			// ready gomock
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			tt.injectorForUserRepo(userRepo)
+			ledgerRepo := db.NewMockLedgerRepository(ctrl)
+			tt.injectorForLedgerRepo(ledgerRepo)
+
+			// test handler
+			h := handler.Handler{UserRepo: userRepo, LedgerRepo: ledgerRepo}
+			if err := h.GetBalanceHistory(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if got := rec.Header().Get(handler.HeaderNextCursor); got != tt.wantNextCursor {
+				t.Fatalf("unexpected next cursor: want: %s, got: %s", tt.wantNextCursor, got)
+			}
+			var resp struct {
+				Balance int64             `json:"balance"`
+				Entries []json.RawMessage `json:"entries"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+			}
+			if tt.wantEntries != len(resp.Entries) {
+				t.Fatalf("unexpected entries: want: %d, got: %d", tt.wantEntries, len(resp.Entries))
+			}
 		})
 	}
 }
 
+// runTransaction makes the mocked transactor just call the unit of work.
+func runTransaction(m *db.MockTransactor) {
+	m.EXPECT().Transaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+		return fn(ctx)
+	}).AnyTimes()
+}
+
 func TestPostPurchase(t *testing.T) {
 	t.Parallel()
 
 	cases := map[string]struct {
-		itemID              int64
-		buyerUserID         int64
-		injectorForUserRepo func(*db.MockUserRepository)
-		injectorForItemRepo func(*db.MockItemRepository)
-		wantStatusCode      int
+		itemID               int64
+		buyerUserID          int64
+		injectorForUserRepo  func(*db.MockUserRepository)
+		injectorForItemRepo  func(*db.MockItemRepository)
+		injectorForOrderRepo func(*db.MockOrderRepository)
+		injectorForTx        func(*db.MockTransactor)
+		wantStatusCode       int
 	}{
 		"200: correctly purchase": {
 			itemID:      1,
@@ -219,28 +345,41 @@ func TestPostPurchase(t *testing.T) {
 					ID:      1,
 					Balance: 10,
 				}, nil).Times(1)
-				m.EXPECT().GetUser(gomock.Any(), int64(2)).Return(domain.User{
-					ID:      2,
-					Balance: 10,
-				}, nil).Times(1)
-				m.EXPECT().UpdateBalance(gomock.Any(), int64(1), int64(0)).Return(nil).Times(1)
-				m.EXPECT().UpdateBalance(gomock.Any(), int64(2), int64(20)).Return(nil).Times(1)
+				m.EXPECT().DebitBalance(gomock.Any(), domain.LedgerEntry{
+					UserID: 1,
+					Type:   domain.LedgerEntryPurchase,
+					Amount: 10,
+					ItemID: 1,
+				}).Return(nil).Times(1)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(1)).Return(domain.Item{
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
 					ID:     1,
 					Price:  10,
 					UserID: 2,
 					Status: domain.ItemStatusOnSale,
 				}, nil).Times(1)
-				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusSoldOut).Return(nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusOnSale, domain.ItemEventPurchase).Return(nil).Times(1)
 			},
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				// the seller is not paid until the order is completed
+				m.EXPECT().AddOrder(gomock.Any(), domain.Order{
+					ItemID:   1,
+					BuyerID:  1,
+					SellerID: 2,
+					Price:    10,
+					Status:   domain.OrderStatusReserved,
+				}).Return(int64(1), nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(domain.Order{ID: 1, ItemID: 1, BuyerID: 1, SellerID: 2, Price: 10, Status: domain.OrderStatusReserved}, nil).Times(1)
+			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusOK,
 		},
 		"401: failed because of an invalid user id": {
 			buyerUserID:         -1,
 			injectorForUserRepo: func(_ *db.MockUserRepository) {},
 			injectorForItemRepo: func(_ *db.MockItemRepository) {},
+			injectorForTx:       func(_ *db.MockTransactor) {},
 			wantStatusCode:      http.StatusUnauthorized,
 		},
 		"412: failed because item status is sold out": {
@@ -253,11 +392,12 @@ func TestPostPurchase(t *testing.T) {
 				}, nil).Times(1)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(1)).Return(domain.Item{
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
 					ID:     1,
 					Status: domain.ItemStatusSoldOut,
 				}, nil).Times(1)
 			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
 		"412: failed because item is not found": {
@@ -270,8 +410,9 @@ func TestPostPurchase(t *testing.T) {
 				}, nil).Times(1)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(2)).Return(domain.Item{}, sql.ErrNoRows).Times(1)
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(2)).Return(domain.Item{}, sql.ErrNoRows).Times(1)
 			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
 		"412: failed because a given user is not found": {
@@ -280,6 +421,7 @@ func TestPostPurchase(t *testing.T) {
 				m.EXPECT().GetUser(gomock.Any(), int64(2)).Return(domain.User{}, sql.ErrNoRows).Times(1)
 			},
 			injectorForItemRepo: func(_ *db.MockItemRepository) {},
+			injectorForTx:       runTransaction,
 			wantStatusCode:      http.StatusPreconditionFailed,
 		},
 		"412: failed because of buying given user owned item": {
@@ -292,12 +434,13 @@ func TestPostPurchase(t *testing.T) {
 				}, nil).Times(1)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(1)).Return(domain.Item{
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
 					ID:     1,
 					UserID: 1,
 					Status: domain.ItemStatusOnSale,
 				}, nil).Times(1)
 			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
 		"412: failed because of a lack of balance": {
@@ -308,22 +451,19 @@ func TestPostPurchase(t *testing.T) {
 					ID:      1,
 					Balance: 10,
 				}, nil).Times(1)
-				m.EXPECT().GetUser(gomock.Any(), int64(2)).Return(domain.User{
-					ID:      2,
-					Balance: 10,
-				}, nil).Times(1)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(1)).Return(domain.Item{
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
 					ID:     1,
 					UserID: 2,
 					Price:  9999,
 					Status: domain.ItemStatusOnSale,
 				}, nil).Times(1)
 			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
-		"412: failed because a seller user is not found": {
+		"409: failed because another buyer purchased the item first": {
 			itemID:      1,
 			buyerUserID: 1,
 			injectorForUserRepo: func(m *db.MockUserRepository) {
@@ -331,15 +471,44 @@ func TestPostPurchase(t *testing.T) {
 					ID:      1,
 					Balance: 10,
 				}, nil).Times(1)
-				m.EXPECT().GetUser(gomock.Any(), int64(3)).Return(domain.User{}, sql.ErrNoRows)
 			},
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().GetItem(gomock.Any(), int64(1)).Return(domain.Item{
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
 					ID:     1,
-					UserID: 3,
+					UserID: 2,
+					Price:  10,
 					Status: domain.ItemStatusOnSale,
 				}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusOnSale, domain.ItemEventPurchase).Return(db.ErrItemStatusMismatch).Times(1)
+			},
+			injectorForTx:  runTransaction,
+			wantStatusCode: http.StatusConflict,
+		},
+		"412: failed because the balance was spent by another purchase": {
+			itemID:      1,
+			buyerUserID: 1,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{
+					ID:      1,
+					Balance: 10,
+				}, nil).Times(1)
+				m.EXPECT().DebitBalance(gomock.Any(), domain.LedgerEntry{
+					UserID: 1,
+					Type:   domain.LedgerEntryPurchase,
+					Amount: 10,
+					ItemID: 1,
+				}).Return(db.ErrInsufficientBalance).Times(1)
 			},
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{
+					ID:     1,
+					UserID: 2,
+					Price:  10,
+					Status: domain.ItemStatusOnSale,
+				}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusOnSale, domain.ItemEventPurchase).Return(nil).Times(1)
+			},
+			injectorForTx:  runTransaction,
 			wantStatusCode: http.StatusPreconditionFailed,
 		},
 		"500: internal server error": {
@@ -348,8 +517,19 @@ func TestPostPurchase(t *testing.T) {
 				m.EXPECT().GetUser(gomock.Any(), int64(9999)).Return(domain.User{}, errors.New("strange error")).Times(1)
 			},
 			injectorForItemRepo: func(_ *db.MockItemRepository) {},
+			injectorForTx:       runTransaction,
 			wantStatusCode:      http.StatusInternalServerError,
 		},
+		"500: failed to commit": {
+			itemID:              1,
+			buyerUserID:         1,
+			injectorForUserRepo: func(_ *db.MockUserRepository) {},
+			injectorForItemRepo: func(_ *db.MockItemRepository) {},
+			injectorForTx: func(m *db.MockTransactor) {
+				m.EXPECT().Transaction(gomock.Any(), gomock.Any()).Return(errors.New("database is locked")).Times(1)
+			},
+			wantStatusCode: http.StatusInternalServerError,
+		},
 	}
 
 	for name, tt := range cases {
@@ -375,9 +555,15 @@ func TestPostPurchase(t *testing.T) {
 			tt.injectorForUserRepo(userRepo)
 			itemRepo := db.NewMockItemRepository(ctrl)
 			tt.injectorForItemRepo(itemRepo)
+			orderRepo := db.NewMockOrderRepository(ctrl)
+			if tt.injectorForOrderRepo != nil {
+				tt.injectorForOrderRepo(orderRepo)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			tt.injectorForTx(tx)
 
 			// test handler
-			h := handler.Handler{UserRepo: userRepo, ItemRepo: itemRepo}
+			h := handler.Handler{UserRepo: userRepo, ItemRepo: itemRepo, OrderRepo: orderRepo, Tx: tx}
 			// TODO: might be better... :(
 			if err := h.Purchase(c); err != nil {
 				t.Logf("err: %s", err.Error())
@@ -386,12 +572,366 @@ func TestPostPurchase(t *testing.T) {
 					t.Fatalf("unexpected error: %s", err.Error())
 				}
 				if tt.wantStatusCode != echoErr.Code {
-					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
 				}
 				if echoErr.Code != http.StatusOK {
 					return
 				}
 			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			// the response is the new order
+			var resp struct {
+				ID     int64              `json:"id"`
+				Status domain.OrderStatus `json:"status"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+			}
+			if resp.ID != 1 || resp.Status != domain.OrderStatusReserved {
+				t.Fatalf("unexpected order: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestChangeItemStatus(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		action              func(*handler.Handler, echo.Context) error
+		userID              int64
+		injectorForItemRepo func(*db.MockItemRepository)
+		wantStatusCode      int
+	}{
+		"200: pause an item on sale": {
+			action: (*handler.Handler).PauseItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusOnSale}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusOnSale, domain.ItemEventPause).Return(nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: relist a withdrawn item": {
+			action: (*handler.Handler).RelistItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusWithdrawn}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusWithdrawn, domain.ItemEventRelist).Return(nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"404: item not found": {
+			action: (*handler.Handler).WithdrawItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{}, sql.ErrNoRows).Times(1)
+			},
+			wantStatusCode: http.StatusNotFound,
+		},
+		"409: item was changed concurrently": {
+			action: (*handler.Handler).WithdrawItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusOnSale}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusOnSale, domain.ItemEventWithdraw).Return(db.ErrItemStatusMismatch).Times(1)
+			},
+			wantStatusCode: http.StatusConflict,
+		},
+		"412: a sold item cannot be relisted": {
+			action: (*handler.Handler).RelistItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusSoldOut}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"412: a draft cannot be paused": {
+			action: (*handler.Handler).PauseItem,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusInitial}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/items/:itemID", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: tt.userID}})
+			c.SetParamNames("itemID")
+			c.SetParamValues("1")
+
+			// ready gomock
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			tt.injectorForItemRepo(itemRepo)
+
+			// test handler
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := tt.action(h, c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+// newItemForm builds the multipart body sent by POST /items and PUT /items/:itemID.
+func newItemForm(t *testing.T) (*bytes.Buffer, string) {
+	t.Helper()
+	return newItemFormWithImage(t, testPNG(t))
+}
+
+func newItemFormWithImage(t *testing.T, image []byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for k, v := range map[string]string{"name": "item", "category_id": "1", "price": "100", "description": "sample"} {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatalf("failed w.WriteField: %s", err.Error())
+		}
+	}
+	f, err := w.CreateFormFile("image", "image.jpg")
+	if err != nil {
+		t.Fatalf("failed w.CreateFormFile: %s", err.Error())
+	}
+	if _, err := f.Write(image); err != nil {
+		t.Fatalf("failed f.Write: %s", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed w.Close: %s", err.Error())
+	}
+	return body, w.FormDataContentType()
+}
+
+func TestItemOwnership(t *testing.T) {
+	t.Parallel()
+
+	// item 1 is listed by user 1
+	ownItem := func(m *db.MockItemRepository) {
+		m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusInitial}, nil).Times(1)
+	}
+	// category 1, which the form asks for, sits under retired category 2
+	retiredParent := []domain.Category{
+		{ID: 2, Name: "food", RetiredAt: "2023-06-01 00:00:00"},
+		{ID: 1, Name: "snacks", ParentID: 2},
+		{ID: 3, Name: "fashion"},
+	}
+
+	cases := map[string]struct {
+		action              func(*handler.Handler, echo.Context) error
+		method              string
+		json                string
+		userID              int64
+		injectorForItemRepo func(*db.MockItemRepository)
+		wantStatusCode      int
+	}{
+		"200: owner updates the item": {
+			action: (*handler.Handler).UpdateItem,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				ownItem(m)
+				m.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{{ID: 1, Name: "food"}}, nil).Times(1)
+				m.EXPECT().UpdateItem(gomock.Any(), gomock.Any()).Return(domain.Item{ID: 1, UserID: 1}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"400: owner cannot move the item under a retired category": {
+			action: (*handler.Handler).UpdateItem,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, CategoryID: 3, Status: domain.ItemStatusInitial}, nil).Times(1)
+				m.EXPECT().GetCategories(gomock.Any()).Return(retiredParent, nil).Times(1)
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"200: the item stays under a retired category": {
+			action: (*handler.Handler).UpdateItem,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, CategoryID: 1, Status: domain.ItemStatusInitial}, nil).Times(1)
+				m.EXPECT().GetCategories(gomock.Any()).Return(retiredParent, nil).Times(1)
+				m.EXPECT().UpdateItem(gomock.Any(), gomock.Any()).Return(domain.Item{ID: 1, UserID: 1}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"403: other user cannot update the item": {
+			action:              (*handler.Handler).UpdateItem,
+			method:              http.MethodPut,
+			userID:              2,
+			injectorForItemRepo: ownItem,
+			wantStatusCode:      http.StatusForbidden,
+		},
+		"412: a sold item cannot be updated": {
+			action: (*handler.Handler).UpdateItem,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusSoldOut}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"412: a withdrawn item cannot be updated": {
+			action: (*handler.Handler).UpdateItem,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusWithdrawn}, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"200: owner sells the item": {
+			action: (*handler.Handler).Sell,
+			method: http.MethodPost,
+			json:   `{"item_id": 1}`,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				ownItem(m)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusInitial, domain.ItemEventSell).Return(nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"403: other user cannot sell the item": {
+			action:              (*handler.Handler).Sell,
+			method:              http.MethodPost,
+			json:                `{"item_id": 1}`,
+			userID:              2,
+			injectorForItemRepo: ownItem,
+			wantStatusCode:      http.StatusForbidden,
+		},
+		"412: a withdrawn item is relisted instead of sold": {
+			action: (*handler.Handler).Sell,
+			method: http.MethodPost,
+			json:   `{"item_id": 1}`,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1, Status: domain.ItemStatusWithdrawn}, nil).Times(1)
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(1), domain.ItemStatusWithdrawn, domain.ItemEventSell).Return(
+					&domain.ItemStatusTransitionError{From: domain.ItemStatusWithdrawn, To: domain.ItemStatusOnSale}).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"412: sell an item that does not exist": {
+			action: (*handler.Handler).Sell,
+			method: http.MethodPost,
+			json:   `{"item_id": 1}`,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{}, sql.ErrNoRows).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"204: owner deletes the item": {
+			action: (*handler.Handler).DeleteItem,
+			method: http.MethodDelete,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				ownItem(m)
+				m.EXPECT().DeleteItems(gomock.Any(), int64(1)).Return(nil).Times(1)
+			},
+			wantStatusCode: http.StatusNoContent,
+		},
+		"403: other user cannot delete the item": {
+			action:              (*handler.Handler).DeleteItem,
+			method:              http.MethodDelete,
+			userID:              2,
+			injectorForItemRepo: ownItem,
+			wantStatusCode:      http.StatusForbidden,
+		},
+		"204: owner replaces the image": {
+			action: (*handler.Handler).UpdateItemImage,
+			method: http.MethodPut,
+			userID: 1,
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				ownItem(m)
+				m.EXPECT().UpdateItemImage(gomock.Any(), int64(1), domain.ImageFile{ContentType: "image/png", Data: testPNG(t)}).Return(nil).Times(1)
+			},
+			wantStatusCode: http.StatusNoContent,
+		},
+		"403: other user cannot replace the image": {
+			action:              (*handler.Handler).UpdateItemImage,
+			method:              http.MethodPut,
+			userID:              2,
+			injectorForItemRepo: ownItem,
+			wantStatusCode:      http.StatusForbidden,
+		},
+		"403: other user cannot pause the item": {
+			action:              (*handler.Handler).PauseItem,
+			method:              http.MethodPost,
+			userID:              2,
+			injectorForItemRepo: ownItem,
+			wantStatusCode:      http.StatusForbidden,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			var req *http.Request
+			if tt.json != "" {
+				req = httptest.NewRequest(tt.method, "/", bytes.NewBufferString(tt.json))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			} else {
+				body, contentType := newItemForm(t)
+				req = httptest.NewRequest(tt.method, "/", body)
+				req.Header.Set(echo.HeaderContentType, contentType)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: tt.userID}})
+			c.SetParamNames("itemID")
+			c.SetParamValues("1")
+
+			// ready gomock
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			tt.injectorForItemRepo(itemRepo)
+
+			// test handler
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := tt.action(h, c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
 		})
 	}
 }
@@ -406,8 +946,8 @@ func TestSearchItems(t *testing.T) {
 		"200: correctly got items": {
 			url: "/search?name=item",
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().SearchItemsByWord(gomock.Any(), "item").Return([]domain.Item{
-					{
+				m.EXPECT().SearchItems(gomock.Any(), domain.ItemSearchQuery{Word: "item", Sort: domain.ItemSearchSortRelevance}, gomock.Any()).Return([]domain.ItemSearchResult{
+					{Item: domain.Item{
 						ID:          1,
 						Name:        "item1",
 						Price:       0,
@@ -418,8 +958,8 @@ func TestSearchItems(t *testing.T) {
 						Status:      0,
 						CreatedAt:   "",
 						UpdatedAt:   "",
-					},
-					{
+					}},
+					{Item: domain.Item{
 						ID:          3,
 						Name:        "apple_item",
 						Price:       0,
@@ -430,8 +970,8 @@ func TestSearchItems(t *testing.T) {
 						Status:      0,
 						CreatedAt:   "",
 						UpdatedAt:   "",
-					},
-				}, nil).Times(1)
+					}},
+				}, domain.PageInfo{}, nil).Times(1)
 				m.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{
 					{ID: 1, Name: "food"},
 					{ID: 2, Name: "fashion"},
@@ -443,7 +983,7 @@ func TestSearchItems(t *testing.T) {
 		"200: no items": {
 			url: "/search?name=ok",
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().SearchItemsByWord(gomock.Any(), "ok").Return([]domain.Item{}, nil).Times(1)
+				m.EXPECT().SearchItems(gomock.Any(), domain.ItemSearchQuery{Word: "ok", Sort: domain.ItemSearchSortRelevance}, gomock.Any()).Return([]domain.ItemSearchResult{}, domain.PageInfo{}, nil).Times(1)
 				m.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{
 					{ID: 1, Name: "food"},
 					{ID: 2, Name: "fashion"},
@@ -455,16 +995,18 @@ func TestSearchItems(t *testing.T) {
 		"400: failed because of no params": {
 			url: "/search?",
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().SearchItemsByWord(gomock.Any(), "ok").Return([]domain.Item{
+				m.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{{ID: 1, Name: "food"}}, nil).Times(1)
+				m.EXPECT().SearchItems(gomock.Any(), domain.ItemSearchQuery{Word: "ok", Sort: domain.ItemSearchSortRelevance}, gomock.Any()).Return([]domain.ItemSearchResult{
 					{},
-				}, nil).Times(0)
+				}, domain.PageInfo{}, nil).Times(0)
 			},
 			wantStatusCode: http.StatusBadRequest,
 		},
 		"500: internal server error": {
 			url: "/search?name=error",
 			injectorForItemRepo: func(m *db.MockItemRepository) {
-				m.EXPECT().SearchItemsByWord(gomock.Any(), "error").Return(nil, errors.New("server error")).Times(1)
+				m.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{{ID: 1, Name: "food"}}, nil).Times(1)
+				m.EXPECT().SearchItems(gomock.Any(), domain.ItemSearchQuery{Word: "error", Sort: domain.ItemSearchSortRelevance}, gomock.Any()).Return(nil, domain.PageInfo{}, errors.New("server error")).Times(1)
 			},
 			wantStatusCode: http.StatusInternalServerError,
 		},
@@ -504,3 +1046,413 @@ func TestSearchItems(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOnSaleItemsPage(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		url            string
+		injector       func(*db.MockItemRepository)
+		wantNextCursor string
+		wantStatusCode int
+	}{
+		"200: cursor of the next page in the header": {
+			url: "/items?limit=1&cursor=abc",
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().GetOnSaleItems(gomock.Any(), domain.PageRequest{Limit: 1, Cursor: "abc"}).Return([]domain.Item{
+					{ID: 1, Name: "item1", CategoryID: 1},
+				}, domain.PageInfo{NextCursor: "def"}, nil).Times(1)
+			},
+			wantNextCursor: "def",
+			wantStatusCode: http.StatusOK,
+		},
+		"400: invalid cursor": {
+			url: "/items?cursor=abc",
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().GetOnSaleItems(gomock.Any(), gomock.Any()).Return(nil, domain.PageInfo{}, db.ErrInvalidCursor).Times(1)
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"400: invalid limit": {
+			url:            "/items?limit=0",
+			injector:       func(m *db.MockItemRepository) {},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{{ID: 1, Name: "food"}}, nil).Times(1)
+			tt.injector(itemRepo)
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := h.GetOnSaleItems(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			if got := rec.Header().Get(handler.HeaderNextCursor); got != tt.wantNextCursor {
+				t.Fatalf("unexpected next cursor: want: %s, got: %s", tt.wantNextCursor, got)
+			}
+		})
+	}
+}
+
+func TestGetItemNotModified(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		ifModifiedSince string
+		cats            []domain.Category
+		wantStatusCode  int
+	}{
+		"200: no validator":      {wantStatusCode: http.StatusOK},
+		"200: updated since":     {ifModifiedSince: "Wed, 31 May 2023 00:00:00 GMT", wantStatusCode: http.StatusOK},
+		"304: not updated since": {ifModifiedSince: "Sat, 01 Jul 2023 00:00:00 GMT", wantStatusCode: http.StatusNotModified},
+		"200: the parent category is renamed since": {
+			ifModifiedSince: "Sat, 01 Jul 2023 00:00:00 GMT",
+			cats:            []domain.Category{{ID: 2, Name: "groceries", UpdatedAt: "2023-07-02 10:00:00"}, {ID: 1, Name: "food", ParentID: 2}},
+			wantStatusCode:  http.StatusOK,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("itemID")
+			c.SetParamValues("1")
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, CategoryID: 1, UpdatedAt: "2023-06-01 10:00:00"}, nil).Times(1)
+			cats := tt.cats
+			if cats == nil {
+				cats = []domain.Category{{ID: 1, Name: "food"}}
+			}
+			itemRepo.EXPECT().GetCategories(gomock.Any()).Return(cats, nil).Times(1)
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := h.GetItem(c); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			if rec.Header().Get("Last-Modified") == "" {
+				t.Fatalf("Last-Modified is missing")
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		addUserErr     error
+		wantStatusCode int
+	}{
+		"200: registered":            {wantStatusCode: http.StatusOK},
+		"409: name is taken":         {addUserErr: db.ErrUserNameTaken, wantStatusCode: http.StatusConflict},
+		"500: internal server error": {addUserErr: errors.New("strange error"), wantStatusCode: http.StatusInternalServerError},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(`{"name": "Alice", "password": "password"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			userRepo.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(int64(3), tt.addUserErr).Times(1)
+
+			h := &handler.Handler{UserRepo: userRepo}
+			if err := h.Register(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed bcrypt.GenerateFromPassword: %s", err.Error())
+	}
+	alice := domain.User{ID: 1, Name: "alice", Password: string(hash)}
+
+	cases := map[string]struct {
+		body                string
+		injectorForUserRepo func(*db.MockUserRepository)
+		lockout             time.Duration
+		totpEnabled         bool
+		wantAccountKey      string
+		wantOutcome         domain.LoginOutcome
+		wantStatusCode      int
+	}{
+		"200: by name ignoring case": {
+			body: `{"name": "ALICE", "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUserByName(gomock.Any(), "ALICE").Return(alice, nil).Times(1)
+			},
+			wantAccountKey: "user:1",
+			wantOutcome:    domain.LoginSucceeded,
+			wantStatusCode: http.StatusOK,
+		},
+		"200: by user id": {
+			body: `{"user_id": 1, "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUser(gomock.Any(), int64(1)).Return(alice, nil).Times(1)
+			},
+			wantAccountKey: "user:1",
+			wantOutcome:    domain.LoginSucceeded,
+			wantStatusCode: http.StatusOK,
+		},
+		"200: challenged for the authenticator": {
+			body: `{"name": "alice", "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUserByName(gomock.Any(), "alice").Return(alice, nil).Times(1)
+			},
+			totpEnabled:    true,
+			wantAccountKey: "user:1",
+			wantOutcome:    domain.LoginChallenged,
+			wantStatusCode: http.StatusOK,
+		},
+		"401: wrong password": {
+			body: `{"name": "alice", "password": "wrong"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUserByName(gomock.Any(), "alice").Return(alice, nil).Times(1)
+			},
+			wantAccountKey: "user:1",
+			wantOutcome:    domain.LoginFailed,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		"401: unknown name": {
+			body: `{"name": "Carol", "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUserByName(gomock.Any(), "Carol").Return(domain.User{}, sql.ErrNoRows).Times(1)
+			},
+			wantAccountKey: "name:carol",
+			wantOutcome:    domain.LoginFailed,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		"401: unknown user id": {
+			body: `{"user_id": 99, "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUser(gomock.Any(), int64(99)).Return(domain.User{}, sql.ErrNoRows).Times(1)
+			},
+			wantAccountKey: "id:99",
+			wantOutcome:    domain.LoginFailed,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		"429: locked out with the right password": {
+			body: `{"name": "alice", "password": "password"}`,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().GetUserByName(gomock.Any(), "alice").Return(alice, nil).Times(1)
+			},
+			lockout:        30 * time.Second,
+			wantAccountKey: "user:1",
+			wantOutcome:    domain.LoginLocked,
+			wantStatusCode: http.StatusTooManyRequests,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			tt.injectorForUserRepo(userRepo)
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			loginRepo := db.NewMockLoginRepository(ctrl)
+			loginRepo.EXPECT().GetLockout(gomock.Any(), tt.wantAccountKey, "ip:192.0.2.1").Return(tt.lockout, nil).Times(1)
+			loginRepo.EXPECT().AddLoginAttempt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, attempt domain.LoginAttempt) error {
+				if attempt.Outcome != tt.wantOutcome || attempt.IP != "192.0.2.1" {
+					t.Fatalf("unexpected attempt: %+v", attempt)
+				}
+				return nil
+			}).Times(1)
+			totpRepo := db.NewMockTOTPRepository(ctrl)
+			switch tt.wantOutcome {
+			case domain.LoginChallenged:
+				totpRepo.EXPECT().GetTOTP(gomock.Any(), alice.ID).Return(domain.TOTP{UserID: alice.ID, EnabledAt: "2023-06-01 00:00:00"}, nil).Times(1)
+			case domain.LoginSucceeded:
+				totpRepo.EXPECT().GetTOTP(gomock.Any(), alice.ID).Return(domain.TOTP{}, sql.ErrNoRows).Times(1)
+				loginRepo.EXPECT().ResetLoginFailures(gomock.Any(), tt.wantAccountKey).Return(nil).Times(1)
+				sessionRepo.EXPECT().AddSession(gomock.Any(), alice.ID, time.Hour).Return(domain.Session{ID: "session", UserID: alice.ID}, "refresh", nil).Times(1)
+			case domain.LoginFailed:
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), tt.wantAccountKey, handler.DefaultAccountThrottle).Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "ip:192.0.2.1", handler.DefaultIPThrottle).Return(time.Duration(0), nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{
+				UserRepo:        userRepo,
+				SessionRepo:     sessionRepo,
+				LoginRepo:       loginRepo,
+				TOTPRepo:        totpRepo,
+				Tx:              tx,
+				AccessTokenTTL:  time.Minute,
+				RefreshTokenTTL: time.Hour,
+				Keys:            testKeys,
+				AccountThrottle: handler.DefaultAccountThrottle,
+				IPThrottle:      handler.DefaultIPThrottle,
+			}
+			if err := h.Login(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				// unknown users cannot be told from wrong passwords
+				if echoErr.Code == http.StatusUnauthorized && echoErr.Message != "invalid user or password" {
+					t.Fatalf("unexpected message: %v", echoErr.Message)
+				}
+				if echoErr.Code == http.StatusTooManyRequests && rec.Header().Get(echo.HeaderRetryAfter) != "30" {
+					t.Fatalf("unexpected Retry-After: %s", rec.Header().Get(echo.HeaderRetryAfter))
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			var resp struct {
+				ID             int64  `json:"id"`
+				Token          string `json:"token"`
+				ExpiresIn      int64  `json:"expires_in"`
+				RefreshToken   string `json:"refresh_token"`
+				TOTPRequired   bool   `json:"totp_required"`
+				ChallengeToken string `json:"challenge_token"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if tt.totpEnabled {
+				// no session before the code of the authenticator
+				if resp.ID != alice.ID || resp.Token != "" || !resp.TOTPRequired || resp.ChallengeToken == "" || resp.ExpiresIn != 300 {
+					t.Fatalf("unexpected response: %s", rec.Body.String())
+				}
+				return
+			}
+			if resp.ID != alice.ID || resp.Token == "" || resp.ExpiresIn != 60 || resp.RefreshToken != "refresh" {
+				t.Fatalf("unexpected response: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetNameAvailability(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		name           string
+		getUserErr     error
+		wantStatusCode int
+		wantAvailable  bool
+	}{
+		"200: available": {name: "carol", getUserErr: sql.ErrNoRows, wantStatusCode: http.StatusOK, wantAvailable: true},
+		"200: taken":     {name: "Alice", wantStatusCode: http.StatusOK},
+		"400: no name":   {wantStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/register/available?name="+tt.name, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			if tt.name != "" {
+				userRepo.EXPECT().GetUserByName(gomock.Any(), tt.name).Return(domain.User{ID: 1, Name: "alice"}, tt.getUserErr).Times(1)
+			}
+
+			h := &handler.Handler{UserRepo: userRepo}
+			if err := h.GetNameAvailability(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			var resp struct {
+				Available bool `json:"available"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if tt.wantAvailable != resp.Available {
+				t.Fatalf("unexpected availability: want: %t, got: %t", tt.wantAvailable, resp.Available)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+type itemImageResponse struct {
+	ID       int64 `json:"id"`
+	Position int64 `json:"position"`
+}
+
+type reorderItemImagesRequest struct {
+	IDs []int64 `json:"ids" validate:"required"`
+}
+
+// GetItemImages lists the images of an item in display order. The first one is the cover.
+func (h *Handler) GetItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	images, err := h.ItemRepo.GetItemImages(ctx, itemID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	// every item keeps at least one image
+	if len(images) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "item not found")
+	}
+
+	res := make([]itemImageResponse, 0, len(images))
+	for _, img := range images {
+		res = append(res, itemImageResponse{ID: img.ID, Position: img.Position})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetImageByIndex serves the image at the index in display order. Index 0 is the cover.
+func (h *Handler) GetImageByIndex(c echo.Context) error {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	index, err := strconv.ParseInt(c.Param("index"), 10, 64)
+	if err != nil || index < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid index")
+	}
+
+	return h.serveItemImage(c, itemID, index)
+}
+
+// serveItemImage answers conditional requests before touching the blob store,
+// and streams the image with Range support.
+func (h *Handler) serveItemImage(c echo.Context, itemID, index int64) error {
+	ctx := c.Request().Context()
+
+	width, err := getImageWidth(c)
+	if err != nil {
+		return err
+	}
+
+	img, err := h.ItemRepo.GetItemImageInfo(ctx, itemID, index)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	header := c.Response().Header()
+	etag := imageETag(img, width)
+	header.Set("ETag", etag)
+	header.Set(echo.HeaderCacheControl, imageCacheControl)
+	modified := setLastModified(c, img.UpdatedAt)
+	if notModified(c.Request(), etag, modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	f, err := h.ItemRepo.OpenItemImage(ctx, img, width)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("failed f.Close: %s", err.Error())
+		}
+	}()
+
+	// variants may change the type, so ServeContent sniffs it
+	if width == 0 {
+		header.Set(echo.HeaderContentType, img.ContentType)
+	}
+	http.ServeContent(c.Response(), c.Request(), "", modified, f)
+	return nil
+}
+
+// getImageWidth reads the size query parameter. It is 0 for the original image.
+func getImageWidth(c echo.Context) (int, error) {
+	size := c.QueryParam("size")
+	if size == "" {
+		return 0, nil
+	}
+	width, err := strconv.Atoi(size)
+	if err == nil {
+		for _, w := range domain.ImageVariantWidths {
+			if w == width {
+				return width, nil
+			}
+		}
+	}
+	return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("size must be one of %v", domain.ImageVariantWidths))
+}
+
+// AddItemImage appends an image to an item.
+func (h *Handler) AddItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := h.ownedItemID(c)
+	if err != nil {
+		return err
+	}
+
+	image, err := getImage(c)
+	if err != nil {
+		return err
+	}
+
+	img, err := h.ItemRepo.AddItemImage(ctx, itemID, image)
+	if err != nil {
+		return itemImageError(err)
+	}
+
+	return c.JSON(http.StatusOK, itemImageResponse{ID: img.ID, Position: img.Position})
+}
+
+// ReorderItemImages sets the display order of the images. ids must list every image of the item.
+func (h *Handler) ReorderItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := h.ownedItemID(c)
+	if err != nil {
+		return err
+	}
+
+	req := new(reorderItemImagesRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.ReorderItemImages(ctx, itemID, req.IDs); err != nil {
+		return itemImageError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetItemCover moves an image to the front. The others keep their relative order.
+func (h *Handler) SetItemCover(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := h.ownedItemID(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid imageID type")
+	}
+
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		images, err := h.ItemRepo.GetItemImages(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		ids := []int64{imageID}
+		found := false
+		for _, img := range images {
+			if img.ID == imageID {
+				found = true
+				continue
+			}
+			ids = append(ids, img.ID)
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+		return h.ItemRepo.ReorderItemImages(ctx, itemID, ids)
+	})
+	if err != nil {
+		return itemImageError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteItemImage removes one image. The last image of an item cannot be removed.
+func (h *Handler) DeleteItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := h.ownedItemID(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid imageID type")
+	}
+
+	if err := h.ItemRepo.DeleteItemImage(ctx, itemID, imageID); err != nil {
+		return itemImageError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ownedItemID reads itemID from the path and checks the user owns the item.
+func (h *Handler) ownedItemID(c echo.Context) (int64, error) {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if _, err := h.authorizeItemOwner(c.Request().Context(), userID, itemID); err != nil {
+		return 0, err
+	}
+	return itemID, nil
+}
+
+func itemImageError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "image not found")
+	}
+	return toHTTPError(err)
+}
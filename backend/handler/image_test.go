@@ -0,0 +1,285 @@
+package handler_test
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSetItemCover(t *testing.T) {
+	t.Parallel()
+	images := []domain.ItemImage{{ID: 5, Position: 0}, {ID: 6, Position: 1}, {ID: 7, Position: 2}}
+	cases := map[string]struct {
+		userID         int64
+		imageID        string
+		wantOrder      []int64
+		wantStatusCode int
+	}{
+		"204: move to the front":  {userID: 1, imageID: "7", wantOrder: []int64{7, 5, 6}, wantStatusCode: http.StatusNoContent},
+		"204: already the cover":  {userID: 1, imageID: "5", wantOrder: []int64{5, 6, 7}, wantStatusCode: http.StatusNoContent},
+		"403: not the owner":      {userID: 2, imageID: "7", wantStatusCode: http.StatusForbidden},
+		"404: image of elsewhere": {userID: 1, imageID: "9", wantStatusCode: http.StatusNotFound},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/items/1/images/"+tt.imageID+"/cover", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("itemID", "imageID")
+			c.SetParamValues("1", tt.imageID)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: tt.userID}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1}, nil).Times(1)
+			itemRepo.EXPECT().GetItemImages(gomock.Any(), int64(1)).Return(images, nil).AnyTimes()
+			if tt.wantOrder != nil {
+				itemRepo.EXPECT().ReorderItemImages(gomock.Any(), int64(1), tt.wantOrder).Return(nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{ItemRepo: itemRepo, Tx: tx}
+			if err := h.SetItemCover(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestItemImageErrors(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		call           func(h *handler.Handler, c echo.Context) error
+		body           string
+		injector       func(*db.MockItemRepository)
+		wantStatusCode int
+	}{
+		"412: too many images": {
+			call: (*handler.Handler).AddItemImage,
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().AddItemImage(gomock.Any(), int64(1), gomock.Any()).Return(domain.ItemImage{}, db.ErrTooManyItemImages).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"400: ids are not the images of the item": {
+			call: (*handler.Handler).ReorderItemImages,
+			body: `{"ids": [2, 1]}`,
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().ReorderItemImages(gomock.Any(), int64(1), []int64{2, 1}).Return(db.ErrItemImageSetMismatch).Times(1)
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"412: last image": {
+			call: (*handler.Handler).DeleteItemImage,
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().DeleteItemImage(gomock.Any(), int64(1), int64(3)).Return(db.ErrLastItemImage).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"404: unknown image": {
+			call: (*handler.Handler).DeleteItemImage,
+			injector: func(m *db.MockItemRepository) {
+				m.EXPECT().DeleteItemImage(gomock.Any(), int64(1), int64(3)).Return(sql.ErrNoRows).Times(1)
+			},
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, contentType := newItemForm(t)
+			if tt.body != "" {
+				body, contentType = bytes.NewBufferString(tt.body), echo.MIMEApplicationJSON
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("itemID", "imageID")
+			c.SetParamValues("1", "3")
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1}, nil).Times(1)
+			tt.injector(itemRepo)
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			err := tt.call(h, c)
+			echoErr, ok := err.(*echo.HTTPError)
+			if !ok || echoErr.Code != tt.wantStatusCode {
+				t.Fatalf("unexpected error: want: %d, got: %v", tt.wantStatusCode, err)
+			}
+		})
+	}
+}
+
+func TestGetImageByIndex(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/items/1/images/4", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("itemID", "index")
+	c.SetParamValues("1", "4")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().GetItemImageInfo(gomock.Any(), int64(1), int64(4)).Return(domain.ItemImage{}, db.ErrBlobNotFound).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	err := h.GetImageByIndex(c)
+	echoErr, ok := err.(*echo.HTTPError)
+	if !ok || echoErr.Code != http.StatusNotFound {
+		t.Fatalf("unexpected error: want: 404, got: %v", err)
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	t.Parallel()
+	img := domain.ItemImage{ID: 1, ItemID: 1, BlobKey: "items/1/a.png", ContentType: "image/png", UpdatedAt: "2023-06-01 10:00:00"}
+	open := func(width int) func(*db.MockItemRepository) {
+		return func(m *db.MockItemRepository) {
+			m.EXPECT().OpenItemImage(gomock.Any(), img, width).Return(nopCloser{bytes.NewReader([]byte("0123456789"))}, nil).Times(1)
+		}
+	}
+	cases := map[string]struct {
+		query          string
+		header         map[string]string
+		injector       func(*db.MockItemRepository)
+		wantBody       string
+		wantStatusCode int
+	}{
+		"200: original":             {injector: open(0), wantBody: "0123456789", wantStatusCode: http.StatusOK},
+		"200: variant":              {query: "?size=400", injector: open(400), wantBody: "0123456789", wantStatusCode: http.StatusOK},
+		"200: changed since":        {header: map[string]string{"If-Modified-Since": "Wed, 31 May 2023 00:00:00 GMT"}, injector: open(0), wantBody: "0123456789", wantStatusCode: http.StatusOK},
+		"200: other etag":           {header: map[string]string{"If-None-Match": `"other"`}, injector: open(0), wantBody: "0123456789", wantStatusCode: http.StatusOK},
+		"206: range":                {header: map[string]string{"Range": "bytes=2-4"}, injector: open(0), wantBody: "234", wantStatusCode: http.StatusPartialContent},
+		"304: not modified since":   {header: map[string]string{"If-Modified-Since": "Sat, 01 Jul 2023 00:00:00 GMT"}, injector: func(*db.MockItemRepository) {}, wantStatusCode: http.StatusNotModified},
+		"400: unsupported size":     {query: "?size=300", wantStatusCode: http.StatusBadRequest},
+		"400: size is not a number": {query: "?size=large", wantStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/items/1/image"+tt.query, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("itemID")
+			c.SetParamValues("1")
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			if tt.injector != nil {
+				itemRepo.EXPECT().GetItemImageInfo(gomock.Any(), int64(1), int64(0)).Return(img, nil).Times(1)
+				tt.injector(itemRepo)
+			}
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := h.GetImage(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Fatalf("unexpected body: want: %q, got: %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestGetImageETag sends back the ETag of a first response.
+func TestGetImageETag(t *testing.T) {
+	t.Parallel()
+	img := domain.ItemImage{ID: 1, ItemID: 1, BlobKey: "items/1/a.png", ContentType: "image/png", UpdatedAt: "2023-06-01 10:00:00"}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().GetItemImageInfo(gomock.Any(), int64(1), int64(0)).Return(img, nil).Times(2)
+	itemRepo.EXPECT().OpenItemImage(gomock.Any(), img, 0).Return(nopCloser{bytes.NewReader([]byte("png"))}, nil).Times(1)
+	h := &handler.Handler{ItemRepo: itemRepo}
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/items/1/image", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("itemID")
+		c.SetParamValues("1")
+		if err := h.GetImage(c); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		return rec
+	}
+
+	first := get("")
+	if first.Code != http.StatusOK || first.Header().Get("Content-Type") != "image/png" || first.Header().Get("Cache-Control") == "" {
+		t.Fatalf("unexpected response: %d %v", first.Code, first.Header())
+	}
+	if second := get(first.Header().Get("ETag")); second.Code != http.StatusNotModified {
+		t.Fatalf("unexpected status code: want: 304, got: %d", second.Code)
+	}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// DevSecret is the HS256 secret of dev mode. The server refuses to sign with it otherwise.
+const DevSecret = "secret-key"
+
+const (
+	minRSABits       = 2048
+	jwksCacheControl = "public, max-age=300"
+)
+
+// jwtKey verifies tokens, and signs them too when the private key is known.
+type jwtKey struct {
+	id       string
+	method   jwt.SigningMethod
+	signer   any
+	verifier any
+}
+
+// Keyset signs tokens with one key and verifies them with any of its keys, so the tokens
+// signed with the previous key keep working while a new key takes over.
+type Keyset struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are set for RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are set for Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+// NewSecretKeyset signs and verifies with an HS256 secret, which is not published in the JWKS.
+func NewSecretKeyset(secret string) *Keyset {
+	key := &jwtKey{id: "hs256", method: jwt.SigningMethodHS256, signer: []byte(secret), verifier: []byte(secret)}
+	return &Keyset{signing: key, keys: map[string]*jwtKey{key.id: key}}
+}
+
+// LoadKeyset reads the PEM files <kid>.pem in dir. PKCS#8 or PKCS#1 private keys, RSA of at
+// least 2048 bits or Ed25519, can sign. PKIX public keys only verify, which keeps a retired key
+// accepting tokens until they expire. The key signingID signs, by default the private key
+// whose kid sorts last, so naming them by date picks the newest.
+func LoadKeyset(dir, signingID string) (*Keyset, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	ks := &Keyset{keys: make(map[string]*jwtKey, len(paths))}
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", path)
+		}
+		ks.keys[key.id] = key
+		if key.signer != nil && (signingID == "" || key.id == signingID) {
+			ks.signing = key
+		}
+	}
+
+	if ks.signing == nil {
+		if signingID != "" {
+			return nil, errors.Errorf("no private key %s.pem in %s", signingID, dir)
+		}
+		return nil, errors.Errorf("no private key in %s", dir)
+	}
+	return ks, nil
+}
+
+func readKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("not a PEM file")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.signer = signer
+		parsed = signer.Public()
+	}
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, errors.Errorf("RSA key has %d bits, at least %d are needed", pub.N.BitLen(), minRSABits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.Errorf("unsupported key type %T", pub)
+	}
+	key.verifier = parsed
+	return key, nil
+}
+
+// Sign signs the claims with the signing key, naming it in the kid header.
+func (ks *Keyset) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.signer)
+}
+
+// Keyfunc picks the key named by the kid header. The algorithm has to be the one of the key,
+// so a public key can never be used as an HMAC secret.
+func (ks *Keyset) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.Errorf("key %q is not for %s", kid, token.Method.Alg())
+	}
+	return key.verifier, nil
+}
+
+// Methods are the algorithms of the keys.
+func (ks *Keyset) Methods() []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// JWKS lists the public keys, in the order of their kids.
+func (ks *Keyset) JWKS() jwksResponse {
+	res := jwksResponse{Keys: []jwk{}}
+	for _, key := range ks.keys {
+		k := jwk{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+		switch pub := key.verifier.(type) {
+		case *rsa.PublicKey:
+			k.KeyType = "RSA"
+			k.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			k.KeyType = "OKP"
+			k.Curve = "Ed25519"
+			k.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			// secrets are not published
+			continue
+		}
+		res.Keys = append(res.Keys, k)
+	}
+	sort.Slice(res.Keys, func(i, j int) bool { return res.Keys[i].KeyID < res.Keys[j].KeyID })
+	return res
+}
+
+// GetJWKS publishes the public keys, so other services can verify our tokens.
+func (h *Handler) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, jwksCacheControl)
+	return c.JSON(http.StatusOK, h.Keys.JWKS())
+}
@@ -0,0 +1,173 @@
+package handler_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatalf("failed os.WriteFile: %s", err.Error())
+	}
+}
+
+func TestKeysetRotation(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed ed25519.GenerateKey: %s", err.Error())
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("failed x509.MarshalPKCS8PrivateKey: %s", err.Error())
+	}
+	writePEM(t, dir, "2023-05-01", "PRIVATE KEY", edDER)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed rsa.GenerateKey: %s", err.Error())
+	}
+	writePEM(t, dir, "2023-06-01", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	claims := &handler.JwtCustomClaims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+	sign := func(ks *handler.Keyset) string {
+		token, err := ks.Sign(claims)
+		if err != nil {
+			t.Fatalf("failed Sign: %s", err.Error())
+		}
+		return token
+	}
+	verify := func(ks *handler.Keyset, token string) (string, error) {
+		parsed, err := jwt.ParseWithClaims(token, new(handler.JwtCustomClaims), ks.Keyfunc, jwt.WithValidMethods(ks.Methods()))
+		if err != nil {
+			return "", err
+		}
+		return parsed.Method.Alg(), nil
+	}
+
+	// the Ed25519 key signs until the RSA key takes over
+	old, err := handler.LoadKeyset(dir, "2023-05-01")
+	if err != nil {
+		t.Fatalf("failed LoadKeyset: %s", err.Error())
+	}
+	oldToken := sign(old)
+
+	// by default the last kid signs, and the previous key still verifies
+	current, err := handler.LoadKeyset(dir, "")
+	if err != nil {
+		t.Fatalf("failed LoadKeyset: %s", err.Error())
+	}
+	newToken := sign(current)
+	if alg, err := verify(current, newToken); err != nil || alg != "RS256" {
+		t.Fatalf("unexpected new token: %s, %v", alg, err)
+	}
+	if alg, err := verify(current, oldToken); err != nil || alg != "EdDSA" {
+		t.Fatalf("unexpected old token: %s, %v", alg, err)
+	}
+
+	// a retired key is kept as a public key only
+	pubDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatalf("failed x509.MarshalPKIXPublicKey: %s", err.Error())
+	}
+	writePEM(t, dir, "2023-05-01", "PUBLIC KEY", pubDER)
+	if _, err := handler.LoadKeyset(dir, "2023-05-01"); err == nil {
+		t.Fatalf("a public key is used to sign")
+	}
+	retired, err := handler.LoadKeyset(dir, "")
+	if err != nil {
+		t.Fatalf("failed LoadKeyset: %s", err.Error())
+	}
+	if _, err := verify(retired, oldToken); err != nil {
+		t.Fatalf("the retired key does not verify: %s", err.Error())
+	}
+
+	// the RSA public key used as an HMAC secret
+	rsaPubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed x509.MarshalPKIXPublicKey: %s", err.Error())
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "2023-06-01"
+	forgedToken, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPubDER}))
+	if err != nil {
+		t.Fatalf("failed SignedString: %s", err.Error())
+	}
+	if _, err := verify(retired, forgedToken); err == nil {
+		t.Fatalf("the forged token is accepted")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "2023-05-01.pem")); err != nil {
+		t.Fatalf("failed os.Remove: %s", err.Error())
+	}
+	removed, err := handler.LoadKeyset(dir, "")
+	if err != nil {
+		t.Fatalf("failed LoadKeyset: %s", err.Error())
+	}
+	if _, err := verify(removed, oldToken); err == nil {
+		t.Fatalf("the removed key verifies")
+	}
+
+	// the JWKS has both keys while they overlap
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	if err := (&handler.Handler{Keys: current}).GetJWKS(e.NewContext(httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil), rec)); err != nil {
+		t.Fatalf("failed GetJWKS: %s", err.Error())
+	}
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("unexpected keys: %s", rec.Body.String())
+	}
+	if k := jwks.Keys[0]; k["kid"] != "2023-05-01" || k["kty"] != "OKP" || k["alg"] != "EdDSA" || k["x"] != base64.RawURLEncoding.EncodeToString(edPub) {
+		t.Fatalf("unexpected Ed25519 key: %v", k)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(jwks.Keys[1]["n"])
+	if err != nil {
+		t.Fatalf("failed to decode n: %s", err.Error())
+	}
+	if k := jwks.Keys[1]; k["kid"] != "2023-06-01" || k["kty"] != "RSA" || k["alg"] != "RS256" || k["e"] != "AQAB" || new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 {
+		t.Fatalf("unexpected RSA key: %v", k)
+	}
+}
+
+func TestLoadKeysetRejectsWeakKeys(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed rsa.GenerateKey: %s", err.Error())
+	}
+	writePEM(t, dir, "weak", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	if _, err := handler.LoadKeyset(dir, ""); err == nil {
+		t.Fatalf("a 1024 bit RSA key is loaded")
+	}
+	if _, err := handler.LoadKeyset(t.TempDir(), ""); err == nil {
+		t.Fatalf("an empty directory is loaded")
+	}
+}
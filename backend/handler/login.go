@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// DefaultAccountThrottle is used when LOGIN_MAX_FAILURES is not set.
+	DefaultAccountThrottle = domain.LoginThrottle{MaxFailures: 5, Lockout: time.Minute, MaxLockout: time.Hour, Window: 15 * time.Minute}
+	// DefaultIPThrottle is used when LOGIN_MAX_IP_FAILURES is not set. It allows more,
+	// since many users can share an address.
+	DefaultIPThrottle = domain.LoginThrottle{MaxFailures: 50, Lockout: time.Minute, MaxLockout: time.Hour, Window: 15 * time.Minute}
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash is checked for unknown users, so that they take as long as wrong passwords.
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// loginKeys are the keys failed logins are counted by. Names and ids no user has are
+// counted too, so that they are locked out like accounts and cannot be told from them.
+func loginKeys(req *loginRequest, user domain.User, ip string) (account string, client string) {
+	switch {
+	case user.ID != 0:
+		account = "user:" + strconv.FormatInt(user.ID, 10)
+	case req.Name != "":
+		account = "name:" + strings.ToLower(req.Name)
+	default:
+		account = "id:" + strconv.FormatInt(req.UserID, 10)
+	}
+	return account, "ip:" + ip
+}
+
+func loginIdentifier(req *loginRequest) string {
+	if req.Name != "" {
+		return req.Name
+	}
+	return strconv.FormatInt(req.UserID, 10)
+}
+
+// invalidLogin is the answer to unknown users and wrong passwords alike.
+func invalidLogin() error {
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid user or password")
+}
+
+// checkLockout rejects the attempt with 429 and Retry-After while the account or the client is locked out.
+func (h *Handler) checkLockout(c echo.Context, attempt domain.LoginAttempt, keys ...string) error {
+	ctx := c.Request().Context()
+
+	lockout, err := h.LoginRepo.GetLockout(ctx, keys...)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if lockout == 0 {
+		return nil
+	}
+
+	attempt.Outcome = domain.LoginLocked
+	if err := h.LoginRepo.AddLoginAttempt(ctx, attempt); err != nil {
+		return toHTTPError(err)
+	}
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(int64(lockout.Seconds()), 10))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed logins, try again later")
+}
+
+// recordLoginFailure counts the failure against the account and the client, locking them out when they have failed too often.
+func (h *Handler) recordLoginFailure(ctx context.Context, attempt domain.LoginAttempt, accountKey, clientKey string) error {
+	attempt.Outcome = domain.LoginFailed
+	err := h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		for key, throttle := range map[string]domain.LoginThrottle{accountKey: h.AccountThrottle, clientKey: h.IPThrottle} {
+			lockout, err := h.LoginRepo.AddLoginFailure(ctx, key, throttle)
+			if err != nil {
+				return err
+			}
+			if lockout > 0 {
+				log.Printf("locked out %s for %s after a failed login of %q from %s", key, lockout, attempt.Identifier, attempt.IP)
+			}
+		}
+		return h.LoginRepo.AddLoginAttempt(ctx, attempt)
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultEscrowTimeout is used when ESCROW_TIMEOUT is not set.
+const DefaultEscrowTimeout = 14 * 24 * time.Hour
+
+type orderResponse struct {
+	ID        int64              `json:"id"`
+	ItemID    int64              `json:"item_id"`
+	BuyerID   int64              `json:"buyer_id"`
+	SellerID  int64              `json:"seller_id"`
+	Price     int64              `json:"price"`
+	Status    domain.OrderStatus `json:"status"`
+	CreatedAt string             `json:"created_at"`
+	UpdatedAt string             `json:"updated_at"`
+}
+
+func convertToOrderResponse(order domain.Order) orderResponse {
+	return orderResponse{
+		ID:        order.ID,
+		ItemID:    order.ItemID,
+		BuyerID:   order.BuyerID,
+		SellerID:  order.SellerID,
+		Price:     order.Price,
+		Status:    order.Status,
+		CreatedAt: order.CreatedAt,
+		UpdatedAt: order.UpdatedAt,
+	}
+}
+
+func (h *Handler) GetOrders(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	page, err := getPageRequest(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	orders, info, err := h.OrderRepo.GetOrdersByUserID(ctx, userID, page)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	setPageHeaders(c, info)
+
+	res := make([]orderResponse, len(orders))
+	for i, order := range orders {
+		res[i] = convertToOrderResponse(order)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	order, err := h.getOrder(ctx, c)
+	if err != nil {
+		return err
+	}
+	if order.BuyerID != userID && order.SellerID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "not a party to this order")
+	}
+
+	return c.JSON(http.StatusOK, convertToOrderResponse(order))
+}
+
+// ShipOrder is called by the seller after sending the item.
+func (h *Handler) ShipOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	var res domain.Order
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		order, err := h.getOrder(ctx, c)
+		if err != nil {
+			return err
+		}
+		if order.SellerID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "only the seller can ship the order")
+		}
+		if err := h.updateOrderStatus(ctx, order, domain.OrderStatusReserved, domain.OrderStatusShipped); err != nil {
+			return err
+		}
+		res, err = h.OrderRepo.GetOrder(ctx, order.ID)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToOrderResponse(res))
+}
+
+// DeliverOrder is called by the seller when the carrier reports the item delivered.
+// The buyer then has EscrowTimeout to confirm receipt or raise a problem.
+func (h *Handler) DeliverOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	var res domain.Order
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		order, err := h.getOrder(ctx, c)
+		if err != nil {
+			return err
+		}
+		if order.SellerID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "only the seller can report the delivery")
+		}
+		if err := h.updateOrderStatus(ctx, order, domain.OrderStatusShipped, domain.OrderStatusDelivered); err != nil {
+			return err
+		}
+		res, err = h.OrderRepo.GetOrder(ctx, order.ID)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToOrderResponse(res))
+}
+
+// ReceiveOrder is called by the buyer to confirm receipt, which releases the escrow to the seller.
+// The buyer does not have to wait for DeliverOrder.
+func (h *Handler) ReceiveOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	var res domain.Order
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		order, err := h.getOrder(ctx, c)
+		if err != nil {
+			return err
+		}
+		if order.BuyerID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "only the buyer can confirm receipt")
+		}
+		if err := h.completeOrder(ctx, order); err != nil {
+			return err
+		}
+		res, err = h.OrderRepo.GetOrder(ctx, order.ID)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToOrderResponse(res))
+}
+
+// CancelOrder refunds the buyer and puts the item back on sale.
+// Either party can cancel until the item has been shipped.
+func (h *Handler) CancelOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	var res domain.Order
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		order, err := h.getOrder(ctx, c)
+		if err != nil {
+			return err
+		}
+		if order.BuyerID != userID && order.SellerID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "not a party to this order")
+		}
+		if err := h.cancelOrder(ctx, order); err != nil {
+			return err
+		}
+		res, err = h.OrderRepo.GetOrder(ctx, order.ID)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, convertToOrderResponse(res))
+}
+
+// ReleaseExpiredOrders settles the orders that have waited longer than EscrowTimeout.
+// Orders the seller never shipped are cancelled and refunded to the buyer; shipped
+// and delivered orders whose buyer never confirmed receipt pay out their sellers.
+func (h *Handler) ReleaseExpiredOrders(ctx context.Context) error {
+	settle := map[domain.OrderStatus]func(context.Context, domain.Order) error{
+		domain.OrderStatusReserved:  h.cancelOrder,
+		domain.OrderStatusShipped:   h.completeOrder,
+		domain.OrderStatusDelivered: h.completeOrder,
+	}
+	for _, status := range []domain.OrderStatus{domain.OrderStatusReserved, domain.OrderStatusShipped, domain.OrderStatusDelivered} {
+		orders, err := h.OrderRepo.GetOrdersNotUpdatedSince(ctx, status, h.EscrowTimeout)
+		if err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			order := order
+			err := h.Tx.Transaction(ctx, func(ctx context.Context) error {
+				return settle[status](ctx, order)
+			})
+			if err != nil {
+				// a party may have acted or the order may have changed meanwhile
+				log.Printf("failed to release order %d: %s", order.ID, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// completeOrder completes a shipped or delivered order and pays the seller.
+func (h *Handler) completeOrder(ctx context.Context, order domain.Order) error {
+	from := domain.OrderStatusDelivered
+	if order.Status == domain.OrderStatusShipped {
+		from = domain.OrderStatusShipped
+	}
+	if err := h.updateOrderStatus(ctx, order, from, domain.OrderStatusCompleted); err != nil {
+		return err
+	}
+	if err := h.UserRepo.CreditBalance(ctx, domain.LedgerEntry{
+		UserID: order.SellerID,
+		Type:   domain.LedgerEntrySale,
+		Amount: order.Price,
+		ItemID: order.ItemID,
+	}); err != nil {
+		return toHTTPError(err)
+	}
+	return nil
+}
+
+// cancelOrder cancels a reserved order, refunds the buyer and puts the item back on sale.
+func (h *Handler) cancelOrder(ctx context.Context, order domain.Order) error {
+	if err := h.updateOrderStatus(ctx, order, domain.OrderStatusReserved, domain.OrderStatusCancelled); err != nil {
+		return err
+	}
+	if err := h.UserRepo.CreditBalance(ctx, domain.LedgerEntry{
+		UserID: order.BuyerID,
+		Type:   domain.LedgerEntryRefund,
+		Amount: order.Price,
+		ItemID: order.ItemID,
+	}); err != nil {
+		return toHTTPError(err)
+	}
+	if err := h.ItemRepo.UpdateItemStatus(ctx, order.ItemID, domain.ItemStatusSoldOut, domain.ItemEventCancelOrder); err != nil {
+		return toHTTPError(err)
+	}
+	return nil
+}
+
+func (h *Handler) getOrder(ctx context.Context, c echo.Context) (domain.Order, error) {
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return domain.Order{}, echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+
+	order, err := h.OrderRepo.GetOrder(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Order{}, echo.NewHTTPError(http.StatusNotFound, err)
+		}
+		return domain.Order{}, toHTTPError(err)
+	}
+	return order, nil
+}
+
+func (h *Handler) updateOrderStatus(ctx context.Context, order domain.Order, from, to domain.OrderStatus) error {
+	if order.Status != from {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("order is in status %d", order.Status))
+	}
+	if err := h.OrderRepo.UpdateOrderStatus(ctx, order.ID, from, to); err != nil {
+		return toHTTPError(err)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package handler_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	t.Parallel()
+
+	reserved := domain.Order{ID: 1, ItemID: 10, BuyerID: 1, SellerID: 2, Price: 300, Status: domain.OrderStatusReserved}
+	shipped := reserved
+	shipped.Status = domain.OrderStatusShipped
+	delivered := reserved
+	delivered.Status = domain.OrderStatusDelivered
+
+	cases := map[string]struct {
+		action               func(*handler.Handler, echo.Context) error
+		userID               int64
+		injectorForUserRepo  func(*db.MockUserRepository)
+		injectorForItemRepo  func(*db.MockItemRepository)
+		injectorForOrderRepo func(*db.MockOrderRepository)
+		wantStatusCode       int
+	}{
+		"200: seller ships the order": {
+			action: (*handler.Handler).ShipOrder,
+			userID: 2,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusReserved, domain.OrderStatusShipped).Return(nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"403: buyer cannot ship the order": {
+			action: (*handler.Handler).ShipOrder,
+			userID: 1,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		"404: order not found": {
+			action: (*handler.Handler).ShipOrder,
+			userID: 2,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(domain.Order{}, sql.ErrNoRows).Times(1)
+			},
+			wantStatusCode: http.StatusNotFound,
+		},
+		"200: seller reports the delivery": {
+			action: (*handler.Handler).DeliverOrder,
+			userID: 2,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusShipped, domain.OrderStatusDelivered).Return(nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(delivered, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"403: buyer cannot report the delivery": {
+			action: (*handler.Handler).DeliverOrder,
+			userID: 1,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		"412: cannot report the delivery before shipping": {
+			action: (*handler.Handler).DeliverOrder,
+			userID: 2,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"200: buyer confirms receipt and the seller is paid": {
+			action: (*handler.Handler).ReceiveOrder,
+			userID: 1,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+					UserID: 2,
+					Type:   domain.LedgerEntrySale,
+					Amount: 300,
+					ItemID: 10,
+				}).Return(nil).Times(1)
+			},
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(delivered, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusDelivered, domain.OrderStatusCompleted).Return(nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(delivered, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: buyer confirms receipt before the delivery is reported": {
+			action: (*handler.Handler).ReceiveOrder,
+			userID: 1,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().CreditBalance(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusShipped, domain.OrderStatusCompleted).Return(nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"412: cannot confirm receipt before shipping": {
+			action: (*handler.Handler).ReceiveOrder,
+			userID: 1,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		"200: buyer cancels and is refunded": {
+			action: (*handler.Handler).CancelOrder,
+			userID: 1,
+			injectorForUserRepo: func(m *db.MockUserRepository) {
+				m.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+					UserID: 1,
+					Type:   domain.LedgerEntryRefund,
+					Amount: 300,
+					ItemID: 10,
+				}).Return(nil).Times(1)
+			},
+			injectorForItemRepo: func(m *db.MockItemRepository) {
+				m.EXPECT().UpdateItemStatus(gomock.Any(), int64(10), domain.ItemStatusSoldOut, domain.ItemEventCancelOrder).Return(nil).Times(1)
+			},
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusReserved, domain.OrderStatusCancelled).Return(nil).Times(1)
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"403: other users cannot cancel": {
+			action: (*handler.Handler).CancelOrder,
+			userID: 3,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		"409: order changed concurrently": {
+			action: (*handler.Handler).CancelOrder,
+			userID: 2,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(reserved, nil).Times(1)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusReserved, domain.OrderStatusCancelled).Return(db.ErrOrderStatusMismatch).Times(1)
+			},
+			wantStatusCode: http.StatusConflict,
+		},
+		"412: cannot cancel after shipping": {
+			action: (*handler.Handler).CancelOrder,
+			userID: 1,
+			injectorForOrderRepo: func(m *db.MockOrderRepository) {
+				m.EXPECT().GetOrder(gomock.Any(), int64(1)).Return(shipped, nil).Times(1)
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/orders/:orderID", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: tt.userID}})
+			c.SetParamNames("orderID")
+			c.SetParamValues(strconv.Itoa(1))
+
+			// ready gomock
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			itemRepo := db.NewMockItemRepository(ctrl)
+			orderRepo := db.NewMockOrderRepository(ctrl)
+			if tt.injectorForUserRepo != nil {
+				tt.injectorForUserRepo(userRepo)
+			}
+			if tt.injectorForItemRepo != nil {
+				tt.injectorForItemRepo(itemRepo)
+			}
+			if tt.injectorForOrderRepo != nil {
+				tt.injectorForOrderRepo(orderRepo)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			// test handler
+			h := &handler.Handler{UserRepo: userRepo, ItemRepo: itemRepo, OrderRepo: orderRepo, Tx: tx}
+			if err := tt.action(h, c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestGetOrders(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		url            string
+		wantPage       domain.PageRequest
+		wantStatusCode int
+	}{
+		"200: first page":        {url: "/orders?limit=2", wantPage: domain.PageRequest{Limit: 2}, wantStatusCode: http.StatusOK},
+		"200: page after cursor": {url: "/orders?limit=2&cursor=next", wantPage: domain.PageRequest{Limit: 2, Cursor: "next"}, wantStatusCode: http.StatusOK},
+		"400: invalid limit":     {url: "/orders?limit=0", wantStatusCode: http.StatusBadRequest},
+		"400: invalid cursor":    {url: "/orders?cursor=bad", wantPage: domain.PageRequest{Limit: 20, Cursor: "bad"}, wantStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			orderRepo := db.NewMockOrderRepository(ctrl)
+			switch tt.wantStatusCode {
+			case http.StatusOK:
+				orderRepo.EXPECT().GetOrdersByUserID(gomock.Any(), int64(1), tt.wantPage).Return([]domain.Order{
+					{ID: 3, ItemID: 30, BuyerID: 1, SellerID: 2},
+					{ID: 2, ItemID: 20, BuyerID: 2, SellerID: 1},
+				}, domain.PageInfo{NextCursor: "after-2", PrevCursor: "before-3"}, nil).Times(1)
+			case http.StatusBadRequest:
+				if tt.wantPage.Cursor != "" {
+					orderRepo.EXPECT().GetOrdersByUserID(gomock.Any(), int64(1), tt.wantPage).Return(nil, domain.PageInfo{}, db.ErrInvalidCursor).Times(1)
+				}
+			}
+
+			h := &handler.Handler{OrderRepo: orderRepo}
+			checkStatusCode(t, h.GetOrders(c), rec, tt.wantStatusCode)
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			if rec.Header().Get(handler.HeaderNextCursor) != "after-2" || rec.Header().Get(handler.HeaderPrevCursor) != "before-3" {
+				t.Fatalf("unexpected cursors: %v", rec.Header())
+			}
+		})
+	}
+}
+
+func TestReleaseExpiredOrders(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userRepo := db.NewMockUserRepository(ctrl)
+	itemRepo := db.NewMockItemRepository(ctrl)
+	orderRepo := db.NewMockOrderRepository(ctrl)
+	tx := db.NewMockTransactor(ctrl)
+	runTransaction(tx)
+
+	reserved := domain.Order{ID: 1, ItemID: 10, BuyerID: 1, SellerID: 2, Price: 300, Status: domain.OrderStatusReserved}
+	shipped := domain.Order{ID: 2, ItemID: 20, BuyerID: 1, SellerID: 2, Price: 400, Status: domain.OrderStatusShipped}
+	delivered := domain.Order{ID: 3, ItemID: 30, BuyerID: 1, SellerID: 3, Price: 500, Status: domain.OrderStatusDelivered}
+	orderRepo.EXPECT().GetOrdersNotUpdatedSince(gomock.Any(), domain.OrderStatusReserved, handler.DefaultEscrowTimeout).Return([]domain.Order{reserved}, nil).Times(1)
+	orderRepo.EXPECT().GetOrdersNotUpdatedSince(gomock.Any(), domain.OrderStatusShipped, handler.DefaultEscrowTimeout).Return([]domain.Order{shipped}, nil).Times(1)
+	orderRepo.EXPECT().GetOrdersNotUpdatedSince(gomock.Any(), domain.OrderStatusDelivered, handler.DefaultEscrowTimeout).Return([]domain.Order{delivered}, nil).Times(1)
+
+	// never shipped: the buyer is refunded
+	orderRepo.EXPECT().UpdateOrderStatus(gomock.Any(), int64(1), domain.OrderStatusReserved, domain.OrderStatusCancelled).Return(nil).Times(1)
+	userRepo.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+		UserID: 1,
+		Type:   domain.LedgerEntryRefund,
+		Amount: 300,
+		ItemID: 10,
+	}).Return(nil).Times(1)
+	itemRepo.EXPECT().UpdateItemStatus(gomock.Any(), int64(10), domain.ItemStatusSoldOut, domain.ItemEventCancelOrder).Return(nil).Times(1)
+
+	// never confirmed: the sellers are paid
+	orderRepo.EXPECT().UpdateOrderStatus(gomock.Any(), int64(2), domain.OrderStatusShipped, domain.OrderStatusCompleted).Return(nil).Times(1)
+	userRepo.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+		UserID: 2,
+		Type:   domain.LedgerEntrySale,
+		Amount: 400,
+		ItemID: 20,
+	}).Return(nil).Times(1)
+	orderRepo.EXPECT().UpdateOrderStatus(gomock.Any(), int64(3), domain.OrderStatusDelivered, domain.OrderStatusCompleted).Return(nil).Times(1)
+	userRepo.EXPECT().CreditBalance(gomock.Any(), domain.LedgerEntry{
+		UserID: 3,
+		Type:   domain.LedgerEntrySale,
+		Amount: 500,
+		ItemID: 30,
+	}).Return(nil).Times(1)
+
+	h := &handler.Handler{UserRepo: userRepo, ItemRepo: itemRepo, OrderRepo: orderRepo, Tx: tx, EscrowTimeout: handler.DefaultEscrowTimeout}
+	if err := h.ReleaseExpiredOrders(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/mail"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPasswordResetTTL is used when PASSWORD_RESET_TTL is not set.
+const DefaultPasswordResetTTL = time.Hour
+
+var (
+	// DefaultResetEmailThrottle allows 3 reset emails to an address an hour.
+	DefaultResetEmailThrottle = domain.LoginThrottle{MaxFailures: 3, Lockout: time.Hour, MaxLockout: 24 * time.Hour, Window: time.Hour}
+	// DefaultResetIPThrottle allows a client to ask for 20 an hour.
+	DefaultResetIPThrottle = domain.LoginThrottle{MaxFailures: 20, Lockout: time.Hour, MaxLockout: 24 * time.Hour, Window: time.Hour}
+)
+
+// DefaultPasswordPolicy is used when PASSWORD_MIN_LENGTH and PASSWORD_MIN_CLASSES are not set.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MinClasses: 1}
+
+const passwordResetBody = `Hi %s,
+
+Open the link below to choose a new password. It works once, for %s.
+
+%s
+
+If you did not ask for this, you can ignore this email. Your password stays the same.
+`
+
+// PasswordPolicy is what a new password has to satisfy. The zero value accepts any password.
+type PasswordPolicy struct {
+	// MinLength counts characters.
+	MinLength int
+	// MinClasses is how many of lower case letters, upper case letters, digits and other characters it needs.
+	MinClasses int
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,maxbytes=72"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
+}
+
+// check returns the first rule the password fails, reported like the validate tags.
+func (p PasswordPolicy) check(field, password, name string) []fieldError {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return []fieldError{{Field: field, Rule: "min", Param: strconv.Itoa(p.MinLength)}}
+	}
+	if passwordClasses(password) < p.MinClasses {
+		return []fieldError{{Field: field, Rule: "classes", Param: strconv.Itoa(p.MinClasses)}}
+	}
+	if strings.EqualFold(password, name) {
+		return []fieldError{{Field: field, Rule: "not_name"}}
+	}
+	return nil
+}
+
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// checkPassword answers a password failing the policy like a request failing validation.
+func (h *Handler) checkPassword(field, password, name string) error {
+	if errs := h.PasswordPolicy.check(field, password, name); len(errs) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, validationErrorResponse{Message: "validation failed", Errors: errs})
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of the user after checking the old one.
+// Every session is revoked, and the caller gets the tokens of a new one.
+func (h *Handler) ChangePassword(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(changePasswordRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	user, err := h.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	// the old password is throttled like logins, so a stolen token cannot guess it any faster
+	attempt := domain.LoginAttempt{UserID: user.ID, Identifier: user.Name, IP: c.RealIP()}
+	accountKey, clientKey := loginKeys(&loginRequest{}, user, attempt.IP)
+	if err := h.checkLockout(c, attempt, accountKey, clientKey); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
+		if err != bcrypt.ErrMismatchedHashAndPassword {
+			return toHTTPError(err)
+		}
+		if err := h.recordLoginFailure(ctx, attempt, accountKey, clientKey); err != nil {
+			return err
+		}
+		// not 401, which would log the client out
+		return echo.NewHTTPError(http.StatusForbidden, "old password is incorrect")
+	}
+	if err := h.checkPassword("new_password", req.NewPassword, user.Name); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	var session domain.Session
+	var refreshToken string
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := h.UserRepo.UpdatePassword(ctx, user.ID, string(hash)); err != nil {
+			return err
+		}
+		if err := h.SessionRepo.RevokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		session, refreshToken, err = h.SessionRepo.AddSession(ctx, user.ID, h.RefreshTokenTTL)
+		if err != nil {
+			return err
+		}
+		return h.LoginRepo.ResetLoginFailures(ctx, accountKey)
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return h.respondWithTokens(c, user, session, refreshToken)
+}
+
+// RequestPasswordReset emails a reset link to the user with the email.
+// Unknown emails are answered the same and just as fast, since the user is looked up and
+// mailed in the background. Requests are throttled per email and per client, whether
+// the email is registered or not.
+func (h *Handler) RequestPasswordReset(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if h.Mailer == nil {
+		return echo.NewHTTPError(http.StatusNotImplemented, "password reset is not configured")
+	}
+
+	req := new(passwordResetRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	// the login failure counters count the requests here
+	emailKey, clientKey := "reset:"+strings.ToLower(req.Email), "reset-ip:"+c.RealIP()
+	lockout, err := h.LoginRepo.GetLockout(ctx, emailKey, clientKey)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if lockout > 0 {
+		c.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(int64(lockout.Seconds()), 10))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many password reset requests, try again later")
+	}
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := h.LoginRepo.AddLoginFailure(ctx, emailKey, h.ResetEmailThrottle); err != nil {
+			return err
+		}
+		_, err := h.LoginRepo.AddLoginFailure(ctx, clientKey, h.ResetIPThrottle)
+		return err
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	h.goBackground("send a password reset email", func(ctx context.Context) error {
+		return h.sendPasswordReset(ctx, req.Email)
+	})
+
+	// the email is sent in the background
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := h.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := h.PasswordResetRepo.AddPasswordReset(ctx, user.ID, h.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(passwordResetBody, user.Name, h.PasswordResetTTL, h.PasswordResetURL+token),
+	})
+}
+
+// ResetPassword sets the password with a token from a reset email and revokes every session.
+// A password failing the policy leaves the token usable.
+func (h *Handler) ResetPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(resetPasswordRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	err = h.Tx.Transaction(ctx, func(ctx context.Context) error {
+		userID, err := h.PasswordResetRepo.UsePasswordReset(ctx, req.Token)
+		if err != nil {
+			return err
+		}
+		user, err := h.UserRepo.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := h.checkPassword("password", req.Password, user.Name); err != nil {
+			return err
+		}
+		if err := h.UserRepo.UpdatePassword(ctx, user.ID, string(hash)); err != nil {
+			return err
+		}
+		return h.SessionRepo.RevokeUserSessions(ctx, user.ID)
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,354 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/mail"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// checkStatusCode compares the status code of the error returned by a handler, or of the response.
+func checkStatusCode(t *testing.T, err error, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	got := rec.Code
+	if err != nil {
+		echoErr, ok := err.(*echo.HTTPError)
+		if !ok {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		got = echoErr.Code
+	}
+	if got != want {
+		t.Fatalf("unexpected status code: want: %d, got: %d", want, got)
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		name       string
+		password   string
+		wantErrors string
+	}{
+		"too short":         {name: "alice", password: "pa55", wantErrors: `[{"field":"password","rule":"min","param":"8"}]`},
+		"letters only":      {name: "alice", password: "password", wantErrors: `[{"field":"password","rule":"classes","param":"2"}]`},
+		"same as the name":  {name: "Alice2023", password: "alice2023", wantErrors: `[{"field":"password","rule":"not_name"}]`},
+		"letters and digit": {name: "alice", password: "passw0rd"},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, _ := json.Marshal(map[string]string{"name": tt.name, "password": tt.password})
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			if tt.wantErrors == "" {
+				userRepo.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(int64(1), nil).Times(1)
+			}
+
+			h := &handler.Handler{UserRepo: userRepo, PasswordPolicy: handler.PasswordPolicy{MinLength: 8, MinClasses: 2}}
+			err := h.Register(c)
+			if tt.wantErrors == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				return
+			}
+			echoErr, ok := err.(*echo.HTTPError)
+			if !ok || echoErr.Code != http.StatusBadRequest {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(echoErr.Message)
+			if err != nil {
+				t.Fatalf("failed json.Marshal: %s", err.Error())
+			}
+			if want := `{"message":"validation failed","errors":` + tt.wantErrors + `}`; string(got) != want {
+				t.Fatalf("unexpected errors: want: %s, got: %s", want, got)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-passw0rd"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed bcrypt.GenerateFromPassword: %s", err.Error())
+	}
+	alice := domain.User{ID: 1, Name: "alice", Password: string(hash)}
+
+	cases := map[string]struct {
+		body           string
+		lockout        time.Duration
+		wantChange     bool
+		wantFailure    bool
+		wantStatusCode int
+	}{
+		"200: changed": {
+			body:           `{"old_password": "old-passw0rd", "new_password": "new-passw0rd"}`,
+			wantChange:     true,
+			wantStatusCode: http.StatusOK,
+		},
+		"403: wrong old password": {
+			body:           `{"old_password": "guess", "new_password": "new-passw0rd"}`,
+			wantFailure:    true,
+			wantStatusCode: http.StatusForbidden,
+		},
+		"429: locked out with the right old password": {
+			body:           `{"old_password": "old-passw0rd", "new_password": "new-passw0rd"}`,
+			lockout:        30 * time.Second,
+			wantStatusCode: http.StatusTooManyRequests,
+		},
+		"400: weak new password": {
+			body:           `{"old_password": "old-passw0rd", "new_password": "new"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPut, "/users/me/password", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, SessionID: "old"}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			userRepo.EXPECT().GetUser(gomock.Any(), int64(1)).Return(alice, nil).Times(1)
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+			// the account key of the login path, so that both count against one lockout
+			loginRepo := db.NewMockLoginRepository(ctrl)
+			loginRepo.EXPECT().GetLockout(gomock.Any(), "user:1", "ip:192.0.2.1").Return(tt.lockout, nil).Times(1)
+			if tt.lockout > 0 {
+				loginRepo.EXPECT().AddLoginAttempt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, attempt domain.LoginAttempt) error {
+					if attempt.Outcome != domain.LoginLocked {
+						t.Fatalf("unexpected attempt: %+v", attempt)
+					}
+					return nil
+				}).Times(1)
+			}
+			if tt.wantFailure {
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "user:1", handler.DefaultAccountThrottle).Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "ip:192.0.2.1", handler.DefaultIPThrottle).Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginAttempt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, attempt domain.LoginAttempt) error {
+					if attempt.UserID != 1 || attempt.Outcome != domain.LoginFailed {
+						t.Fatalf("unexpected attempt: %+v", attempt)
+					}
+					return nil
+				}).Times(1)
+			}
+			if tt.wantChange {
+				loginRepo.EXPECT().ResetLoginFailures(gomock.Any(), "user:1").Return(nil).Times(1)
+				userRepo.EXPECT().UpdatePassword(gomock.Any(), int64(1), gomock.Any()).DoAndReturn(func(_ context.Context, _ int64, password string) error {
+					if err := bcrypt.CompareHashAndPassword([]byte(password), []byte("new-passw0rd")); err != nil {
+						t.Fatalf("the new password is not stored: %s", err.Error())
+					}
+					return nil
+				}).Times(1)
+				gomock.InOrder(
+					sessionRepo.EXPECT().RevokeUserSessions(gomock.Any(), int64(1)).Return(nil).Times(1),
+					sessionRepo.EXPECT().AddSession(gomock.Any(), int64(1), time.Hour).Return(domain.Session{ID: "new", UserID: 1}, "refresh", nil).Times(1),
+				)
+			}
+
+			h := &handler.Handler{
+				UserRepo:        userRepo,
+				SessionRepo:     sessionRepo,
+				LoginRepo:       loginRepo,
+				Tx:              tx,
+				Keys:            testKeys,
+				AccessTokenTTL:  time.Minute,
+				RefreshTokenTTL: time.Hour,
+				PasswordPolicy:  handler.DefaultPasswordPolicy,
+				AccountThrottle: handler.DefaultAccountThrottle,
+				IPThrottle:      handler.DefaultIPThrottle,
+			}
+			checkStatusCode(t, h.ChangePassword(c), rec, tt.wantStatusCode)
+			if tt.lockout > 0 && rec.Header().Get(echo.HeaderRetryAfter) != "30" {
+				t.Fatalf("unexpected Retry-After: %s", rec.Header().Get(echo.HeaderRetryAfter))
+			}
+			if !tt.wantChange {
+				return
+			}
+
+			var resp struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if resp.RefreshToken != "refresh" {
+				t.Fatalf("unexpected refresh token: %s", resp.RefreshToken)
+			}
+		})
+	}
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	t.Parallel()
+	alice := domain.User{ID: 1, Name: "alice", Email: "alice@example.com"}
+
+	cases := map[string]struct {
+		noMailer       bool
+		lockout        time.Duration
+		getUserErr     error
+		wantMail       bool
+		wantStatusCode int
+	}{
+		"202: sent":             {wantMail: true, wantStatusCode: http.StatusAccepted},
+		"202: unknown email":    {getUserErr: sql.ErrNoRows, wantStatusCode: http.StatusAccepted},
+		"429: asked too often":  {lockout: 30 * time.Second, wantStatusCode: http.StatusTooManyRequests},
+		"501: no mailer is set": {noMailer: true, wantStatusCode: http.StatusNotImplemented},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewBufferString(`{"email": "Alice@example.com"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			resetRepo := db.NewMockPasswordResetRepository(ctrl)
+			mailer := mail.NewMockMailer(ctrl)
+			loginRepo := db.NewMockLoginRepository(ctrl)
+			if !tt.noMailer {
+				loginRepo.EXPECT().GetLockout(gomock.Any(), "reset:alice@example.com", "reset-ip:192.0.2.1").Return(tt.lockout, nil).Times(1)
+			}
+			// unknown emails are counted too
+			if !tt.noMailer && tt.lockout == 0 {
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "reset:alice@example.com", handler.DefaultResetEmailThrottle).Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "reset-ip:192.0.2.1", handler.DefaultResetIPThrottle).Return(time.Duration(0), nil).Times(1)
+				userRepo.EXPECT().GetUserByEmail(gomock.Any(), "Alice@example.com").Return(alice, tt.getUserErr).Times(1)
+			}
+			if tt.wantMail {
+				resetRepo.EXPECT().AddPasswordReset(gomock.Any(), int64(1), time.Hour).Return("token", nil).Times(1)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any()).Do(func(_ context.Context, msg mail.Message) {
+					if msg.To != "alice@example.com" || !strings.Contains(msg.Body, "http://localhost:3000/password/reset?token=token") {
+						t.Errorf("unexpected message: %+v", msg)
+					}
+				}).Return(nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{
+				UserRepo:           userRepo,
+				PasswordResetRepo:  resetRepo,
+				LoginRepo:          loginRepo,
+				Tx:                 tx,
+				Mailer:             mailer,
+				PasswordResetTTL:   time.Hour,
+				PasswordResetURL:   "http://localhost:3000/password/reset?token=",
+				ResetEmailThrottle: handler.DefaultResetEmailThrottle,
+				ResetIPThrottle:    handler.DefaultResetIPThrottle,
+			}
+			if tt.noMailer {
+				h.Mailer = nil
+			}
+			checkStatusCode(t, h.RequestPasswordReset(c), rec, tt.wantStatusCode)
+			// the email is sent after the response
+			h.Wait()
+			if tt.lockout > 0 && rec.Header().Get(echo.HeaderRetryAfter) != "30" {
+				t.Fatalf("unexpected Retry-After: %s", rec.Header().Get(echo.HeaderRetryAfter))
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		password       string
+		useErr         error
+		wantReset      bool
+		wantStatusCode int
+	}{
+		"204: reset":            {password: "new-passw0rd", wantReset: true, wantStatusCode: http.StatusNoContent},
+		"400: invalid token":    {password: "new-passw0rd", useErr: db.ErrInvalidResetToken, wantStatusCode: http.StatusBadRequest},
+		"400: weak password":    {password: "alice", wantStatusCode: http.StatusBadRequest},
+		"400: same as the name": {password: "Alice123", wantStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, _ := json.Marshal(map[string]string{"token": "token", "password": tt.password})
+			req := httptest.NewRequest(http.MethodPost, "/password/reset/confirm", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			resetRepo := db.NewMockPasswordResetRepository(ctrl)
+			resetRepo.EXPECT().UsePasswordReset(gomock.Any(), "token").Return(int64(1), tt.useErr).Times(1)
+			userRepo := db.NewMockUserRepository(ctrl)
+			if tt.useErr == nil {
+				userRepo.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{ID: 1, Name: "alice123"}, nil).Times(1)
+			}
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			if tt.wantReset {
+				userRepo.EXPECT().UpdatePassword(gomock.Any(), int64(1), gomock.Any()).Return(nil).Times(1)
+				sessionRepo.EXPECT().RevokeUserSessions(gomock.Any(), int64(1)).Return(nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{
+				UserRepo:          userRepo,
+				SessionRepo:       sessionRepo,
+				PasswordResetRepo: resetRepo,
+				Tx:                tx,
+				PasswordPolicy:    handler.DefaultPasswordPolicy,
+			}
+			checkStatusCode(t, h.ResetPassword(c), rec, tt.wantStatusCode)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+type searchItemResponse struct {
+	domain.GetItemResponse
+	// NameHighlight and Snippet are HTML with the matches wrapped in <mark>.
+	NameHighlight string `json:"name_highlight"`
+	Snippet       string `json:"snippet"`
+}
+
+// searchItemsWithFacetsResponse is returned instead of the plain list when facets=true.
+type searchItemsWithFacetsResponse struct {
+	Items  []searchItemResponse `json:"items"`
+	Facets searchFacetsResponse `json:"facets"`
+}
+
+type searchFacetsResponse struct {
+	Categories []categoryFacetResponse `json:"categories"`
+	Prices     []priceFacetResponse    `json:"prices"`
+}
+
+type categoryFacetResponse struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
+	// Count includes the items in subcategories.
+	Count int64 `json:"count"`
+}
+
+type priceFacetResponse struct {
+	Min int64 `json:"min"`
+	// Max is exclusive and omitted for the last bucket.
+	Max   int64 `json:"max,omitempty"`
+	Count int64 `json:"count"`
+}
+
+// SearchItems finds items by word and filters.
+// The response stays a plain list unless facets=true, as the benchmarker expects a list.
+func (h *Handler) SearchItems(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	categories, err := h.ItemRepo.GetCategories(ctx)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	q, err := parseSearchQuery(c, categories)
+	if err != nil {
+		return err
+	}
+
+	page, err := getPageRequest(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	results, info, err := h.ItemRepo.SearchItems(ctx, q, page)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	setPageHeaders(c, info)
+
+	categoryNames := make(map[int64]string, len(categories))
+	for _, cat := range categories {
+		categoryNames[cat.ID] = cat.Name
+	}
+	res := make([]searchItemResponse, len(results))
+	for i, result := range results {
+		res[i] = searchItemResponse{
+			GetItemResponse: result.ConvertToGetItemResponse(),
+			NameHighlight:   domain.RenderHighlight(result.NameHighlight),
+			Snippet:         domain.RenderHighlight(result.Snippet),
+		}
+		name, ok := categoryNames[res[i].CategoryID]
+		if !ok {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("invalid category ID: %d", res[i].CategoryID))
+		}
+		res[i].CategoryName = name
+	}
+
+	if c.QueryParam("facets") != "true" {
+		return c.JSON(http.StatusOK, res)
+	}
+
+	facets, err := h.ItemRepo.GetSearchFacets(ctx, q)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, searchItemsWithFacetsResponse{
+		Items:  res,
+		Facets: convertToSearchFacetsResponse(facets, categories),
+	})
+}
+
+func parseSearchQuery(c echo.Context, categories []domain.Category) (domain.ItemSearchQuery, error) {
+	q := domain.ItemSearchQuery{
+		Word: c.QueryParam("name"),
+		Sort: domain.ItemSearchSortRelevance,
+	}
+
+	if v := c.QueryParam("sort"); v != "" {
+		q.Sort = domain.ItemSearchSort(v)
+		if !q.Sort.IsValid() {
+			return q, echo.NewHTTPError(http.StatusBadRequest, "invalid sort")
+		}
+	}
+
+	if v := c.QueryParam("category_id"); v != "" {
+		categoryID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || len(domain.CategoryPath(categories, categoryID)) == 0 {
+			return q, echo.NewHTTPError(http.StatusBadRequest, "invalid category_id")
+		}
+		q.CategoryIDs = domain.DescendantCategoryIDs(categories, categoryID)
+	}
+
+	var err error
+	if q.MinPrice, err = parsePrice(c, "min_price"); err != nil {
+		return q, err
+	}
+	if q.MaxPrice, err = parsePrice(c, "max_price"); err != nil {
+		return q, err
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return q, echo.NewHTTPError(http.StatusBadRequest, "min_price is greater than max_price")
+	}
+
+	for _, v := range c.QueryParams()["status"] {
+		status, err := strconv.Atoi(v)
+		if err != nil || !domain.ItemStatus(status).IsSearchable() {
+			return q, echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+		}
+		q.Statuses = append(q.Statuses, domain.ItemStatus(status))
+	}
+
+	if v := c.QueryParam("seller_id"); v != "" {
+		sellerID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return q, echo.NewHTTPError(http.StatusBadRequest, "invalid seller_id")
+		}
+		q.SellerID = sellerID
+	}
+
+	// at least one condition, so a bare /search does not list everything
+	if q.Word == "" && len(q.CategoryIDs) == 0 && q.MinPrice == nil && q.MaxPrice == nil && len(q.Statuses) == 0 && q.SellerID == 0 {
+		return q, echo.NewHTTPError(http.StatusBadRequest, "please specified search word")
+	}
+	return q, nil
+}
+
+// parsePrice returns nil when the parameter is not given.
+func parsePrice(c echo.Context, name string) (*int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || price < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid "+name)
+	}
+	return &price, nil
+}
+
+// convertToSearchFacetsResponse adds the count of each category to all of its ancestors.
+func convertToSearchFacetsResponse(facets domain.SearchFacets, categories []domain.Category) searchFacetsResponse {
+	counts := make(map[int64]int64)
+	for _, f := range facets.Categories {
+		for _, cat := range domain.CategoryPath(categories, f.CategoryID) {
+			counts[cat.ID] += f.Count
+		}
+	}
+
+	res := searchFacetsResponse{
+		Categories: []categoryFacetResponse{},
+		Prices:     make([]priceFacetResponse, len(facets.Prices)),
+	}
+	for _, cat := range categories {
+		if counts[cat.ID] == 0 {
+			continue
+		}
+		res.Categories = append(res.Categories, categoryFacetResponse{ID: cat.ID, Name: cat.Name, ParentID: cat.ParentID, Count: counts[cat.ID]})
+	}
+	for i, f := range facets.Prices {
+		res.Prices[i] = priceFacetResponse{Min: f.Min, Max: f.Max, Count: f.Count}
+	}
+	return res
+}
@@ -0,0 +1,173 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+var searchCategories = []domain.Category{
+	{ID: 1, Name: "food"},
+	{ID: 2, Name: "fashion"},
+	{ID: 4, Name: "tops", ParentID: 2},
+}
+
+func TestSearchItemsFilters(t *testing.T) {
+	t.Parallel()
+	price := func(v int64) *int64 { return &v }
+	cases := map[string]struct {
+		url            string
+		wantQuery      domain.ItemSearchQuery
+		wantStatusCode int
+	}{
+		"200: category includes subcategories": {
+			url:            "/search?name=shirt&category_id=2",
+			wantQuery:      domain.ItemSearchQuery{Word: "shirt", CategoryIDs: []int64{2, 4}, Sort: domain.ItemSearchSortRelevance},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: filters without a word": {
+			url:            "/search?min_price=100&max_price=500&status=1&status=2&seller_id=3&sort=price_desc",
+			wantQuery:      domain.ItemSearchQuery{MinPrice: price(100), MaxPrice: price(500), Statuses: []domain.ItemStatus{domain.ItemStatusOnSale, domain.ItemStatusSoldOut}, SellerID: 3, Sort: domain.ItemSearchSortPriceDesc},
+			wantStatusCode: http.StatusOK,
+		},
+		"400: unknown category":         {url: "/search?name=a&category_id=9", wantStatusCode: http.StatusBadRequest},
+		"400: negative price":           {url: "/search?name=a&min_price=-1", wantStatusCode: http.StatusBadRequest},
+		"400: min price above max":      {url: "/search?min_price=500&max_price=100", wantStatusCode: http.StatusBadRequest},
+		"400: unknown status":           {url: "/search?status=9", wantStatusCode: http.StatusBadRequest},
+		"400: drafts of other sellers":  {url: "/search?status=0&seller_id=3", wantStatusCode: http.StatusBadRequest},
+		"400: withdrawn items":          {url: "/search?name=a&status=4", wantStatusCode: http.StatusBadRequest},
+		"400: unknown sort":             {url: "/search?name=a&sort=popular", wantStatusCode: http.StatusBadRequest},
+		"400: no word and no condition": {url: "/search?sort=newest", wantStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetCategories(gomock.Any()).Return(searchCategories, nil).Times(1)
+			if tt.wantStatusCode == http.StatusOK {
+				itemRepo.EXPECT().SearchItems(gomock.Any(), tt.wantQuery, gomock.Any()).Return(nil, domain.PageInfo{}, nil).Times(1)
+			}
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := h.SearchItems(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestSearchItemsFacets(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/search?name=shirt&facets=true", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().GetCategories(gomock.Any()).Return(searchCategories, nil).Times(1)
+	itemRepo.EXPECT().SearchItems(gomock.Any(), gomock.Any(), gomock.Any()).Return([]domain.ItemSearchResult{
+		{Item: domain.Item{ID: 1, Name: "T-shirt", CategoryID: 4}},
+	}, domain.PageInfo{}, nil).Times(1)
+	itemRepo.EXPECT().GetSearchFacets(gomock.Any(), gomock.Any()).Return(domain.SearchFacets{
+		Categories: []domain.CategoryFacet{{CategoryID: 2, Count: 1}, {CategoryID: 4, Count: 2}},
+		Prices:     []domain.PriceFacet{{Min: 0, Max: 1000, Count: 3}, {Min: 1000, Count: 0}},
+	}, nil).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	if err := h.SearchItems(c); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var resp struct {
+		Items  []struct{ ID int64 } `json:"items"`
+		Facets struct {
+			Categories []struct {
+				ID    int64 `json:"id"`
+				Count int64 `json:"count"`
+			} `json:"categories"`
+			Prices []struct {
+				Max   int64 `json:"max"`
+				Count int64 `json:"count"`
+			} `json:"prices"`
+		} `json:"facets"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+	}
+	if len(resp.Items) != 1 {
+		t.Fatalf("unexpected items: %s", rec.Body.String())
+	}
+	// fashion counts its own item and the two in tops
+	cats := resp.Facets.Categories
+	if len(cats) != 2 || cats[0].ID != 2 || cats[0].Count != 3 || cats[1].ID != 4 || cats[1].Count != 2 {
+		t.Fatalf("unexpected category facets: %s", rec.Body.String())
+	}
+	if len(resp.Facets.Prices) != 2 || resp.Facets.Prices[0].Count != 3 {
+		t.Fatalf("unexpected price facets: %s", rec.Body.String())
+	}
+}
+
+func TestSearchItemsHighlight(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/search?name=shirt", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	itemRepo := db.NewMockItemRepository(ctrl)
+	itemRepo.EXPECT().SearchItems(gomock.Any(), domain.ItemSearchQuery{Word: "shirt", Sort: domain.ItemSearchSortRelevance}, gomock.Any()).Return([]domain.ItemSearchResult{
+		{
+			Item:          domain.Item{ID: 1, Name: "<b>T-shirt</b>", CategoryID: 1},
+			NameHighlight: "<b>T-" + domain.HighlightStart + "shirt" + domain.HighlightEnd + "</b>",
+		},
+	}, domain.PageInfo{}, nil).Times(1)
+	itemRepo.EXPECT().GetCategories(gomock.Any()).Return([]domain.Category{{ID: 1, Name: "fashion"}}, nil).Times(1)
+
+	h := &handler.Handler{ItemRepo: itemRepo}
+	if err := h.SearchItems(c); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var resp []struct {
+		NameHighlight string `json:"name_highlight"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error for json.Unamrshal: %s", err.Error())
+	}
+	want := "&lt;b&gt;T-<mark>shirt</mark>&lt;/b&gt;"
+	if len(resp) != 1 || resp[0].NameHighlight != want {
+		t.Fatalf("unexpected highlight: want: %s, got: %s", want, rec.Body.String())
+	}
+}
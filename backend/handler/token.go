@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultAccessTokenTTL is used when ACCESS_TOKEN_TTL is not set.
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL is used when REFRESH_TOKEN_TTL is not set.
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errSessionRevoked = errors.New("session is revoked")
+	errNotAccessToken = errors.New("not an access token")
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type logoutRequest struct {
+	// All revokes every session of the user instead of the current one.
+	All bool `json:"all"`
+}
+
+// respondWithTokens sends a new access token of the session along with its refresh token.
+func (h *Handler) respondWithTokens(c echo.Context, user domain.User, session domain.Session, refreshToken string) error {
+	now := time.Now()
+	claims := &JwtCustomClaims{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		Role:      user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(h.AccessTokenTTL)),
+		},
+	}
+	token, err := h.Keys.Sign(claims)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, loginResponse{
+		ID:           user.ID,
+		Name:         user.Name,
+		Token:        token,
+		ExpiresIn:    int64(h.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// ParseToken is the ParseTokenFunc of the JWT middleware. Besides the signature and
+// the expiry, it checks that the session of the token has not been revoked.
+func (h *Handler) ParseToken(c echo.Context, auth string) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(auth, new(JwtCustomClaims), h.Keys.Keyfunc, jwt.WithValidMethods(h.Keys.Methods()))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*JwtCustomClaims)
+	// challenge tokens are signed with the same keys
+	if len(claims.Audience) > 0 {
+		return nil, errNotAccessToken
+	}
+	session, err := h.SessionRepo.GetSession(c.Request().Context(), claims.SessionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the session")
+	}
+	if session.IsRevoked() || session.UserID != claims.UserID {
+		return nil, errSessionRevoked
+	}
+	return token, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and the next refresh token.
+func (h *Handler) Refresh(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(refreshRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	session, refreshToken, err := h.SessionRepo.RotateRefreshToken(ctx, req.RefreshToken, h.RefreshTokenTTL)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	user, err := h.UserRepo.GetUser(ctx, session.UserID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return h.respondWithTokens(c, user, session, refreshToken)
+}
+
+// Logout revokes the session of the access token, or every session of the user with {"all": true}.
+func (h *Handler) Logout(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(logoutRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+	}
+	claims := token.Claims.(*JwtCustomClaims)
+
+	var err error
+	if req.All {
+		err = h.SessionRepo.RevokeUserSessions(ctx, claims.UserID)
+	} else {
+		err = h.SessionRepo.RevokeSession(ctx, claims.SessionID)
+	}
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,236 @@
+package handler_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+const testSecret = "test-secret"
+
+var testKeys = handler.NewSecretKeyset(testSecret)
+
+// signToken signs with the key of testKeys, naming it in the kid header whatever the method is.
+func signToken(t *testing.T, method jwt.SigningMethod, claims *handler.JwtCustomClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "hs256"
+	signed, err := token.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed SignedString: %s", err.Error())
+	}
+	return signed
+}
+
+func TestParseToken(t *testing.T) {
+	t.Parallel()
+	expiresAt := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	valid := &handler.JwtCustomClaims{UserID: 1, SessionID: "session", RegisteredClaims: expiresAt}
+
+	cases := map[string]struct {
+		token       string
+		session     domain.Session
+		sessionErr  error
+		wantSession bool
+		wantOK      bool
+	}{
+		"valid": {
+			token:       signToken(t, jwt.SigningMethodHS256, valid),
+			session:     domain.Session{ID: "session", UserID: 1},
+			wantSession: true,
+			wantOK:      true,
+		},
+		"revoked session": {
+			token:       signToken(t, jwt.SigningMethodHS256, valid),
+			session:     domain.Session{ID: "session", UserID: 1, RevokedAt: "2023-06-01 10:00:00"},
+			wantSession: true,
+		},
+		"session of another user": {
+			token:       signToken(t, jwt.SigningMethodHS256, valid),
+			session:     domain.Session{ID: "session", UserID: 2},
+			wantSession: true,
+		},
+		"unknown session": {
+			token:       signToken(t, jwt.SigningMethodHS256, valid),
+			sessionErr:  sql.ErrNoRows,
+			wantSession: true,
+		},
+		"expired": {
+			token: signToken(t, jwt.SigningMethodHS256, &handler.JwtCustomClaims{UserID: 1, SessionID: "session", RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			}}),
+		},
+		"other signing method": {
+			token: signToken(t, jwt.SigningMethodHS512, valid),
+		},
+		"with an audience": {
+			token: signToken(t, jwt.SigningMethodHS256, &handler.JwtCustomClaims{UserID: 1, SessionID: "session", RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"login-totp"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			}}),
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/balance", nil), httptest.NewRecorder())
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			if tt.wantSession {
+				sessionRepo.EXPECT().GetSession(gomock.Any(), "session").Return(tt.session, tt.sessionErr).Times(1)
+			}
+
+			h := &handler.Handler{SessionRepo: sessionRepo, Keys: testKeys}
+			token, err := h.ParseToken(c, tt.token)
+			if !tt.wantOK {
+				if err == nil {
+					t.Fatalf("the token is accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if claims := token.(*jwt.Token).Claims.(*handler.JwtCustomClaims); claims.UserID != 1 {
+				t.Fatalf("unexpected user id: %d", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		rotateErr      error
+		wantStatusCode int
+	}{
+		"200: rotated":            {wantStatusCode: http.StatusOK},
+		"401: expired or unknown": {rotateErr: db.ErrInvalidRefreshToken, wantStatusCode: http.StatusUnauthorized},
+		"401: reused":             {rotateErr: db.ErrRefreshTokenReused, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token": "old"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			sessionRepo.EXPECT().RotateRefreshToken(gomock.Any(), "old", time.Hour).Return(domain.Session{ID: "session", UserID: 1}, "new", tt.rotateErr).Times(1)
+			userRepo := db.NewMockUserRepository(ctrl)
+			if tt.rotateErr == nil {
+				userRepo.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{ID: 1, Name: "alice"}, nil).Times(1)
+			}
+
+			h := &handler.Handler{UserRepo: userRepo, SessionRepo: sessionRepo, AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour, Keys: testKeys}
+			if err := h.Refresh(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, echoErr.Code)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+
+			var resp struct {
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if resp.RefreshToken != "new" {
+				t.Fatalf("unexpected refresh token: %s", resp.RefreshToken)
+			}
+			// the new access token belongs to the same session
+			claims := new(handler.JwtCustomClaims)
+			if _, err := jwt.ParseWithClaims(resp.Token, claims, testKeys.Keyfunc); err != nil {
+				t.Fatalf("failed jwt.ParseWithClaims: %s", err.Error())
+			}
+			if claims.UserID != 1 || claims.SessionID != "session" {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		body     string
+		injector func(*db.MockSessionRepository)
+	}{
+		"current session": {
+			body: `{}`,
+			injector: func(m *db.MockSessionRepository) {
+				m.EXPECT().RevokeSession(gomock.Any(), "session").Return(nil).Times(1)
+			},
+		},
+		"every session": {
+			body: `{"all": true}`,
+			injector: func(m *db.MockSessionRepository) {
+				m.EXPECT().RevokeUserSessions(gomock.Any(), int64(1)).Return(nil).Times(1)
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, SessionID: "session"}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			tt.injector(sessionRepo)
+
+			h := &handler.Handler{SessionRepo: sessionRepo}
+			if err := h.Logout(c); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("unexpected status code: want: %d, got: %d", http.StatusNoContent, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChallengeTTL is how long the challenge token of a two-step login works.
+	ChallengeTTL = 5 * time.Minute
+	// DefaultStepUpAmount is used when STEP_UP_AMOUNT is not set.
+	DefaultStepUpAmount = 10000
+
+	totpIssuer        = "Mercari"
+	challengeAudience = "login-totp"
+	recoveryCodeCount = 10
+)
+
+var (
+	errTOTPRequired    = &db.Error{Kind: db.ErrUnauthorized, Code: "totp_required", Message: "a two-factor code is required"}
+	errInvalidTOTPCode = &db.Error{Kind: db.ErrUnauthorized, Code: "invalid_totp_code", Message: "invalid two-factor code"}
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// challengeClaims are the claims of a challenge token, which only LoginTOTP takes.
+type challengeClaims struct {
+	UserID int64 `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+type enrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type disableTOTPRequest struct {
+	// Code is only needed once the authenticator is enabled.
+	Code string `json:"code" validate:"max=64"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type loginChallengeResponse struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	TOTPRequired   bool   `json:"totp_required"`
+	ChallengeToken string `json:"challenge_token"`
+	// ExpiresIn is the lifetime of ChallengeToken in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type loginTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is a code of the authenticator or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+// EnrollTOTP starts two-factor authentication with a new secret, which ConfirmTOTP enables.
+func (h *Handler) EnrollTOTP(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	user, err := h.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	secret, err := domain.NewTOTPSecret()
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if err := h.TOTPRepo.SetPendingTOTP(ctx, userID, secret); err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, enrollTOTPResponse{Secret: secret, URI: domain.TOTPProvisioningURI(totpIssuer, user.Name, secret)})
+}
+
+// ConfirmTOTP enables the pending authenticator with one of its codes and returns the
+// recovery codes, which are not shown again.
+func (h *Handler) ConfirmTOTP(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(totpCodeRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	totp, err := h.TOTPRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "no authenticator is being enrolled")
+		}
+		return toHTTPError(err)
+	}
+	if totp.IsEnabled() {
+		return toHTTPError(db.ErrTOTPEnabled)
+	}
+
+	step, ok := domain.MatchTOTP(totp.Secret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, errInvalidTOTPCode)
+	}
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return toHTTPError(err)
+	}
+	stored := make([]string, len(codes))
+	for i, code := range codes {
+		stored[i] = normalizeRecoveryCode(code)
+	}
+	if err := h.TOTPRepo.EnableTOTP(ctx, userID, step, stored); err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off after checking a code. A pending
+// authenticator is dropped without one.
+func (h *Handler) DisableTOTP(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(disableTOTPRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	totp, err := h.TOTPRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "two-factor authentication is not enabled")
+		}
+		return toHTTPError(err)
+	}
+	if totp.IsEnabled() {
+		if req.Code == "" {
+			return echo.NewHTTPError(http.StatusForbidden, errTOTPRequired)
+		}
+		if err := h.verifySecondFactor(c, totp, req.Code); err != nil {
+			return secondFactorError(err)
+		}
+	}
+
+	if err := h.TOTPRepo.DeleteTOTP(ctx, userID); err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LoginTOTP is the second step of the login of a user with two-factor authentication.
+// It takes the challenge token of Login with a code and starts the session.
+func (h *Handler) LoginTOTP(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(loginTOTPRequest)
+	if err := bindRequest(c, req); err != nil {
+		return err
+	}
+
+	claims := new(challengeClaims)
+	if _, err := jwt.ParseWithClaims(req.ChallengeToken, claims, h.Keys.Keyfunc,
+		jwt.WithValidMethods(h.Keys.Methods()), jwt.WithAudience(challengeAudience)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired challenge token")
+	}
+	totp, err := h.TOTPRepo.GetTOTP(ctx, claims.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return toHTTPError(err)
+	}
+	// turned off since the password was checked
+	if !totp.IsEnabled() {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired challenge token")
+	}
+	if err := h.verifySecondFactor(c, totp, req.Code); err != nil {
+		return toHTTPError(err)
+	}
+
+	user, err := h.UserRepo.GetUser(ctx, claims.UserID)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	accountKey, _ := loginKeys(&loginRequest{}, user, "")
+	if err := h.LoginRepo.ResetLoginFailures(ctx, accountKey); err != nil {
+		return toHTTPError(err)
+	}
+	attempt := domain.LoginAttempt{UserID: user.ID, Identifier: user.Name, IP: c.RealIP(), Outcome: domain.LoginSucceeded}
+	if err := h.LoginRepo.AddLoginAttempt(ctx, attempt); err != nil {
+		return toHTTPError(err)
+	}
+
+	session, refreshToken, err := h.SessionRepo.AddSession(ctx, user.ID, h.RefreshTokenTTL)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return h.respondWithTokens(c, user, session, refreshToken)
+}
+
+// respondWithChallenge answers a right password of a user with two-factor authentication.
+func (h *Handler) respondWithChallenge(c echo.Context, user domain.User) error {
+	now := time.Now()
+	token, err := h.Keys.Sign(&challengeClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTTL)),
+		},
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, loginChallengeResponse{
+		ID:             user.ID,
+		Name:           user.Name,
+		TOTPRequired:   true,
+		ChallengeToken: token,
+		ExpiresIn:      int64(ChallengeTTL.Seconds()),
+	})
+}
+
+// requireStepUp asks users with two-factor authentication for a code before a top-up of
+// StepUpAmount or more. Users without it are let through.
+func (h *Handler) requireStepUp(c echo.Context, userID, amount int64, code string) error {
+	if h.StepUpAmount <= 0 || amount < h.StepUpAmount {
+		return nil
+	}
+
+	totp, err := h.TOTPRepo.GetTOTP(c.Request().Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return toHTTPError(err)
+	}
+	if !totp.IsEnabled() {
+		return nil
+	}
+	if code == "" {
+		return echo.NewHTTPError(http.StatusForbidden, errTOTPRequired)
+	}
+	if err := h.verifySecondFactor(c, totp, code); err != nil {
+		return secondFactorError(err)
+	}
+	return nil
+}
+
+// verifySecondFactor checks a code of the authenticator, or uses up a recovery code.
+// Wrong codes count as failed logins of the account, so they cannot be guessed any
+// faster than passwords.
+func (h *Handler) verifySecondFactor(c echo.Context, totp domain.TOTP, code string) error {
+	ctx := c.Request().Context()
+
+	attempt := domain.LoginAttempt{UserID: totp.UserID, Identifier: strconv.FormatInt(totp.UserID, 10), IP: c.RealIP()}
+	accountKey, clientKey := loginKeys(&loginRequest{}, domain.User{ID: totp.UserID}, attempt.IP)
+	if err := h.checkLockout(c, attempt, accountKey, clientKey); err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	var err error
+	if isTOTPCode(code) {
+		step, ok := domain.MatchTOTP(totp.Secret, code, time.Now())
+		if !ok {
+			err = errInvalidTOTPCode
+		} else {
+			err = h.TOTPRepo.UseTOTPStep(ctx, totp.UserID, step)
+		}
+	} else {
+		err = h.TOTPRepo.UseRecoveryCode(ctx, totp.UserID, normalizeRecoveryCode(code))
+	}
+	if err == nil || !errors.Is(err, db.ErrUnauthorized) {
+		return err
+	}
+
+	if err := h.recordLoginFailure(ctx, attempt, accountKey, clientKey); err != nil {
+		return err
+	}
+	return err
+}
+
+// secondFactorError answers a wrong code with 403, since 401 would log the client out.
+func secondFactorError(err error) error {
+	if errors.Is(err, db.ErrUnauthorized) {
+		return echo.NewHTTPError(http.StatusForbidden, err)
+	}
+	return toHTTPError(err)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != domain.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns codes of 80 random bits, written like abcd-efgh-ijkl-mnop.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode is how recovery codes are stored, whatever case and dashes they are typed with.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
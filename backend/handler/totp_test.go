@@ -0,0 +1,431 @@
+package handler_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+// totpCodes returns the code of the authenticator now, and one it does not accept.
+func totpCodes(t *testing.T, secret string) (string, string) {
+	t.Helper()
+
+	now := time.Now()
+	code, err := domain.TOTPCode(secret, domain.TOTPStep(now))
+	if err != nil {
+		t.Fatalf("failed TOTPCode: %s", err.Error())
+	}
+	n, _ := strconv.Atoi(code)
+	for {
+		n = (n + 1) % 1000000
+		wrong := fmt.Sprintf("%06d", n)
+		if _, ok := domain.MatchTOTP(secret, wrong, now); !ok {
+			return code, wrong
+		}
+	}
+}
+
+func newTOTPSecret(t *testing.T) string {
+	t.Helper()
+
+	secret, err := domain.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("failed NewTOTPSecret: %s", err.Error())
+	}
+	return secret
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	t.Parallel()
+	secret := newTOTPSecret(t)
+	code, wrong := totpCodes(t, secret)
+
+	cases := map[string]struct {
+		code           string
+		totp           domain.TOTP
+		wantEnable     bool
+		wantStatusCode int
+	}{
+		"200: enabled": {
+			code:           code,
+			totp:           domain.TOTP{UserID: 1, Secret: secret},
+			wantEnable:     true,
+			wantStatusCode: http.StatusOK,
+		},
+		"400: wrong code": {
+			code:           wrong,
+			totp:           domain.TOTP{UserID: 1, Secret: secret},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"409: already enabled": {
+			code:           code,
+			totp:           domain.TOTP{UserID: 1, Secret: secret, EnabledAt: "2023-06-01 00:00:00"},
+			wantStatusCode: http.StatusConflict,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, _ := json.Marshal(map[string]string{"code": tt.code})
+			req := httptest.NewRequest(http.MethodPost, "/users/me/totp/confirm", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, SessionID: "session"}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			totpRepo := db.NewMockTOTPRepository(ctrl)
+			totpRepo.EXPECT().GetTOTP(gomock.Any(), int64(1)).Return(tt.totp, nil).Times(1)
+			var stored []string
+			if tt.wantEnable {
+				totpRepo.EXPECT().EnableTOTP(gomock.Any(), int64(1), gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, _, _ int64, codes []string) error {
+					stored = codes
+					return nil
+				}).Times(1)
+			}
+
+			h := &handler.Handler{TOTPRepo: totpRepo}
+			checkStatusCode(t, h.ConfirmTOTP(c), rec, tt.wantStatusCode)
+			if !tt.wantEnable {
+				return
+			}
+
+			var resp struct {
+				RecoveryCodes []string `json:"recovery_codes"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if len(resp.RecoveryCodes) != 10 || len(stored) != 10 {
+				t.Fatalf("unexpected recovery codes: %v, stored: %v", resp.RecoveryCodes, stored)
+			}
+			// stored without the dashes they are shown with
+			if len(resp.RecoveryCodes[0]) != 19 || len(stored[0]) != 16 {
+				t.Fatalf("unexpected recovery code: %s, stored: %s", resp.RecoveryCodes[0], stored[0])
+			}
+		})
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	t.Parallel()
+	secret := newTOTPSecret(t)
+
+	cases := map[string]struct {
+		body           string
+		totp           domain.TOTP
+		getTOTPErr     error
+		wantDelete     bool
+		wantStatusCode int
+	}{
+		"204: a pending authenticator is dropped without a code": {
+			body:           `{}`,
+			totp:           domain.TOTP{UserID: 1, Secret: secret},
+			wantDelete:     true,
+			wantStatusCode: http.StatusNoContent,
+		},
+		"400: code too long": {
+			body:           `{"code": "` + strings.Repeat("a", 65) + `"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"403: code required once enabled": {
+			body:           `{}`,
+			totp:           domain.TOTP{UserID: 1, Secret: secret, EnabledAt: "2023-06-01 00:00:00"},
+			wantStatusCode: http.StatusForbidden,
+		},
+		"404: no authenticator": {
+			body:           `{}`,
+			getTOTPErr:     sql.ErrNoRows,
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/users/me/totp/disable", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, SessionID: "session"}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			totpRepo := db.NewMockTOTPRepository(ctrl)
+			if tt.wantStatusCode != http.StatusBadRequest {
+				totpRepo.EXPECT().GetTOTP(gomock.Any(), int64(1)).Return(tt.totp, tt.getTOTPErr).Times(1)
+			}
+			if tt.wantDelete {
+				totpRepo.EXPECT().DeleteTOTP(gomock.Any(), int64(1)).Return(nil).Times(1)
+			}
+
+			h := &handler.Handler{TOTPRepo: totpRepo}
+			checkStatusCode(t, h.DisableTOTP(c), rec, tt.wantStatusCode)
+		})
+	}
+}
+
+func TestLoginTOTP(t *testing.T) {
+	t.Parallel()
+	secret := newTOTPSecret(t)
+	code, wrong := totpCodes(t, secret)
+	alice := domain.User{ID: 1, Name: "alice"}
+
+	challenge, err := testKeys.Sign(jwt.MapClaims{
+		"user_id": 1,
+		"aud":     "login-totp",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("failed Sign: %s", err.Error())
+	}
+	// an access token is not a challenge token
+	access := signToken(t, jwt.SigningMethodHS256, &handler.JwtCustomClaims{UserID: 1, SessionID: "session", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+
+	cases := map[string]struct {
+		challenge       string
+		code            string
+		recoveryCodeErr error
+		wantCheck       bool
+		wantOutcome     domain.LoginOutcome
+		wantStatusCode  int
+	}{
+		"200: code of the authenticator": {
+			challenge:      challenge,
+			code:           code,
+			wantCheck:      true,
+			wantOutcome:    domain.LoginSucceeded,
+			wantStatusCode: http.StatusOK,
+		},
+		"200: recovery code": {
+			challenge:      challenge,
+			code:           "ABCD-efgh-ijkl-mnop",
+			wantCheck:      true,
+			wantOutcome:    domain.LoginSucceeded,
+			wantStatusCode: http.StatusOK,
+		},
+		"401: wrong code": {
+			challenge:      challenge,
+			code:           wrong,
+			wantCheck:      true,
+			wantOutcome:    domain.LoginFailed,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		"401: used recovery code": {
+			challenge:       challenge,
+			code:            "abcd-efgh-ijkl-mnop",
+			recoveryCodeErr: db.ErrInvalidRecoveryCode,
+			wantCheck:       true,
+			wantOutcome:     domain.LoginFailed,
+			wantStatusCode:  http.StatusUnauthorized,
+		},
+		"401: access token": {
+			challenge:      access,
+			code:           code,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, _ := json.Marshal(map[string]string{"challenge_token": tt.challenge, "code": tt.code})
+			req := httptest.NewRequest(http.MethodPost, "/login/totp", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			sessionRepo := db.NewMockSessionRepository(ctrl)
+			loginRepo := db.NewMockLoginRepository(ctrl)
+			totpRepo := db.NewMockTOTPRepository(ctrl)
+			if tt.wantCheck {
+				totpRepo.EXPECT().GetTOTP(gomock.Any(), int64(1)).Return(domain.TOTP{UserID: 1, Secret: secret, EnabledAt: "2023-06-01 00:00:00"}, nil).Times(1)
+				loginRepo.EXPECT().GetLockout(gomock.Any(), "user:1", "ip:192.0.2.1").Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginAttempt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, attempt domain.LoginAttempt) error {
+					if attempt.UserID != 1 || attempt.Outcome != tt.wantOutcome {
+						t.Fatalf("unexpected attempt: %+v", attempt)
+					}
+					return nil
+				}).Times(1)
+			}
+			if len(tt.code) == 6 {
+				totpRepo.EXPECT().UseTOTPStep(gomock.Any(), int64(1), gomock.Any()).Return(nil).MaxTimes(1)
+			} else {
+				totpRepo.EXPECT().UseRecoveryCode(gomock.Any(), int64(1), "abcdefghijklmnop").Return(tt.recoveryCodeErr).Times(1)
+			}
+			switch tt.wantOutcome {
+			case domain.LoginSucceeded:
+				userRepo.EXPECT().GetUser(gomock.Any(), int64(1)).Return(alice, nil).Times(1)
+				loginRepo.EXPECT().ResetLoginFailures(gomock.Any(), "user:1").Return(nil).Times(1)
+				sessionRepo.EXPECT().AddSession(gomock.Any(), int64(1), time.Hour).Return(domain.Session{ID: "session", UserID: 1}, "refresh", nil).Times(1)
+			case domain.LoginFailed:
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "user:1", handler.DefaultAccountThrottle).Return(time.Duration(0), nil).Times(1)
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), "ip:192.0.2.1", handler.DefaultIPThrottle).Return(time.Duration(0), nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{
+				UserRepo:        userRepo,
+				SessionRepo:     sessionRepo,
+				LoginRepo:       loginRepo,
+				TOTPRepo:        totpRepo,
+				Tx:              tx,
+				Keys:            testKeys,
+				AccessTokenTTL:  time.Minute,
+				RefreshTokenTTL: time.Hour,
+				AccountThrottle: handler.DefaultAccountThrottle,
+				IPThrottle:      handler.DefaultIPThrottle,
+			}
+			checkStatusCode(t, h.LoginTOTP(c), rec, tt.wantStatusCode)
+			if tt.wantOutcome != domain.LoginSucceeded {
+				return
+			}
+
+			var resp struct {
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if resp.Token == "" || resp.RefreshToken != "refresh" {
+				t.Fatalf("unexpected response: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAddBalanceStepUp(t *testing.T) {
+	t.Parallel()
+	secret := newTOTPSecret(t)
+	code, wrong := totpCodes(t, secret)
+	enabled := domain.TOTP{UserID: 1, Secret: secret, EnabledAt: "2023-06-01 00:00:00"}
+
+	cases := map[string]struct {
+		balance        int64
+		code           string
+		totp           domain.TOTP
+		totpErr        error
+		wantCheck      bool
+		wantCredit     bool
+		wantStatusCode int
+	}{
+		"200: below the step-up amount": {
+			balance:        9999,
+			wantCredit:     true,
+			wantStatusCode: http.StatusOK,
+		},
+		"200: without two-factor authentication": {
+			balance:        10000,
+			totpErr:        sql.ErrNoRows,
+			wantCredit:     true,
+			wantStatusCode: http.StatusOK,
+		},
+		"200: with the code": {
+			balance:        10000,
+			code:           code,
+			totp:           enabled,
+			wantCheck:      true,
+			wantCredit:     true,
+			wantStatusCode: http.StatusOK,
+		},
+		"403: without the code": {
+			balance:        10000,
+			totp:           enabled,
+			wantStatusCode: http.StatusForbidden,
+		},
+		"403: wrong code": {
+			balance:        10000,
+			code:           wrong,
+			totp:           enabled,
+			wantCheck:      true,
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, _ := json.Marshal(handler.AddBalanceRequest{Balance: tt.balance, TOTPCode: tt.code})
+			req := httptest.NewRequest(http.MethodPost, "/balance", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1, SessionID: "session"}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			userRepo := db.NewMockUserRepository(ctrl)
+			if tt.wantCredit {
+				userRepo.EXPECT().CreditBalance(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				userRepo.EXPECT().GetUser(gomock.Any(), int64(1)).Return(domain.User{ID: 1, Balance: tt.balance}, nil).Times(1)
+			}
+			totpRepo := db.NewMockTOTPRepository(ctrl)
+			if tt.balance >= 10000 {
+				totpRepo.EXPECT().GetTOTP(gomock.Any(), int64(1)).Return(tt.totp, tt.totpErr).Times(1)
+			}
+			loginRepo := db.NewMockLoginRepository(ctrl)
+			if tt.wantCheck {
+				loginRepo.EXPECT().GetLockout(gomock.Any(), "user:1", "ip:192.0.2.1").Return(time.Duration(0), nil).Times(1)
+				totpRepo.EXPECT().UseTOTPStep(gomock.Any(), int64(1), gomock.Any()).Return(nil).MaxTimes(1)
+			}
+			if tt.wantCheck && !tt.wantCredit {
+				loginRepo.EXPECT().AddLoginFailure(gomock.Any(), gomock.Any(), gomock.Any()).Return(time.Duration(0), nil).Times(2)
+				loginRepo.EXPECT().AddLoginAttempt(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			}
+			tx := db.NewMockTransactor(ctrl)
+			runTransaction(tx)
+
+			h := &handler.Handler{
+				UserRepo:        userRepo,
+				LoginRepo:       loginRepo,
+				TOTPRepo:        totpRepo,
+				Tx:              tx,
+				StepUpAmount:    handler.DefaultStepUpAmount,
+				AccountThrottle: handler.DefaultAccountThrottle,
+				IPThrottle:      handler.DefaultIPThrottle,
+			}
+			checkStatusCode(t, h.AddBalance(c), rec, tt.wantStatusCode)
+		})
+	}
+}
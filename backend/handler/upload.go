@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxImageSide   = 8192
+	maxImagePixels = 24_000_000
+	jpegQuality    = 90
+)
+
+var errUnsupportedImage = errors.New("image must be JPEG, PNG or WebP")
+
+// imageFormats maps the sniffed MIME types to the names the image decoders register.
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// normalizeImage validates an upload and re-encodes it from the decoded pixels, so that
+// nothing but the pixels is kept: no metadata such as the EXIF GPS location, no unknown
+// chunks and no data after the end of the image. The EXIF orientation is applied first.
+func normalizeImage(data []byte) (domain.ImageFile, error) {
+	contentType := http.DetectContentType(data)
+	format, ok := imageFormats[contentType]
+	if !ok {
+		return domain.ImageFile{}, errUnsupportedImage
+	}
+
+	// check the size before decoding, which allocates every pixel
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return domain.ImageFile{}, fmt.Errorf("corrupt %s image", format)
+	}
+	if cfg.Width > maxImageSide || cfg.Height > maxImageSide || cfg.Width*cfg.Height > maxImagePixels {
+		return domain.ImageFile{}, fmt.Errorf("image is too large: %dx%d, up to %dx%d and %d pixels", cfg.Width, cfg.Height, maxImageSide, maxImageSide, maxImagePixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return domain.ImageFile{}, fmt.Errorf("corrupt %s image", format)
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	var buf bytes.Buffer
+	// there is no WebP encoder, so WebP becomes PNG when it has transparency and JPEG otherwise
+	if format == "png" || (format == "webp" && !isOpaque(img)) {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return domain.ImageFile{}, err
+	}
+	return domain.ImageFile{ContentType: contentType, Data: buf.Bytes()}, nil
+}
+
+// jpegOrientation reads the EXIF orientation tag. It is 1, upright, when missing.
+func jpegOrientation(data []byte) int {
+	for p := 2; p+4 <= len(data) && data[p] == 0xFF && data[p+1] != 0xDA; {
+		// the length counts its own two bytes, so anything below 2 is corrupt
+		end := p + 2 + int(binary.BigEndian.Uint16(data[p+2:]))
+		if end < p+4 || end > len(data) {
+			return 1
+		}
+		if seg := data[p+4 : end]; data[p+1] == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		p = end
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns the pixels the way an EXIF orientation tells a viewer to.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	// 5 to 8 swap the width and the height
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// getImage reads the "image" form field as a normalized image.
+func getImage(c echo.Context) (domain.ImageFile, error) {
+	data, err := getImageByte(c)
+	if err != nil {
+		return domain.ImageFile{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("getImageByte error: %v", err))
+	}
+	img, err := normalizeImage(data)
+	if errors.Is(err, errUnsupportedImage) {
+		return domain.ImageFile{}, echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+	}
+	if err != nil {
+		return domain.ImageFile{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return img, nil
+}
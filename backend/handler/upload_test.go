@@ -0,0 +1,226 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("failed png.Encode: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("failed jpeg.Encode: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+// testPNGWithChunk puts a chunk of the given type right after IHDR.
+func testPNGWithChunk(t *testing.T, typ string, data []byte) []byte {
+	t.Helper()
+
+	orig := testPNG(t)
+	// the signature and the 25 bytes of IHDR
+	const ihdrEnd = 8 + 25
+	chunk := append([]byte(typ), data...)
+	res := append([]byte{}, orig[:ihdrEnd]...)
+	res = binary.BigEndian.AppendUint32(res, uint32(len(data)))
+	res = append(res, chunk...)
+	res = binary.BigEndian.AppendUint32(res, crc32.ChecksumIEEE(chunk))
+	return append(res, orig[ihdrEnd:]...)
+}
+
+// testJPEGWithExif is 16x8, red on the left and blue on the right,
+// with an EXIF orientation of 6 (rotate 90 degrees clockwise) and a GPS tag.
+func testJPEGWithExif(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 8 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed jpeg.Encode: %s", err.Error())
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = append(tiff, 0, 2)
+	// orientation, SHORT, 1, 6
+	tiff = append(tiff, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0)
+	// GPS IFD pointer, LONG, 1, a made up offset
+	tiff = append(tiff, 0x88, 0x25, 0, 4, 0, 0, 0, 1, 0, 0, 0, 0x26)
+	tiff = append(tiff, 0, 0, 0, 0)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(app1)+2))
+
+	data := buf.Bytes()
+	res := append([]byte{}, data[:2]...)
+	res = append(res, seg...)
+	res = append(res, app1...)
+	return append(res, data[2:]...)
+}
+
+// testPNGHeader is a valid IHDR claiming the size, without any pixel data.
+func testPNGHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 0
+	chunk := append([]byte("IHDR"), ihdr...)
+	res := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), chunk...)
+	return binary.BigEndian.AppendUint32(res, crc32.ChecksumIEEE(chunk))
+}
+
+func TestAddItemImageUpload(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		image          []byte
+		check          func(t *testing.T, img domain.ImageFile)
+		wantStatusCode int
+	}{
+		"200: PNG stays PNG": {
+			image: testPNG(t),
+			check: func(t *testing.T, img domain.ImageFile) {
+				if img.ContentType != "image/png" {
+					t.Fatalf("unexpected content type: %s", img.ContentType)
+				}
+				if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+					t.Fatalf("failed png.Decode: %s", err.Error())
+				}
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: data after the end of a JPEG is dropped": {
+			image: append(testJPEG(t), "trailing secret"...),
+			check: func(t *testing.T, img domain.ImageFile) {
+				if img.ContentType != "image/jpeg" || bytes.Contains(img.Data, []byte("trailing secret")) {
+					t.Fatalf("trailing data is left in the %s image", img.ContentType)
+				}
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: private PNG chunks are dropped": {
+			image: testPNGWithChunk(t, "prVt", []byte("private secret")),
+			check: func(t *testing.T, img domain.ImageFile) {
+				if img.ContentType != "image/png" || bytes.Contains(img.Data, []byte("prVt")) || bytes.Contains(img.Data, []byte("private secret")) {
+					t.Fatalf("the private chunk is left in the %s image", img.ContentType)
+				}
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"200: EXIF is stripped and the orientation applied": {
+			image: testJPEGWithExif(t),
+			check: func(t *testing.T, img domain.ImageFile) {
+				if img.ContentType != "image/jpeg" || bytes.Contains(img.Data, []byte("Exif")) {
+					t.Fatalf("EXIF is left in the %s image", img.ContentType)
+				}
+				decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+				if err != nil {
+					t.Fatalf("failed jpeg.Decode: %s", err.Error())
+				}
+				if b := decoded.Bounds(); b.Dx() != 8 || b.Dy() != 16 {
+					t.Fatalf("unexpected size: %dx%d", b.Dx(), b.Dy())
+				}
+				// the red left half is on the top after turning clockwise
+				if r, _, b, _ := decoded.At(4, 2).RGBA(); r < b {
+					t.Fatalf("the top is not red")
+				}
+				if r, _, b, _ := decoded.At(4, 13).RGBA(); r > b {
+					t.Fatalf("the bottom is not blue")
+				}
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		// a segment length below 2 once made jpegOrientation slice out of range
+		"200: JPEG with a segment shorter than its length field": {
+			image: append([]byte{0xFF, 0xD8, 0xFF, 0x00, 0x00, 0x00}, testJPEG(t)[2:]...),
+			check: func(t *testing.T, img domain.ImageFile) {
+				if img.ContentType != "image/jpeg" {
+					t.Fatalf("unexpected content type: %s", img.ContentType)
+				}
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		"400: corrupt PNG":            {image: testPNGHeader(1, 1), wantStatusCode: http.StatusBadRequest},
+		"400: too large":              {image: testPNGHeader(10000, 10), wantStatusCode: http.StatusBadRequest},
+		"415: not an image":           {image: []byte("image"), wantStatusCode: http.StatusUnsupportedMediaType},
+		"415: unsupported image type": {image: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), wantStatusCode: http.StatusUnsupportedMediaType},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			body, contentType := newItemFormWithImage(t, tt.image)
+			req := httptest.NewRequest(http.MethodPost, "/items/1/images", body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("itemID")
+			c.SetParamValues("1")
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1}})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			itemRepo := db.NewMockItemRepository(ctrl)
+			itemRepo.EXPECT().GetItemWithoutImage(gomock.Any(), int64(1)).Return(domain.Item{ID: 1, UserID: 1}, nil).Times(1)
+			if tt.check != nil {
+				itemRepo.EXPECT().AddItemImage(gomock.Any(), int64(1), gomock.Any()).DoAndReturn(func(_ any, _ int64, img domain.ImageFile) (domain.ItemImage, error) {
+					tt.check(t, img)
+					return domain.ItemImage{ID: 1, Position: 1}, nil
+				}).Times(1)
+			}
+
+			h := &handler.Handler{ItemRepo: itemRepo}
+			if err := h.AddItemImage(c); err != nil {
+				echoErr, ok := err.(*echo.HTTPError)
+				if !ok {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				if tt.wantStatusCode != echoErr.Code {
+					t.Fatalf("unexpected status code: want: %d, got: %d (%v)", tt.wantStatusCode, echoErr.Code, echoErr.Message)
+				}
+				return
+			}
+			if tt.wantStatusCode != rec.Code {
+				t.Fatalf("unexpected status code: want: %d, got: %d", tt.wantStatusCode, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fieldError is a rule a request field failed. Field is the name the client sent it by.
+type fieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+type validationErrorResponse struct {
+	Message string       `json:"message"`
+	Errors  []fieldError `json:"errors"`
+}
+
+// bindRequest binds the request into req and checks the rules in its validate tags.
+// Every failing field is listed in the 400 response, with the first rule it failed.
+func bindRequest(c echo.Context, req any) error {
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if errs := validate(req); len(errs) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, validationErrorResponse{Message: "validation failed", Errors: errs})
+	}
+	return nil
+}
+
+// validate checks the comma separated rules in the validate tags of a struct:
+//
+//	required            not zero, blank or empty
+//	required_without=f  required when the field named f is zero
+//	min=n, max=n        the value of numbers, the characters of strings and the length of slices
+//	maxbytes=n          the bytes of strings
+//	email               a bare address such as alice@example.com
+//
+// Rules other than required and required_without pass on zero values, so that
+// optional fields are only checked when they are set.
+func validate(req any) []fieldError {
+	v := reflect.Indirect(reflect.ValueOf(req))
+	t := v.Type()
+
+	var errs []fieldError
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(rule, "=")
+			if !checkRule(v, v.Field(i), name, param) {
+				errs = append(errs, fieldError{Field: fieldName(t.Field(i)), Rule: name, Param: param})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func checkRule(parent, field reflect.Value, rule, param string) bool {
+	switch rule {
+	case "required":
+		return !isBlank(field)
+	case "required_without":
+		other, ok := fieldByName(parent, param)
+		if !ok {
+			panic(fmt.Sprintf("validate: no field %q", param))
+		}
+		return !isBlank(other) || !isBlank(field)
+	}
+
+	if isBlank(field) {
+		return true
+	}
+	if rule == "email" {
+		addr, err := netmail.ParseAddress(field.String())
+		return err == nil && addr.Address == field.String()
+	}
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid parameter of %s: %q", rule, param))
+	}
+	switch rule {
+	case "min":
+		return size(field) >= n
+	case "max":
+		return size(field) <= n
+	case "maxbytes":
+		return int64(len(field.String())) <= n
+	}
+	panic(fmt.Sprintf("validate: unknown rule %q", rule))
+}
+
+func isBlank(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func size(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map:
+		return int64(v.Len())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if fieldName(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// fieldName is the json or form name of the field.
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
@@ -0,0 +1,112 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequestValidation(t *testing.T) {
+	t.Parallel()
+	itemForm := func(fields map[string]string) string {
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		return form.Encode()
+	}
+
+	cases := map[string]struct {
+		action      func(*handler.Handler, echo.Context) error
+		contentType string
+		body        string
+		wantErrors  string
+	}{
+		"register: blank name and long password": {
+			action:     (*handler.Handler).Register,
+			body:       `{"name": "  ", "password": "` + strings.Repeat("p", 73) + `"}`,
+			wantErrors: `[{"field":"name","rule":"required"},{"field":"password","rule":"maxbytes","param":"72"}]`,
+		},
+		"register: long name": {
+			action:     (*handler.Handler).Register,
+			body:       `{"name": "` + strings.Repeat("名", 51) + `", "password": "password"}`,
+			wantErrors: `[{"field":"name","rule":"max","param":"50"}]`,
+		},
+		"register: invalid email": {
+			action:     (*handler.Handler).Register,
+			body:       `{"name": "alice", "password": "password", "email": "Alice <alice@example.com>"}`,
+			wantErrors: `[{"field":"email","rule":"email"}]`,
+		},
+		"login: neither name nor user id": {
+			action:     (*handler.Handler).Login,
+			body:       `{"password": ""}`,
+			wantErrors: `[{"field":"user_id","rule":"required_without","param":"name"},{"field":"name","rule":"required_without","param":"user_id"},{"field":"password","rule":"required"}]`,
+		},
+		"add item: every field": {
+			action:      (*handler.Handler).AddItem,
+			contentType: echo.MIMEApplicationForm,
+			body:        itemForm(map[string]string{"category_id": "0", "price": "-100", "description": strings.Repeat("d", 1001)}),
+			wantErrors:  `[{"field":"name","rule":"required"},{"field":"category_id","rule":"required"},{"field":"price","rule":"min","param":"1"},{"field":"description","rule":"max","param":"1000"}]`,
+		},
+		"sell: no item id": {
+			action:     (*handler.Handler).Sell,
+			body:       `{}`,
+			wantErrors: `[{"field":"item_id","rule":"required"}]`,
+		},
+		"add balance: negative": {
+			action:     (*handler.Handler).AddBalance,
+			body:       `{"balance": -1}`,
+			wantErrors: `[{"field":"balance","rule":"min","param":"1"}]`,
+		},
+	}
+
+	for name, tt := range cases {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = echo.MIMEApplicationJSON
+			}
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("user", &jwt.Token{Claims: &handler.JwtCustomClaims{UserID: 1}})
+
+			// the repositories are nil, so anything past the validation panics
+			err := tt.action(&handler.Handler{}, c)
+			echoErr, ok := err.(*echo.HTTPError)
+			if !ok {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if echoErr.Code != http.StatusBadRequest {
+				t.Fatalf("unexpected status code: want: %d, got: %d", http.StatusBadRequest, echoErr.Code)
+			}
+
+			body, err := json.Marshal(echoErr.Message)
+			if err != nil {
+				t.Fatalf("failed json.Marshal: %s", err.Error())
+			}
+			var resp struct {
+				Errors json.RawMessage `json:"errors"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("unexpected error for json.Unmarshal: %s", err.Error())
+			}
+			if string(resp.Errors) != tt.wantErrors {
+				t.Fatalf("unexpected errors:\nwant: %s\ngot:  %s", tt.wantErrors, resp.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+//go:generate mockgen -source=$GOFILE -destination=mock_$GOFILE -package=$GOPACKAGE
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a plain text email to one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends through an SMTP server, upgrading to TLS when the server offers STARTTLS.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer sends from the address from through the server at addr, logging in with
+// PLAIN when username is set. net/smtp only sends the password over TLS or to localhost.
+func NewSMTPMailer(addr, from, username, password string) Mailer {
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send does not stop when ctx is done, net/smtp has no way to.
+func (m *SMTPMailer) Send(_ context.Context, msg Message) error {
+	data, err := m.format(msg)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, data), "failed to send mail")
+}
+
+func (m *SMTPMailer) format(msg Message) ([]byte, error) {
+	// a line break would let the values add headers of their own
+	for _, v := range []string{m.From, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("mail headers cannot contain line breaks")
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
+
+// LogMailer writes the emails to the log instead of sending them. It is for development only,
+// since the log gets the reset links.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpStandIn accepts one message on a local port without TLS or auth, like MailHog does.
+type smtpStandIn struct {
+	listener net.Listener
+	rcpt     chan string
+	data     chan string
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed net.Listen: %s", err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &smtpStandIn{listener: l, rcpt: make(chan string, 1), data: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	c, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	conn := textproto.NewConn(c)
+	reply := func(line string) { _ = conn.PrintfLine("%s", line) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			s.rcpt <- arg
+			reply("250 OK")
+		case "DATA":
+			reply("354 end with .")
+			lines, err := conn.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.data <- strings.Join(lines, "\n")
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	t.Parallel()
+	s := startSMTPStandIn(t)
+
+	m := NewSMTPMailer(s.listener.Addr().String(), "no-reply@example.com", "", "")
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Reset your password", Body: "line 1\nline 2"}); err != nil {
+		t.Fatalf("failed Send: %s", err.Error())
+	}
+
+	if rcpt := <-s.rcpt; rcpt != "TO:<alice@example.com>" {
+		t.Fatalf("unexpected recipient: %s", rcpt)
+	}
+	data := <-s.data
+	header, body, _ := strings.Cut(data, "\n\n")
+	for _, want := range []string{"From: no-reply@example.com", "To: alice@example.com", "Subject: Reset your password", "Content-Type: text/plain; charset=utf-8"} {
+		if !strings.Contains(header, want) {
+			t.Fatalf("%q is missing from the header:\n%s", want, header)
+		}
+	}
+	if body != "line 1\nline 2" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	t.Parallel()
+
+	m := NewSMTPMailer("127.0.0.1:0", "no-reply@example.com", "", "")
+	if err := m.Send(context.Background(), Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "hi"}); err == nil {
+		t.Fatalf("a line break in To is accepted")
+	}
+}
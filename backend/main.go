@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -9,11 +11,14 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/db"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/domain"
 	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/handler"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/NamikoToriyama/mecari-build-hackathon-2023/backend/mail"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -25,14 +30,24 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gc-images" {
+		os.Exit(gcImages(context.Background(), os.Args[2:]))
+	}
 	os.Exit(run(context.Background()))
 }
 
 func run(ctx context.Context) int {
 	e := echo.New()
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
 
 	// Middleware
 	e.Use(middleware.Recover())
+	e.Use(middleware.RequestID())
+	// failed logins are counted per client address, which X-Forwarded-For would let clients choose
+	e.IPExtractor = echo.ExtractIPDirect()
+	if os.Getenv("TRUST_PROXY") == "true" {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
 
 	logfile := os.Getenv("LOGFILE")
 	if logfile == "" {
@@ -56,17 +71,11 @@ func run(ctx context.Context) int {
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{frontURL},
 		AllowMethods: []string{"GET", "PUT", "DELETE", "OPTIONS", "POST"},
+		// let the frontend read the cursors of paged lists
+		ExposeHeaders: []string{handler.HeaderNextCursor, handler.HeaderPrevCursor, echo.HeaderXRequestID},
 	}))
 	e.Use(middleware.BodyLimit("5M"))
 
-	// jwt
-	config := echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(handler.JwtCustomClaims)
-		},
-		SigningKey: []byte(handler.GetSecret()),
-	}
-
 	// db
 	sqlDB, err := db.PrepareDB(ctx)
 	if err != nil {
@@ -79,34 +88,228 @@ func run(ctx context.Context) int {
 		}
 	}()
 
+	blobs, err := newBlobStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare blob store: %s\n", err)
+		return exitError
+	}
+
+	keys, err := newKeyset()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare JWT keys: %s\n", err)
+		return exitError
+	}
+
 	h := handler.Handler{
-		DB:       sqlDB,
-		UserRepo: db.NewUserRepository(sqlDB),
-		ItemRepo: db.NewItemRepository(sqlDB),
+		DB:                 sqlDB,
+		UserRepo:           db.NewUserRepository(sqlDB),
+		ItemRepo:           db.NewItemRepository(sqlDB, blobs),
+		LedgerRepo:         db.NewLedgerRepository(sqlDB),
+		OrderRepo:          db.NewOrderRepository(sqlDB),
+		SessionRepo:        db.NewSessionRepository(sqlDB),
+		Tx:                 db.NewTransactor(sqlDB),
+		Keys:               keys,
+		PasswordResetRepo:  db.NewPasswordResetRepository(sqlDB),
+		PasswordResetURL:   frontURL + "/password/reset?token=",
+		Mailer:             newMailer(),
+		LoginRepo:          db.NewLoginRepository(sqlDB),
+		TOTPRepo:           db.NewTOTPRepository(sqlDB),
+		AccountThrottle:    handler.DefaultAccountThrottle,
+		IPThrottle:         handler.DefaultIPThrottle,
+		ResetEmailThrottle: handler.DefaultResetEmailThrottle,
+		ResetIPThrottle:    handler.DefaultResetIPThrottle,
 	}
 
-	// Routes
-	e.POST("/initialize", h.Initialize)
-	e.GET("/log", h.AccessLog)
+	h.EscrowTimeout = handler.DefaultEscrowTimeout
+	if escrowTimeout := os.Getenv("ESCROW_TIMEOUT"); escrowTimeout != "" {
+		h.EscrowTimeout, err = time.ParseDuration(escrowTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid ESCROW_TIMEOUT: %s\n", err)
+			return exitError
+		}
+	}
+	h.AccessTokenTTL = handler.DefaultAccessTokenTTL
+	if ttl := os.Getenv("ACCESS_TOKEN_TTL"); ttl != "" {
+		h.AccessTokenTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid ACCESS_TOKEN_TTL: %s\n", err)
+			return exitError
+		}
+	}
+	h.RefreshTokenTTL = handler.DefaultRefreshTokenTTL
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL"); ttl != "" {
+		h.RefreshTokenTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid REFRESH_TOKEN_TTL: %s\n", err)
+			return exitError
+		}
+	}
+	h.PasswordResetTTL = handler.DefaultPasswordResetTTL
+	if ttl := os.Getenv("PASSWORD_RESET_TTL"); ttl != "" {
+		h.PasswordResetTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid PASSWORD_RESET_TTL: %s\n", err)
+			return exitError
+		}
+	}
+	h.PasswordPolicy = handler.DefaultPasswordPolicy
+	if n := os.Getenv("PASSWORD_MIN_LENGTH"); n != "" {
+		h.PasswordPolicy.MinLength, err = strconv.Atoi(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid PASSWORD_MIN_LENGTH: %s\n", err)
+			return exitError
+		}
+	}
+	if n := os.Getenv("PASSWORD_MIN_CLASSES"); n != "" {
+		h.PasswordPolicy.MinClasses, err = strconv.Atoi(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid PASSWORD_MIN_CLASSES: %s\n", err)
+			return exitError
+		}
+	}
+	if n := os.Getenv("LOGIN_MAX_FAILURES"); n != "" {
+		h.AccountThrottle.MaxFailures, err = strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOGIN_MAX_FAILURES: %s\n", err)
+			return exitError
+		}
+	}
+	if n := os.Getenv("LOGIN_MAX_IP_FAILURES"); n != "" {
+		h.IPThrottle.MaxFailures, err = strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOGIN_MAX_IP_FAILURES: %s\n", err)
+			return exitError
+		}
+	}
+	// the lockouts apply to accounts and clients alike
+	if lockout := os.Getenv("LOGIN_LOCKOUT"); lockout != "" {
+		h.AccountThrottle.Lockout, err = time.ParseDuration(lockout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOGIN_LOCKOUT: %s\n", err)
+			return exitError
+		}
+		h.IPThrottle.Lockout = h.AccountThrottle.Lockout
+	}
+	if lockout := os.Getenv("LOGIN_MAX_LOCKOUT"); lockout != "" {
+		h.AccountThrottle.MaxLockout, err = time.ParseDuration(lockout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOGIN_MAX_LOCKOUT: %s\n", err)
+			return exitError
+		}
+		h.IPThrottle.MaxLockout = h.AccountThrottle.MaxLockout
+	}
+	h.StepUpAmount = handler.DefaultStepUpAmount
+	if amount := os.Getenv("STEP_UP_AMOUNT"); amount != "" {
+		h.StepUpAmount, err = strconv.ParseInt(amount, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid STEP_UP_AMOUNT: %s\n", err)
+			return exitError
+		}
+	}
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id == "" {
+			continue
+		}
+		adminID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid ADMIN_USER_IDS: %s\n", err)
+			return exitError
+		}
+		h.AdminUserIDs = append(h.AdminUserIDs, adminID)
+	}
+	if err := h.GrantAdminRoles(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to grant admin roles: %s\n", err)
+		return exitError
+	}
 
+	imageGCInterval := 24 * time.Hour
+	if interval := os.Getenv("IMAGE_GC_INTERVAL"); interval != "" {
+		imageGCInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid IMAGE_GC_INTERVAL: %s\n", err)
+			return exitError
+		}
+	}
+
+	jobCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go releaseExpiredOrders(jobCtx, &h)
+	if imageGCInterval > 0 {
+		go collectImageGarbage(jobCtx, sqlDB, blobs, imageGCInterval)
+	}
+
+	// jwt, checking that the session of the token has not been revoked
+	config := echojwt.Config{
+		ParseTokenFunc: h.ParseToken,
+	}
+
+	// Routes
 	e.GET("/items", h.GetOnSaleItems)
 	e.GET("/items/:itemID", h.GetItem)
 	e.GET("/items/:itemID/image", h.GetImage)
+	e.GET("/items/:itemID/images", h.GetItemImages)
+	e.GET("/items/:itemID/images/:index", h.GetImageByIndex)
 	e.GET("/search", h.SearchItems)
 	e.GET("/items/categories", h.GetCategories)
+	e.GET("/items/categories/tree", h.GetCategoryTree)
 	e.POST("/register", h.Register)
+	e.GET("/register/available", h.GetNameAvailability)
 	e.POST("/login", h.Login)
+	e.POST("/login/totp", h.LoginTOTP)
+	e.POST("/refresh", h.Refresh)
+	e.POST("/password/reset", h.RequestPasswordReset)
+	e.POST("/password/reset/confirm", h.ResetPassword)
+	e.GET("/.well-known/jwks.json", h.GetJWKS)
 
 	// Login required
 	l := e.Group("")
 	l.Use(echojwt.WithConfig(config))
+	l.POST("/logout", h.Logout)
+	l.PUT("/users/me/password", h.ChangePassword)
+	l.POST("/users/me/totp", h.EnrollTOTP)
+	l.POST("/users/me/totp/confirm", h.ConfirmTOTP)
+	l.POST("/users/me/totp/disable", h.DisableTOTP)
 	l.GET("/users/:userID/items", h.GetUserItems)
 	l.POST("/items", h.AddItem)
 	l.PUT("/items/:itemID", h.UpdateItem)
+	l.DELETE("/items/:itemID", h.DeleteItem)
+	l.PUT("/items/:itemID/image", h.UpdateItemImage)
+	l.POST("/items/:itemID/images", h.AddItemImage)
+	l.PUT("/items/:itemID/images/order", h.ReorderItemImages)
+	l.POST("/items/:itemID/images/:imageID/cover", h.SetItemCover)
+	l.DELETE("/items/:itemID/images/:imageID", h.DeleteItemImage)
 	l.POST("/sell", h.Sell)
+	l.POST("/items/:itemID/pause", h.PauseItem)
+	l.POST("/items/:itemID/withdraw", h.WithdrawItem)
+	l.POST("/items/:itemID/relist", h.RelistItem)
 	l.POST("/purchase/:itemID", h.Purchase)
 	l.GET("/balance", h.GetBalance)
 	l.POST("/balance", h.AddBalance)
+	l.GET("/balance/history", h.GetBalanceHistory)
+	l.GET("/orders", h.GetOrders)
+	l.GET("/orders/:orderID", h.GetOrder)
+	l.POST("/orders/:orderID/ship", h.ShipOrder)
+	l.POST("/orders/:orderID/deliver", h.DeliverOrder)
+	l.POST("/orders/:orderID/receive", h.ReceiveOrder)
+	l.POST("/orders/:orderID/cancel", h.CancelOrder)
+
+	// Moderators and admins
+	m := l.Group("/admin/categories")
+	m.Use(h.RequireRole(domain.RoleModerator))
+	m.GET("", h.AdminGetCategories)
+	m.POST("", h.AddCategory)
+	m.PUT("/order", h.ReorderCategories)
+	m.PUT("/:categoryID", h.RenameCategory)
+	m.PUT("/:categoryID/parent", h.MoveCategory)
+	m.POST("/:categoryID/retire", h.RetireCategory)
+
+	// Admin only. /initialize and /log keep the paths the benchmarker calls.
+	admin := h.RequireRole(domain.RoleAdmin)
+	l.POST("/initialize", h.Initialize, admin)
+	l.GET("/log", h.AccessLog, admin)
+	a := l.Group("/admin")
+	a.Use(admin)
+	a.PUT("/users/:userID/role", h.SetUserRole)
 
 	// Start server
 	go func() {
@@ -123,14 +326,107 @@ func run(ctx context.Context) int {
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
+	// emails still being sent
+	h.Wait()
+
+	return exitOK
+}
+
+// releaseExpiredOrders settles the orders that have waited longer than the escrow timeout.
+func releaseExpiredOrders(ctx context.Context, h *handler.Handler) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.ReleaseExpiredOrders(ctx); err != nil {
+				log.Printf("failed h.ReleaseExpiredOrders: %s", err.Error())
+			}
+		}
+	}
+}
+
+// collectImageGarbage deletes the images no item refers to.
+func collectImageGarbage(ctx context.Context, sqlDB *sql.DB, blobs db.BlobStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := db.CollectImageGarbage(ctx, sqlDB, blobs, false, db.DefaultImageGCMinAge)
+			if err != nil {
+				log.Printf("failed db.CollectImageGarbage: %s", err.Error())
+			}
+			printImageGCReport(log.Writer(), report)
+		}
+	}
+}
+
+// gcImages is the gc-images command, which runs the image garbage collection once.
+func gcImages(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("gc-images", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report without deleting anything")
+	minAge := flags.Duration("min-age", db.DefaultImageGCMinAge, "keep orphan blobs younger than this, which may be uploads in progress")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	sqlDB, err := db.PrepareDB(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare DB: %s\n", err)
+		return exitError
+	}
+	defer func() {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("failed sqlDB.Close: %s", err.Error())
+		}
+	}()
+	blobs, err := newBlobStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare blob store: %s\n", err)
+		return exitError
+	}
 
+	report, err := db.CollectImageGarbage(ctx, sqlDB, blobs, *dryRun, *minAge)
+	printImageGCReport(os.Stdout, report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to collect image garbage: %s\n", err)
+		return exitError
+	}
 	return exitOK
 }
 
+func printImageGCReport(w io.Writer, report db.ImageGCReport) {
+	for _, b := range report.OrphanBlobs {
+		fmt.Fprintf(w, "orphan blob\t%s\t%d bytes\t%s\n", b.Key, b.Size, b.ModTime.Format(time.RFC3339))
+	}
+	for _, img := range report.OrphanImages {
+		fmt.Fprintf(w, "image of a deleted item\timage %d\titem %d\t%s\n", img.ID, img.ItemID, img.BlobKey)
+	}
+	for _, img := range report.MissingBlobs {
+		fmt.Fprintf(w, "missing blob\timage %d\titem %d\t%s\n", img.ID, img.ItemID, img.BlobKey)
+	}
+	for _, id := range report.ItemsWithoutImages {
+		fmt.Fprintf(w, "item without images\titem %d\n", id)
+	}
+
+	action := "found"
+	if report.Deleted {
+		action = "deleted"
+	}
+	fmt.Fprintf(w, "image gc: %s %d orphan blobs and %d images of deleted items, %d missing blobs, %d items without images\n",
+		action, len(report.OrphanBlobs), len(report.OrphanImages), len(report.MissingBlobs), len(report.ItemsWithoutImages))
+}
+
 func logFormat() string {
 	// Customize freely: https://echo.labstack.com/guide/customization/
 	var format string
 	format += "time:${time_rfc3339}\t"
+	format += "id:${id}\t"
 	format += "status:${status}\t"
 	format += "method:${method}\t"
 	format += "uri:${uri}\t"
@@ -148,3 +444,67 @@ func logFormat() string {
 
 	return format
 }
+
+// newKeyset loads the keys in JWT_KEY_DIR, or falls back to the HS256 SECRET.
+// The default secret is only accepted with DEV_MODE=true.
+func newKeyset() (*handler.Keyset, error) {
+	if dir := os.Getenv("JWT_KEY_DIR"); dir != "" {
+		return handler.LoadKeyset(dir, os.Getenv("JWT_SIGNING_KEY_ID"))
+	}
+
+	secret := os.Getenv("SECRET")
+	if secret == "" {
+		secret = handler.DevSecret
+	}
+	if secret == handler.DevSecret {
+		if os.Getenv("DEV_MODE") != "true" {
+			return nil, fmt.Errorf("set JWT_KEY_DIR or SECRET, the default secret is only for DEV_MODE=true")
+		}
+		log.Printf("signing tokens with the default secret in dev mode")
+	}
+	return handler.NewSecretKeyset(secret), nil
+}
+
+// newMailer sends through SMTP_ADDR. Without it, emails are written to the log in dev mode,
+// and password reset is turned off otherwise.
+func newMailer() mail.Mailer {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		if os.Getenv("DEV_MODE") == "true" {
+			log.Printf("writing emails to the log in dev mode")
+			return mail.LogMailer{}
+		}
+		return nil
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	return mail.NewSMTPMailer(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+}
+
+// newBlobStore picks where images are kept from BLOB_STORE.
+// Replicas need "s3" unless they share IMAGE_DIR.
+func newBlobStore() (db.BlobStore, error) {
+	switch store := os.Getenv("BLOB_STORE"); store {
+	case "", "local":
+		dir := os.Getenv("IMAGE_DIR")
+		if dir == "" {
+			dir = db.FILE_DIR
+		}
+		return db.NewLocalBlobStore(dir), nil
+	case "s3":
+		endpoint, bucket := os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for BLOB_STORE=s3")
+		}
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return db.NewS3BlobStore(endpoint, region, bucket, os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY")), nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE: %s", store)
+	}
+}
@@ -1,4 +1,15 @@
 DROP TABLE items;
 DROP TABLE users;
 DROP TABLE category;
-DROP TABLE status;
\ No newline at end of file
+DROP TABLE status;
+DROP TABLE balance_ledger;
+DROP TABLE orders;
+DROP TABLE items_fts;
+DROP TABLE item_images;
+DROP TABLE sessions;
+DROP TABLE refresh_tokens;
+DROP TABLE password_resets;
+DROP TABLE login_failures;
+DROP TABLE login_attempts;
+DROP TABLE user_totp;
+DROP TABLE recovery_codes;
\ No newline at end of file
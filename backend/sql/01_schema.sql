@@ -12,6 +12,32 @@ CREATE TABLE IF NOT EXISTS items
     updated_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
 );
 
+-- full-text index over items. trigram tokens match substrings in any language
+CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts5
+(
+    name,
+    description,
+    content='items',
+    content_rowid='id',
+    tokenize='trigram'
+);
+
+CREATE TRIGGER IF NOT EXISTS items_fts_insert AFTER INSERT ON items
+BEGIN
+    INSERT INTO items_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_fts_delete AFTER DELETE ON items
+BEGIN
+    INSERT INTO items_fts (items_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_fts_update AFTER UPDATE OF name, description ON items
+BEGIN
+    INSERT INTO items_fts (items_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+    INSERT INTO items_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+
 CREATE TABLE IF NOT EXISTS users
 (
     id       integer primary key autoincrement,
@@ -30,4 +56,136 @@ CREATE TABLE IF NOT EXISTS status
 (
     id   integer primary key,
     name varchar(50)
-);
\ No newline at end of file
+);
+
+-- append-only history of every balance movement
+CREATE TABLE IF NOT EXISTS balance_ledger
+(
+    id            integer primary key autoincrement,
+    user_id       integer NOT NULL,
+    entry_type    varchar(20) NOT NULL,
+    amount        integer NOT NULL,
+    balance_after integer NOT NULL,
+    item_id       integer,
+    created_at    text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS balance_ledger_user_id ON balance_ledger (user_id, id);
+
+CREATE TRIGGER IF NOT EXISTS balance_ledger_no_update
+    BEFORE UPDATE ON balance_ledger
+BEGIN
+    SELECT RAISE(ABORT, 'balance_ledger is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS balance_ledger_no_delete
+    BEFORE DELETE ON balance_ledger
+BEGIN
+    SELECT RAISE(ABORT, 'balance_ledger is append-only');
+END;
+
+-- price is held in escrow from purchase until the order is completed or cancelled
+CREATE TABLE IF NOT EXISTS orders
+(
+    id         integer primary key autoincrement,
+    item_id    integer NOT NULL,
+    buyer_id   integer NOT NULL,
+    seller_id  integer NOT NULL,
+    price      integer NOT NULL,
+    status     integer NOT NULL,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS orders_buyer_id ON orders (buyer_id);
+CREATE INDEX IF NOT EXISTS orders_seller_id ON orders (seller_id);
+CREATE INDEX IF NOT EXISTS orders_status ON orders (status, updated_at);
+
+-- images of an item in display order. position 0 is the cover
+CREATE TABLE IF NOT EXISTS item_images
+(
+    id         integer primary key autoincrement,
+    item_id    integer NOT NULL,
+    blob_key   text    NOT NULL,
+    position   integer NOT NULL,
+    created_at text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS item_images_item_id ON item_images (item_id, position);
+
+-- a login. Revoking it rejects its access tokens and refresh tokens
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id         text primary key,
+    user_id    integer NOT NULL,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    revoked_at text
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+-- refresh tokens are kept as hashes. used_at is set when a token is rotated,
+-- and a used token presented again revokes its session
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    token_hash text primary key,
+    session_id text NOT NULL,
+    expires_at text NOT NULL,
+    used_at    text,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id ON refresh_tokens (session_id);
+
+-- password reset tokens are kept as hashes and deleted once one of the user's is used
+CREATE TABLE IF NOT EXISTS password_resets
+(
+    token_hash text primary key,
+    user_id    integer NOT NULL,
+    expires_at text NOT NULL,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_id ON password_resets (user_id);
+
+-- failed logins in a row per key, which is "user:<id>" for accounts, "name:<name>" or "id:<id>"
+-- for names and ids no user has, and "ip:<address>" for clients
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    key            text primary key,
+    failures       integer NOT NULL,
+    last_failed_at text NOT NULL,
+    locked_until   text
+);
+
+-- the audit trail of every login attempt
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    id         integer primary key autoincrement,
+    user_id    integer,
+    identifier text NOT NULL,
+    ip         text NOT NULL,
+    outcome    text NOT NULL,
+    created_at text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_user_id ON login_attempts (user_id, created_at);
+
+-- the authenticator of a user, pending until enabled_at is set
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id        integer primary key,
+    secret         text NOT NULL,
+    enabled_at     text,
+    last_used_step integer NOT NULL DEFAULT 0
+);
+
+-- recovery codes are kept as hashes and work once each
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    code_hash text primary key,
+    user_id   integer NOT NULL,
+    used_at   text
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id ON recovery_codes (user_id);